@@ -16,18 +16,26 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/nanosapp/vault-operator/pkg/operator"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 	"github.com/nanosapp/vault-operator/pkg/util/probe"
+	"github.com/nanosapp/vault-operator/pkg/webhook"
 	"github.com/nanosapp/vault-operator/version"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -36,7 +44,54 @@ import (
 	"k8s.io/client-go/tools/record"
 )
 
+var (
+	webhookListenAddr string
+	webhookCertFile   string
+	webhookKeyFile    string
+	webhookCAFile     string
+
+	createCRD             bool
+	migrateStorageVersion bool
+
+	clusterWide       bool
+	namespaces        string
+	namespaceSelector string
+	etcdClusterWide   bool
+
+	operatorPodLabels           string
+	etcdOperatorPodLabels       string
+	etcdBackupOperatorPodLabels string
+
+	resyncPeriod       time.Duration
+	healthCheckTimeout time.Duration
+	workers            int
+
+	leaderElectionLock string
+)
+
+func init() {
+	flag.StringVar(&webhookListenAddr, "webhook-listen-addr", "", "The address to serve the VaultService admission webhooks on, e.g. 0.0.0.0:8443. Webhooks are disabled if empty.")
+	flag.StringVar(&webhookCertFile, "webhook-tls-cert-file", "/etc/vault-operator/webhook/tls.crt", "The TLS certificate file of the admission webhook server.")
+	flag.StringVar(&webhookKeyFile, "webhook-tls-key-file", "/etc/vault-operator/webhook/tls.key", "The TLS key file of the admission webhook server.")
+	flag.StringVar(&webhookCAFile, "webhook-ca-file", "", "The CA file that signed the webhook TLS certificate. The CRD registered with -create-crd uses the conversion webhook of this operator, so it is required then.")
+	flag.BoolVar(&createCRD, "create-crd", true, "Create or update the VaultService CRD on startup. Requires -webhook-listen-addr and -webhook-ca-file. Disable it for clusters where the operator may not manage CRDs.")
+	flag.BoolVar(&migrateStorageVersion, "migrate-storage-version", false, "Rewrite all VaultServices in the storage version (v1beta1) before starting the operator.")
+	flag.BoolVar(&clusterWide, "cluster-wide", false, "Watch VaultServices in all namespaces instead of only the operator's namespace.")
+	flag.StringVar(&namespaceSelector, "namespace-selector", "", "In the cluster-wide mode, only watch namespaces with matching labels, e.g. vault-operator=enabled.")
+	flag.StringVar(&namespaces, "namespaces", "", "Comma separated list of namespaces to watch instead of only the operator's namespace.")
+	flag.BoolVar(&etcdClusterWide, "etcd-cluster-wide", false, "Create etcd clusters to be managed by an etcd operator running in the cluster-wide mode.")
+	flag.StringVar(&operatorPodLabels, "operator-pod-labels", "name=vault-operator", "The labels of the vault operator pods, which are allowed to health check the vault pods by the NetworkPolicies of spec.networkPolicy.")
+	flag.StringVar(&etcdOperatorPodLabels, "etcd-operator-pod-labels", "name=etcd-operator", "The labels of the etcd operator pods, which are allowed to reach the etcd pods by the NetworkPolicies of spec.networkPolicy.")
+	flag.StringVar(&etcdBackupOperatorPodLabels, "etcd-backup-operator-pod-labels", "name=etcd-backup-operator", "The labels of the etcd backup operator pods, which are allowed to reach the etcd pods by the NetworkPolicies of spec.networkPolicy if spec.upgradeStrategy.backup is set.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 30*time.Second, "The period after which every vault cluster is reconciled and health checked again.")
+	flag.DurationVar(&healthCheckTimeout, "health-check-timeout", 5*time.Second, "The timeout of a health check request to a vault pod.")
+	flag.IntVar(&workers, "workers", 4, "The number of vault clusters reconciled in parallel.")
+	flag.StringVar(&leaderElectionLock, "leader-election-lock", resourcelock.LeasesResourceLock, "The lock of the leader election: \"leases\", or \"endpointsleases\" to also hold the Endpoints lock while upgrading from operators that only used it.")
+}
+
 func main() {
+	flag.Parse()
+
 	namespace := os.Getenv("MY_POD_NAMESPACE")
 	if len(namespace) == 0 {
 		logrus.Fatalf("must set env MY_POD_NAMESPACE")
@@ -46,6 +101,11 @@ func main() {
 		logrus.Fatalf("must set env MY_POD_NAME")
 	}
 
+	cfg, err := newOperatorConfig(namespace)
+	if err != nil {
+		logrus.Fatalf("invalid operator config: %v", err)
+	}
+
 	logrus.Infof("Go Version: %s", runtime.Version())
 	logrus.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
 	logrus.Infof("vault-operator Version: %v", version.Version)
@@ -58,16 +118,29 @@ func main() {
 	kubecli := kubernetes.NewForConfigOrDie(kubecfg)
 
 	http.HandleFunc(probe.HTTPReadyzEndpoint, probe.ReadyzHandler)
+	http.Handle("/metrics", promhttp.Handler())
 	go http.ListenAndServe("0.0.0.0:8080", nil)
 
+	// Webhooks are served by every replica, not only the leader,
+	// since the webhook service load balances across all of them.
+	if len(webhookListenAddr) != 0 {
+		ws := webhook.New(kubecli, webhookListenAddr, webhookCertFile, webhookKeyFile)
+		go func() {
+			if err := ws.Run(context.Background()); err != nil {
+				logrus.Fatalf("admission webhook server stopped with %v", err)
+			}
+		}()
+	}
+
 	id, err := os.Hostname()
 	if err != nil {
 		logrus.Fatalf("failed to get hostname: %v", err)
 	}
-	rl, err := resourcelock.New(resourcelock.EndpointsResourceLock,
+	rl, err := resourcelock.New(leaderElectionLock,
 		namespace,
 		"vault-operator",
 		kubecli.CoreV1(),
+		kubecli.CoordinationV1(),
 		resourcelock.ResourceLockConfig{
 			Identity:      id,
 			EventRecorder: createRecorder(kubecli, name, namespace),
@@ -76,13 +149,15 @@ func main() {
 		logrus.Fatalf("error creating lock: %v", err)
 	}
 
-	leaderelection.RunOrDie(leaderelection.LeaderElectionConfig{
+	leaderelection.RunOrDie(context.TODO(), leaderelection.LeaderElectionConfig{
 		Lock:          rl,
 		LeaseDuration: 15 * time.Second,
 		RenewDeadline: 10 * time.Second,
 		RetryPeriod:   2 * time.Second,
 		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: run,
+			OnStartedLeading: func(ctx context.Context) {
+				run(ctx, cfg)
+			},
 			OnStoppedLeading: func() {
 				logrus.Fatalf("leader election lost")
 			},
@@ -91,9 +166,20 @@ func main() {
 	// unreachable
 }
 
-func run(stop <-chan struct{}) {
-	v := operator.New()
-	err := v.Start(context.TODO())
+func run(ctx context.Context, cfg operator.Config) {
+	if createCRD {
+		if err := registerCRD(ctx, cfg.Namespace); err != nil {
+			logrus.Fatalf("failed to register CRD: %v", err)
+		}
+	}
+
+	v := operator.New(cfg)
+	if migrateStorageVersion {
+		if err := v.MigrateStorageVersion(ctx); err != nil {
+			logrus.Fatalf("storage version migration failed: %v", err)
+		}
+	}
+	err := v.Start(ctx)
 	if err != nil {
 		// If we don't exit the program,
 		// there is another go routine that keeps renewing the LE lock.
@@ -101,9 +187,92 @@ func run(stop <-chan struct{}) {
 	}
 }
 
+// newOperatorConfig returns the operator config for the namespace flags.
+func newOperatorConfig(namespace string) (operator.Config, error) {
+	cfg := operator.Config{
+		Namespace:          namespace,
+		ClusterWide:        clusterWide,
+		EtcdClusterWide:    etcdClusterWide,
+		ResyncPeriod:       resyncPeriod,
+		HealthCheckTimeout: healthCheckTimeout,
+		Workers:            workers,
+	}
+	// Without the conversion webhook, the API server would prune the v1alpha1 fields, such as TLS,
+	// from the Vault CRs stored in v1alpha1 when it serves them as v1beta1.
+	if createCRD && (len(webhookListenAddr) == 0 || len(webhookCAFile) == 0) {
+		return cfg, fmt.Errorf("-create-crd requires -webhook-listen-addr and -webhook-ca-file for the conversion webhook of the CRD")
+	}
+	if len(namespaces) != 0 {
+		if clusterWide {
+			return cfg, fmt.Errorf("-namespaces cannot be used with -cluster-wide")
+		}
+		for _, ns := range strings.Split(namespaces, ",") {
+			if ns = strings.TrimSpace(ns); len(ns) != 0 {
+				cfg.Namespaces = append(cfg.Namespaces, ns)
+			}
+		}
+	}
+	if len(namespaceSelector) != 0 {
+		if !clusterWide {
+			return cfg, fmt.Errorf("-namespace-selector requires -cluster-wide")
+		}
+		sel, err := labels.Parse(namespaceSelector)
+		if err != nil {
+			return cfg, fmt.Errorf("parse namespace selector failed: %v", err)
+		}
+		cfg.NamespaceSelector = sel
+	}
+	var err error
+	cfg.OperatorPodLabels, err = labels.ConvertSelectorToLabelsMap(operatorPodLabels)
+	if err != nil {
+		return cfg, fmt.Errorf("parse operator pod labels failed: %v", err)
+	}
+	cfg.EtcdOperatorPodLabels, err = labels.ConvertSelectorToLabelsMap(etcdOperatorPodLabels)
+	if err != nil {
+		return cfg, fmt.Errorf("parse etcd operator pod labels failed: %v", err)
+	}
+	cfg.EtcdBackupOperatorPodLabels, err = labels.ConvertSelectorToLabelsMap(etcdBackupOperatorPodLabels)
+	if err != nil {
+		return cfg, fmt.Errorf("parse etcd backup operator pod labels failed: %v", err)
+	}
+	return cfg, nil
+}
+
+// registerCRD creates or updates the VaultService CRD with the conversion webhook of the operator,
+// and waits until it is established.
+func registerCRD(ctx context.Context, namespace string) error {
+	caBundle, err := ioutil.ReadFile(webhookCAFile)
+	if err != nil {
+		return fmt.Errorf("read webhook CA file failed: %v", err)
+	}
+	path := webhook.ConvertPath
+	conversion := &apiextensionsv1.CustomResourceConversion{
+		Strategy: apiextensionsv1.WebhookConverter,
+		Webhook: &apiextensionsv1.WebhookConversion{
+			ClientConfig: &apiextensionsv1.WebhookClientConfig{
+				Service: &apiextensionsv1.ServiceReference{
+					Namespace: namespace,
+					Name:      webhook.ServiceName,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			ConversionReviewVersions: []string{"v1"},
+		},
+	}
+
+	extcli := k8sutil.MustNewKubeExtClient()
+	crd := k8sutil.NewVaultServiceCRD(conversion)
+	if err := k8sutil.CreateOrUpdateCRD(ctx, extcli, crd); err != nil {
+		return err
+	}
+	logrus.Infof("registered CRD (%s)", crd.Name)
+	return k8sutil.WaitCRDReady(ctx, extcli, crd.Name)
+}
+
 func createRecorder(kubecli kubernetes.Interface, name, namespace string) record.EventRecorder {
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(logrus.Infof)
-	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: v1core.New(kubecli.Core().RESTClient()).Events(namespace)})
+	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: kubecli.CoreV1().Events(namespace)})
 	return eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: name})
 }
@@ -33,8 +33,8 @@ function rbac_setup() {
     kubectl -n ${TEST_NAMESPACE} create -f example/rbac.yaml
 }
 
+# The vault CRD is registered by the vault operator on startup.
 function setup_all_crds() {
-    kubectl create -f example/vault_crd.yaml 2>/dev/null || :
     kubectl create -f example/etcd_crds.yaml 2>/dev/null || :
 }
 
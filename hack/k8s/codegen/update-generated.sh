@@ -15,6 +15,6 @@ docker run --rm \
   "all" \
   "github.com/nanosapp/vault-operator/pkg/generated" \
   "github.com/nanosapp/vault-operator/pkg/apis" \
-  "vault:v1alpha1" \
+  "vault:v1alpha1,v1beta1" \
   --go-header-file "./hack/k8s/codegen/boilerplate.go.txt" \
   $@
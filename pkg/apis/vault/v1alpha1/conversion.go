@@ -0,0 +1,174 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+)
+
+// V1beta1SpecAnnotation holds the v1beta1 spec of a VaultService that is read
+// or written as v1alpha1, if that spec has fields v1alpha1 cannot represent.
+// It makes the v1beta1 -> v1alpha1 -> v1beta1 conversion lossless.
+const V1beta1SpecAnnotation = "vault.security.coreos.com/v1beta1-spec"
+
+// ConvertTo converts this VaultService to the v1beta1 version.
+func (in *VaultService) ConvertTo(out *v1beta1.VaultService) error {
+	out.TypeMeta = in.TypeMeta
+	out.APIVersion = v1beta1.SchemeGroupVersion.String()
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+
+	out.Spec = v1beta1.VaultServiceSpec{}
+	if data, ok := out.Annotations[V1beta1SpecAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &out.Spec); err != nil {
+			return fmt.Errorf("decode annotation (%s) failed: %v", V1beta1SpecAnnotation, err)
+		}
+		delete(out.Annotations, V1beta1SpecAnnotation)
+		if len(out.Annotations) == 0 {
+			out.Annotations = nil
+		}
+	}
+	// The v1alpha1 fields always win over the stored v1beta1 spec
+	// since the user may have changed them through the v1alpha1 API.
+	convertSpecTo(&in.Spec, &out.Spec)
+	convertStatusTo(&in.Status, &out.Status)
+	return nil
+}
+
+// ConvertFrom converts from the v1beta1 version to this version.
+// Status fields that only exist in v1beta1 are dropped. They are
+// recomputed by the operator, which works on the v1beta1 version.
+func (out *VaultService) ConvertFrom(in *v1beta1.VaultService) error {
+	out.TypeMeta = in.TypeMeta
+	out.APIVersion = SchemeGroupVersion.String()
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+
+	out.Spec = VaultServiceSpec{}
+	convertSpecFrom(&in.Spec, &out.Spec)
+
+	back := v1beta1.VaultServiceSpec{}
+	convertSpecTo(&out.Spec, &back)
+	if !apiequality.Semantic.DeepEqual(back, in.Spec) {
+		data, err := json.Marshal(in.Spec)
+		if err != nil {
+			return fmt.Errorf("encode annotation (%s) failed: %v", V1beta1SpecAnnotation, err)
+		}
+		if out.Annotations == nil {
+			out.Annotations = map[string]string{}
+		}
+		out.Annotations[V1beta1SpecAnnotation] = string(data)
+	}
+
+	convertStatusFrom(&in.Status, &out.Status)
+	return nil
+}
+
+// convertSpecTo overwrites the fields of out that have a v1alpha1 representation.
+func convertSpecTo(in *VaultServiceSpec, out *v1beta1.VaultServiceSpec) {
+	out.Nodes = in.Nodes
+	out.BaseImage = in.BaseImage
+	out.Version = in.Version
+	out.ConfigMapName = in.ConfigMapName
+
+	if in.Pod == nil {
+		out.Pod = nil
+	} else {
+		if out.Pod == nil {
+			out.Pod = &v1beta1.PodPolicy{}
+		}
+		in.Pod.Resources.DeepCopyInto(&out.Pod.Resources)
+	}
+
+	if in.TLS == nil {
+		out.TLS = nil
+	} else {
+		if out.TLS == nil {
+			out.TLS = &v1beta1.TLSSpec{}
+		}
+		if in.TLS.Static == nil {
+			out.TLS.Static = nil
+		} else {
+			out.TLS.Static = &v1beta1.StaticTLS{
+				ServerSecret: in.TLS.Static.ServerSecret,
+				ClientSecret: in.TLS.Static.ClientSecret,
+			}
+		}
+	}
+}
+
+func convertSpecFrom(in *v1beta1.VaultServiceSpec, out *VaultServiceSpec) {
+	out.Nodes = in.Nodes
+	out.BaseImage = in.BaseImage
+	out.Version = in.Version
+	out.ConfigMapName = in.ConfigMapName
+
+	if in.Pod != nil {
+		out.Pod = &PodPolicy{}
+		in.Pod.Resources.DeepCopyInto(&out.Pod.Resources)
+	}
+
+	if in.TLS != nil {
+		out.TLS = &TLSPolicy{}
+		if in.TLS.Static != nil {
+			out.TLS.Static = &StaticTLS{
+				ServerSecret: in.TLS.Static.ServerSecret,
+				ClientSecret: in.TLS.Static.ClientSecret,
+			}
+		}
+	}
+}
+
+func convertStatusTo(in *VaultServiceStatus, out *v1beta1.VaultServiceStatus) {
+	*out = v1beta1.VaultServiceStatus{
+		Phase:       v1beta1.ClusterPhase(in.Phase),
+		Initialized: in.Initialized,
+		ServiceName: in.ServiceName,
+		ClientPort:  in.ClientPort,
+		VaultStatus: v1beta1.VaultStatus{
+			Active:  in.VaultStatus.Active,
+			Standby: copyStrings(in.VaultStatus.Standby),
+			Sealed:  copyStrings(in.VaultStatus.Sealed),
+		},
+		UpdatedNodes: copyStrings(in.UpdatedNodes),
+	}
+}
+
+func convertStatusFrom(in *v1beta1.VaultServiceStatus, out *VaultServiceStatus) {
+	*out = VaultServiceStatus{
+		Phase:       ClusterPhase(in.Phase),
+		Initialized: in.Initialized,
+		ServiceName: in.ServiceName,
+		ClientPort:  in.ClientPort,
+		VaultStatus: VaultStatus{
+			Active:  in.VaultStatus.Active,
+			Standby: copyStrings(in.VaultStatus.Standby),
+			Sealed:  copyStrings(in.VaultStatus.Sealed),
+		},
+		UpdatedNodes: copyStrings(in.UpdatedNodes),
+	}
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	"k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRoundTripV1alpha1(t *testing.T) {
+	tests := []struct {
+		name string
+		vr   *VaultService
+	}{{
+		name: "empty",
+		vr:   &VaultService{},
+	}, {
+		name: "full",
+		vr: &VaultService{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "example",
+				Namespace:   "default",
+				Labels:      map[string]string{"team": "a"},
+				Annotations: map[string]string{"note": "kept"},
+			},
+			Spec: VaultServiceSpec{
+				Nodes:     3,
+				BaseImage: "docker.io/vault",
+				Version:   "1.2.3",
+				Pod: &PodPolicy{Resources: v1.ResourceRequirements{
+					Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+				}},
+				ConfigMapName: "vault-config",
+				TLS: &TLSPolicy{Static: &StaticTLS{
+					ServerSecret: "server",
+					ClientSecret: "client",
+				}},
+			},
+			Status: VaultServiceStatus{
+				Phase:       ClusterPhaseRunning,
+				Initialized: true,
+				ServiceName: "example",
+				ClientPort:  8200,
+				VaultStatus: VaultStatus{
+					Active:  "example-0",
+					Standby: []string{"example-1"},
+					Sealed:  []string{"example-2"},
+				},
+				UpdatedNodes: []string{"example-0", "example-1"},
+			},
+		},
+	}, {
+		name: "tls without static",
+		vr: &VaultService{
+			ObjectMeta: metav1.ObjectMeta{Name: "example"},
+			Spec:       VaultServiceSpec{TLS: &TLSPolicy{}},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.vr.DeepCopy()
+			in.TypeMeta = metav1.TypeMeta{APIVersion: SchemeGroupVersion.String(), Kind: "VaultService"}
+
+			beta := &v1beta1.VaultService{}
+			if err := in.ConvertTo(beta); err != nil {
+				t.Fatalf("failed to convert to v1beta1: %v", err)
+			}
+			if beta.APIVersion != v1beta1.SchemeGroupVersion.String() {
+				t.Errorf("expect apiVersion %s, got %s", v1beta1.SchemeGroupVersion, beta.APIVersion)
+			}
+			out := &VaultService{}
+			if err := out.ConvertFrom(beta); err != nil {
+				t.Fatalf("failed to convert back to v1alpha1: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(in, out) {
+				t.Errorf("round trip changed the VaultService:\nbefore: %+v\nafter:  %+v", in, out)
+			}
+		})
+	}
+}
+
+func TestRoundTripV1beta1(t *testing.T) {
+	in := &v1beta1.VaultService{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1beta1.SchemeGroupVersion.String(), Kind: "VaultService"},
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+		Spec: v1beta1.VaultServiceSpec{
+			Nodes:     2,
+			BaseImage: "docker.io/vault",
+			Version:   "1.2.3",
+			Storage:   v1beta1.StorageSpec{Etcd: &v1beta1.EtcdStorageSpec{Size: 5}},
+			Pod: &v1beta1.PodPolicy{
+				Labels: map[string]string{"team": "a"},
+			},
+			TLS: &v1beta1.TLSSpec{Static: &v1beta1.StaticTLS{
+				ServerSecret: "server",
+				ClientSecret: "client",
+			}},
+		},
+	}
+
+	alpha := &VaultService{}
+	if err := alpha.ConvertFrom(in); err != nil {
+		t.Fatalf("failed to convert to v1alpha1: %v", err)
+	}
+	if _, ok := alpha.Annotations[V1beta1SpecAnnotation]; !ok {
+		t.Fatalf("expect the v1beta1 only fields to be kept in the %s annotation", V1beta1SpecAnnotation)
+	}
+	out := &v1beta1.VaultService{}
+	if err := alpha.ConvertTo(out); err != nil {
+		t.Fatalf("failed to convert back to v1beta1: %v", err)
+	}
+	if !apiequality.Semantic.DeepEqual(in, out) {
+		t.Errorf("round trip changed the VaultService:\nbefore: %+v\nafter:  %+v", in, out)
+	}
+
+	// A spec v1alpha1 can fully represent needs no annotation.
+	in.Spec.Storage = v1beta1.StorageSpec{}
+	in.Spec.Pod = nil
+	alpha = &VaultService{}
+	if err := alpha.ConvertFrom(in); err != nil {
+		t.Fatalf("failed to convert to v1alpha1: %v", err)
+	}
+	if alpha.Annotations != nil {
+		t.Errorf("expect no annotations, got %v", alpha.Annotations)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultBaseImage = "docker.io/vault"
+	// version format is "<upstream-version>-<our-version>"
+	defaultVersion = "1.2.3"
+
+	defaultEtcdSize = 3
+)
+
+type ClusterPhase string
+
+const (
+	ClusterPhaseInitial ClusterPhase = ""
+	ClusterPhaseRunning              = "Running"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type VaultServiceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []VaultService `json:"items"`
+}
+
+// +genclient
+// +genclient:method=GetScale,verb=get,subresource=scale,result=k8s.io/api/autoscaling/v1.Scale
+// +genclient:method=UpdateScale,verb=update,subresource=scale,input=k8s.io/api/autoscaling/v1.Scale,result=k8s.io/api/autoscaling/v1.Scale
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type VaultService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              VaultServiceSpec   `json:"spec"`
+	Status            VaultServiceStatus `json:"status,omitempty"`
+}
+
+type VaultServiceSpec struct {
+	// Number of nodes to deploy for a Vault deployment.
+	// Default: 1.
+	Nodes int32 `json:"nodes,omitempty"`
+
+	// Base image to use for a Vault deployment.
+	BaseImage string `json:"baseImage,omitempty"`
+
+	// Version of Vault to be deployed.
+	Version string `json:"version,omitempty"`
+
+	// Storage defines the storage backend of the Vault nodes.
+	Storage StorageSpec `json:"storage,omitempty"`
+
+	// TLS policy of vault nodes
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// Pod defines the policy for pods owned by vault operator.
+	// This field cannot be updated once the CR is created.
+	Pod *PodPolicy `json:"pod,omitempty"`
+
+	// Workload is either "Deployment" or "StatefulSet".
+	// A Deployment based cluster is migrated to a StatefulSet when this field is changed
+	// to "StatefulSet". It cannot be changed back.
+	// Default: "Deployment".
+	Workload WorkloadKind `json:"workload,omitempty"`
+
+	// Service defines the Kubernetes Service in front of the vault nodes.
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// Ingress exposes the vault cluster outside of Kubernetes.
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// NetworkPolicy makes the operator create NetworkPolicies that only allow
+	// the needed traffic to the vault and etcd pods.
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// UpgradeStrategy defines how the vault nodes are upgraded.
+	// If empty, they are upgraded right away without a canary step.
+	UpgradeStrategy *UpgradeStrategy `json:"upgradeStrategy,omitempty"`
+
+	// MaintenanceWindows are the time windows in which disruptive operations, like upgrades, may begin.
+	// Operations that have begun continue outside of the windows. If empty, they may begin anytime.
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+
+	// Seal defines the seal of the vault nodes, e.g. to enable auto-unseal.
+	// If this is empty, vault nodes use the default Shamir seal.
+	Seal *SealSpec `json:"seal,omitempty"`
+
+	// Telemetry defines how the vault nodes expose their metrics.
+	// This field cannot be updated once the CR is created.
+	Telemetry *TelemetrySpec `json:"telemetry,omitempty"`
+
+	// Monitoring defines the Prometheus Operator objects of the vault cluster.
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+
+	// Config defines common settings of Vault's configuration.
+	// The settings of the ConfigMap of ConfigMapName take precedence over them.
+	// Changes are rolled out to the vault nodes in a maintenance window.
+	Config *ConfigSpec `json:"config,omitempty"`
+
+	// Name of the ConfigMap for Vault's configuration, in HCL or JSON.
+	// If this is empty, operator will create a default config for Vault.
+	// If this is not empty, operator will create a new config from it, replacing
+	// the "listener" and "storage" sections, and the "seal" section if spec.seal is set.
+	// The "telemetry" section is merged with the one of spec.telemetry.
+	// Its settings take precedence over the ones of spec.config.
+	ConfigMapName string `json:"configMapName,omitempty"`
+}
+
+// StorageSpec defines the storage backend of the vault nodes.
+type StorageSpec struct {
+	// Etcd is an etcd cluster deployed by the etcd operator for this vault cluster.
+	// It is currently the only supported storage backend.
+	Etcd *EtcdStorageSpec `json:"etcd,omitempty"`
+}
+
+// EtcdStorageSpec defines the etcd cluster backing the vault nodes.
+type EtcdStorageSpec struct {
+	// Size is the number of etcd members.
+	// Default: 3.
+	Size int `json:"size,omitempty"`
+}
+
+// PodPolicy defines the policy for pods owned by vault operator.
+type PodPolicy struct {
+	// Resources is the resource requirements for the containers.
+	Resources v1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Labels are added to the vault pods.
+	// The "app" and "vault_cluster" labels are reserved for the operator.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the vault pods.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// NodeSelector restricts the vault and etcd pods to the nodes with matching labels.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Affinity is the scheduling affinity of the vault pods.
+	Affinity *v1.Affinity `json:"affinity,omitempty"`
+
+	// Tolerations of the vault and etcd pods.
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+
+	// TopologySpreadConstraints spread the vault pods across the given topology domains.
+	TopologySpreadConstraints []v1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// PriorityClassName is the priority class of the vault pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// ServiceAccountName is the service account the vault pods run as.
+	// It is needed e.g. for the Kubernetes auth method or cloud auto-unseal.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// ImagePullSecrets are the secrets to pull the vault and statsd-exporter images.
+	ImagePullSecrets []v1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// SecurityContext is the security context of the vault pods.
+	// The vault container keeps the IPC_LOCK capability needed for mlock.
+	SecurityContext *v1.PodSecurityContext `json:"securityContext,omitempty"`
+}
+
+// ServiceSpec defines the Kubernetes Services in front of the vault nodes.
+// It applies to the Service of the unsealed nodes as well as to the "-active"
+// and "-standby" Services of the active and standby nodes.
+type ServiceSpec struct {
+	// Type of the Services.
+	// Default: ClusterIP.
+	Type v1.ServiceType `json:"type,omitempty"`
+
+	// Annotations to add to the Services.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// LoadBalancerSourceRanges restricts the client IPs of a LoadBalancer Service.
+	LoadBalancerSourceRanges []string `json:"loadBalancerSourceRanges,omitempty"`
+
+	// ExternalTrafficPolicy of a NodePort or LoadBalancer Service.
+	// "Local" preserves the client IP.
+	ExternalTrafficPolicy v1.ServiceExternalTrafficPolicyType `json:"externalTrafficPolicy,omitempty"`
+}
+
+// SealSpec defines the "seal" section of the vault config.
+type SealSpec struct {
+	// Type of the seal, e.g. "awskms", "gcpckms" or "transit".
+	Type string `json:"type"`
+
+	// Config holds the parameters of the seal section.
+	// Credentials should rather be passed in through the environment of the vault pods.
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// SetDefaults sets the default vaules for the vault spec and returns true if the spec was changed
+func (v *VaultService) SetDefaults() bool {
+	changed := false
+	vs := &v.Spec
+	if vs.Nodes == 0 {
+		vs.Nodes = 1
+		changed = true
+	}
+	if len(vs.BaseImage) == 0 {
+		vs.BaseImage = defaultBaseImage
+		changed = true
+	}
+	if len(vs.Version) == 0 {
+		vs.Version = defaultVersion
+		changed = true
+	}
+	if vs.Storage.Etcd == nil {
+		vs.Storage.Etcd = &EtcdStorageSpec{}
+		changed = true
+	}
+	if vs.Storage.Etcd.Size == 0 {
+		vs.Storage.Etcd.Size = defaultEtcdSize
+		changed = true
+	}
+	if vs.TLS == nil {
+		vs.TLS = &TLSSpec{Static: &StaticTLS{
+			ServerSecret: DefaultVaultServerTLSSecretName(v.Name),
+			ClientSecret: DefaultVaultClientTLSSecretName(v.Name),
+		}}
+		changed = true
+	}
+	if vs.setTelemetryDefaults() {
+		changed = true
+	}
+	if vs.setIngressDefaults() {
+		changed = true
+	}
+	if vs.setUpgradeStrategyDefaults() {
+		changed = true
+	}
+	return changed
+}
+
+type VaultServiceStatus struct {
+	// Phase indicates the state this Vault cluster jumps in.
+	// Phase goes as one way as below:
+	//   Initial -> Running
+	Phase ClusterPhase `json:"phase"`
+
+	// Initialized indicates if the Vault service is initialized.
+	Initialized bool `json:"initialized"`
+
+	// ServiceName is the LB service for accessing vault nodes.
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// ActiveServiceName is the service of the active vault node.
+	ActiveServiceName string `json:"activeServiceName,omitempty"`
+
+	// StandbyServiceName is the service of the standby vault nodes.
+	StandbyServiceName string `json:"standbyServiceName,omitempty"`
+
+	// ClientPort is the port for vault client to access.
+	// It's the same on client LB service and vault nodes.
+	ClientPort int `json:"clientPort,omitempty"`
+
+	// VaultStatus is the set of Vault node specific statuses: Active, Standby, and Sealed
+	VaultStatus VaultStatus `json:"vaultStatus"`
+
+	// PodNames of updated Vault nodes. Updated means the Vault container image version
+	// matches the spec's version.
+	UpdatedNodes []string `json:"updatedNodes,omitempty"`
+
+	// Nodes is the number of running Vault nodes.
+	// It is the status replicas of the scale subresource.
+	Nodes int32 `json:"nodes"`
+
+	// SealedNodes is the number of sealed Vault nodes.
+	SealedNodes int32 `json:"sealedNodes"`
+
+	// Upgrade is the status of the last upgrade of the Vault nodes.
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+
+	// Maintenance is the status of spec.maintenanceWindows.
+	Maintenance *MaintenanceStatus `json:"maintenance,omitempty"`
+
+	// Selector is the label selector of the Vault pods.
+	// It is the status selector of the scale subresource used by HPA.
+	Selector string `json:"selector,omitempty"`
+
+	// IngressKind is the kind of the object created for spec.ingress, so that it is removed
+	// when spec.ingress is removed or its kind is changed.
+	IngressKind IngressKind `json:"ingressKind,omitempty"`
+
+	// Conditions are the latest observations of the state of the Vault cluster, e.g. "ConfigValid".
+	Conditions []VaultServiceCondition `json:"conditions,omitempty"`
+}
+
+type VaultStatus struct {
+	// PodName of the active Vault node. Active node is unsealed.
+	// Only active node can serve requests.
+	// Vault service only points to the active node.
+	Active string `json:"active"`
+
+	// PodNames of the standby Vault nodes. Standby nodes are unsealed.
+	// Standby nodes do not process requests, and instead redirect to the active Vault.
+	Standby []string `json:"standby"`
+
+	// PodNames of Sealed Vault nodes. Sealed nodes MUST be manually unsealed to
+	// become standby or leader.
+	Sealed []string `json:"sealed"`
+}
+
+// DefaultVaultClientTLSSecretName returns the name of the default vault client TLS secret
+func DefaultVaultClientTLSSecretName(vaultName string) string {
+	return vaultName + "-default-vault-client-tls"
+}
+
+// DefaultVaultServerTLSSecretName returns the name of the default vault server TLS secret
+func DefaultVaultServerTLSSecretName(vaultName string) string {
+	return vaultName + "-default-vault-server-tls"
+}
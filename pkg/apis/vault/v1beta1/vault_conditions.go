@@ -0,0 +1,78 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VaultServiceConditionType is the type of a condition of a vault cluster.
+type VaultServiceConditionType string
+
+const (
+	// VaultServiceConditionConfigValid indicates if the vault config, which is the config of
+	// spec.configMapName merged with the sections of the operator, is valid.
+	VaultServiceConditionConfigValid VaultServiceConditionType = "ConfigValid"
+)
+
+const (
+	// ConfigReasonParseError is the reason of a ConfigValid condition whose config could not be parsed.
+	ConfigReasonParseError = "ParseError"
+	// ConfigReasonMerged is the reason of a ConfigValid condition whose config was merged successfully.
+	ConfigReasonMerged = "Merged"
+)
+
+// VaultServiceCondition is an observation of the state of a vault cluster.
+type VaultServiceCondition struct {
+	// Type of the condition, e.g. "ConfigValid".
+	Type VaultServiceConditionType `json:"type"`
+
+	// Status of the condition: "True", "False" or "Unknown".
+	Status v1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the status changed.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a machine readable reason of the status, e.g. "ParseError".
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable explanation of the status.
+	Message string `json:"message,omitempty"`
+}
+
+// GetCondition returns the condition of the given type, or nil if it is not set.
+func (s *VaultServiceStatus) GetCondition(t VaultServiceConditionType) *VaultServiceCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == t {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition sets the condition of its type.
+// The last transition time is kept if the status of the condition is unchanged.
+func (s *VaultServiceStatus) SetCondition(c VaultServiceCondition) {
+	old := s.GetCondition(c.Type)
+	if old == nil {
+		s.Conditions = append(s.Conditions, c)
+		return
+	}
+	if old.Status == c.Status {
+		c.LastTransitionTime = old.LastTransitionTime
+	}
+	*old = c
+}
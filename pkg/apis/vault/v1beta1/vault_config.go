@@ -0,0 +1,59 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// LogFormat is the format of the vault server logs.
+type LogFormat string
+
+const (
+	// LogFormatStandard is the default text format of the logs.
+	LogFormatStandard LogFormat = "standard"
+	// LogFormatJSON writes the logs as JSON.
+	LogFormatJSON LogFormat = "json"
+)
+
+// ConfigSpec defines common settings of the vault server config.
+// Settings of the ConfigMap of spec.configMapName take precedence over them.
+type ConfigSpec struct {
+	// LogLevel is one of "trace", "debug", "info", "warn" or "err".
+	// Default: "info".
+	LogLevel string `json:"logLevel,omitempty"`
+
+	// LogFormat is one of "standard" or "json".
+	// Default: "standard".
+	LogFormat LogFormat `json:"logFormat,omitempty"`
+
+	// DefaultLeaseTTL is the default lease duration of tokens and secrets, e.g. "768h".
+	DefaultLeaseTTL string `json:"defaultLeaseTTL,omitempty"`
+
+	// MaxLeaseTTL is the maximum lease duration of tokens and secrets, e.g. "768h".
+	MaxLeaseTTL string `json:"maxLeaseTTL,omitempty"`
+
+	// DisableMlock disables the mlock syscall, which prevents memory from being swapped to disk.
+	DisableMlock bool `json:"disableMlock,omitempty"`
+
+	// CacheSize is the number of entries of the read cache of the storage backend.
+	CacheSize *int32 `json:"cacheSize,omitempty"`
+
+	// UI enables the built-in web UI.
+	// Default: true.
+	UI *bool `json:"ui,omitempty"`
+
+	// PluginDirectory is the directory of the plugin binaries in the vault image.
+	PluginDirectory string `json:"pluginDirectory,omitempty"`
+
+	// ClusterName is the identifier of the vault cluster. Vault generates one if it is empty.
+	ClusterName string `json:"clusterName,omitempty"`
+}
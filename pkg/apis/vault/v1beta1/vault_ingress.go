@@ -0,0 +1,102 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// IngressKind is the kind of the object exposing the vault cluster outside of Kubernetes.
+type IngressKind string
+
+const (
+	// IngressKindIngress exposes the vault cluster through an Ingress.
+	IngressKindIngress IngressKind = "Ingress"
+	// IngressKindTLSRoute exposes the vault cluster through a Gateway API TLSRoute.
+	IngressKindTLSRoute IngressKind = "TLSRoute"
+)
+
+// IngressTLSMode is how the ingress handles the TLS connections of the vault clients.
+type IngressTLSMode string
+
+const (
+	// IngressTLSPassthrough passes the TLS connections through to the vault nodes,
+	// which present their server certificate to the clients.
+	IngressTLSPassthrough IngressTLSMode = "Passthrough"
+	// IngressTLSReencrypt terminates the TLS connections with the certificate of TLSSecret
+	// and opens new TLS connections to the vault nodes.
+	IngressTLSReencrypt IngressTLSMode = "Reencrypt"
+)
+
+// IngressSpec defines how the vault cluster is exposed outside of Kubernetes.
+// The ingress routes to the "-active" service of the vault cluster.
+type IngressSpec struct {
+	// Host is the external hostname of the vault cluster.
+	// It is added to the generated server certificate, and https://<host> is the
+	// api_addr of the vault nodes, so that redirects work for off-cluster clients.
+	// This field cannot be updated once the CR is created.
+	Host string `json:"host"`
+
+	// Kind is either "Ingress" or "TLSRoute".
+	// This field cannot be updated once the CR is created.
+	// Default: "Ingress".
+	Kind IngressKind `json:"kind,omitempty"`
+
+	// TLSMode is either "Passthrough" or "Reencrypt".
+	// A TLSRoute only supports "Passthrough".
+	// Default: "Passthrough".
+	TLSMode IngressTLSMode `json:"tlsMode,omitempty"`
+
+	// ClassName is the IngressClass of an Ingress,
+	// which selects the ingress controller serving it.
+	ClassName string `json:"className,omitempty"`
+
+	// Annotations are added to the Ingress or TLSRoute.
+	// They override the annotations set by the operator for the TLS mode.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// TLSSecret is the name of the secret holding the certificate the Ingress
+	// presents to the clients in the "Reencrypt" mode.
+	TLSSecret string `json:"tlsSecret,omitempty"`
+
+	// Gateway is the Gateway the TLSRoute is attached to.
+	Gateway *GatewayReference `json:"gateway,omitempty"`
+}
+
+// GatewayReference references a listener of a Gateway API Gateway.
+type GatewayReference struct {
+	// Name of the Gateway.
+	Name string `json:"name"`
+
+	// Namespace of the Gateway.
+	// Default: the namespace of the vault cluster.
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName is the name of the TLS passthrough listener of the Gateway.
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// setIngressDefaults sets the default values of the ingress and returns true if it was changed.
+func (vs *VaultServiceSpec) setIngressDefaults() bool {
+	if vs.Ingress == nil {
+		return false
+	}
+	changed := false
+	if len(vs.Ingress.Kind) == 0 {
+		vs.Ingress.Kind = IngressKindIngress
+		changed = true
+	}
+	if len(vs.Ingress.TLSMode) == 0 {
+		vs.Ingress.TLSMode = IngressTLSPassthrough
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MaintenanceOperationUpgrade is the upgrade of the vault nodes to a new version.
+	MaintenanceOperationUpgrade = "Upgrade"
+	// MaintenanceOperationMigration is the replacement of the nodes of a deployment by the nodes of a statefulset.
+	MaintenanceOperationMigration = "Migration"
+	// MaintenanceOperationCertRotation is the reissue of the default TLS secrets with new DNS names.
+	MaintenanceOperationCertRotation = "CertRotation"
+	// MaintenanceOperationConfigChange is the rollout of the vault nodes to a changed vault config,
+	// server certificate or pod template.
+	MaintenanceOperationConfigChange = "ConfigChange"
+)
+
+// MaintenanceWindow is a recurring time window in which disruptive operations may begin.
+type MaintenanceWindow struct {
+	// Schedule is the start of the window as a cron schedule
+	// "<minute> <hour> <day-of-month> <month> <day-of-week>", e.g. "0 22 * * 1-5".
+	Schedule string `json:"schedule"`
+
+	// Duration of the window, e.g. "4h".
+	Duration string `json:"duration"`
+
+	// TimeZone is the IANA time zone of the schedule, e.g. "Europe/Berlin".
+	// Default: "UTC".
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// MaintenanceStatus is the status of the maintenance windows of a vault cluster.
+type MaintenanceStatus struct {
+	// InWindow indicates if disruptive operations may begin now.
+	InWindow bool `json:"inWindow"`
+
+	// NextWindow is the start of the next maintenance window.
+	NextWindow *metav1.Time `json:"nextWindow,omitempty"`
+
+	// PendingOperations are the disruptive operations waiting for the next maintenance window, e.g. "Upgrade".
+	PendingOperations []string `json:"pendingOperations,omitempty"`
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// MonitoringSpec defines the Prometheus Operator objects created for the vault cluster.
+// They are skipped if the Prometheus Operator CRDs are not installed.
+type MonitoringSpec struct {
+	// ServiceMonitor enables a ServiceMonitor scraping the vault nodes,
+	// and a PrometheusRule with the default alerts of the vault cluster.
+	ServiceMonitor *ServiceMonitorSpec `json:"serviceMonitor,omitempty"`
+}
+
+// ServiceMonitorSpec defines the ServiceMonitor and PrometheusRule of the vault cluster.
+type ServiceMonitorSpec struct {
+	// Labels are added to the ServiceMonitor and the PrometheusRule,
+	// e.g. to match the selectors of the Prometheus CR.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Interval is the scrape interval, e.g. "30s".
+	// Default: the scrape interval of Prometheus.
+	Interval string `json:"interval,omitempty"`
+
+	// DisableRules skips the PrometheusRule with the default alerts.
+	DisableRules bool `json:"disableRules,omitempty"`
+}
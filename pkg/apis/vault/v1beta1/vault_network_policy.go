@@ -0,0 +1,33 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// NetworkPolicySpec restricts the traffic to the vault and etcd pods of the vault cluster.
+// The vault nodes, the vault operator and the etcd operator are always allowed
+// to reach the ports they need.
+type NetworkPolicySpec struct {
+	// Clients are allowed to connect to the vault client port,
+	// e.g. the namespaces or pods of the applications and the ingress controller.
+	// If empty, no other clients are allowed.
+	Clients []networkingv1.NetworkPolicyPeer `json:"clients,omitempty"`
+
+	// Prometheus are allowed to scrape the metrics of the vault nodes,
+	// on the statsd-exporter port or the vault client port depending on the telemetry.
+	Prometheus []networkingv1.NetworkPolicyPeer `json:"prometheus,omitempty"`
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// TelemetryType is the way the vault nodes expose their metrics.
+type TelemetryType string
+
+const (
+	// TelemetryStatsd sends the metrics to a statsd-exporter sidecar,
+	// which exposes them to Prometheus.
+	TelemetryStatsd TelemetryType = "statsd"
+	// TelemetryPrometheus makes vault expose the metrics itself on /v1/sys/metrics.
+	// It requires Vault 1.1 or newer.
+	TelemetryPrometheus TelemetryType = "prometheus"
+	// TelemetryDisabled disables the telemetry.
+	TelemetryDisabled TelemetryType = "disabled"
+
+	// TelemetryTokenSecretKey is the key of the vault token in the TokenSecret.
+	TelemetryTokenSecretKey = "token"
+
+	defaultPrometheusRetentionTime = "24h"
+)
+
+// TelemetrySpec defines the telemetry of the vault nodes.
+type TelemetrySpec struct {
+	// Type is one of "statsd", "prometheus" or "disabled".
+	// Default: "statsd".
+	Type TelemetryType `json:"type,omitempty"`
+
+	// Prometheus configures the native Prometheus telemetry of the "prometheus" type.
+	Prometheus *PrometheusTelemetrySpec `json:"prometheus,omitempty"`
+
+	// Statsd configures the statsd-exporter sidecar of the "statsd" type.
+	Statsd *StatsdTelemetrySpec `json:"statsd,omitempty"`
+}
+
+// PrometheusTelemetrySpec defines the native Prometheus telemetry of the vault nodes.
+type PrometheusTelemetrySpec struct {
+	// RetentionTime is how long vault keeps the metrics in memory,
+	// i.e. the prometheus_retention_time of the telemetry section.
+	// Default: "24h".
+	RetentionTime string `json:"retentionTime,omitempty"`
+
+	// UnauthenticatedMetricsAccess allows scraping /v1/sys/metrics without a vault token.
+	// It requires Vault 1.3 or newer.
+	UnauthenticatedMetricsAccess bool `json:"unauthenticatedMetricsAccess,omitempty"`
+
+	// TokenSecret is the name of the secret holding the vault token used to
+	// scrape /v1/sys/metrics under the "token" key.
+	// The token needs a policy allowing to read sys/metrics.
+	TokenSecret string `json:"tokenSecret,omitempty"`
+}
+
+// StatsdTelemetrySpec defines the statsd-exporter sidecar of the vault pods.
+type StatsdTelemetrySpec struct {
+	// Image is the statsd-exporter image.
+	// Default: "prom/statsd-exporter:v0.5.0".
+	Image string `json:"image,omitempty"`
+
+	// MappingConfigMapName is the name of the ConfigMap holding the mapping config
+	// of the statsd-exporter under the "statsd-mapping.conf" key.
+	MappingConfigMapName string `json:"mappingConfigMapName,omitempty"`
+}
+
+// TelemetryTypeOf returns the telemetry type of the given vault spec.
+func TelemetryTypeOf(spec *VaultServiceSpec) TelemetryType {
+	if spec.Telemetry == nil || len(spec.Telemetry.Type) == 0 {
+		return TelemetryStatsd
+	}
+	return spec.Telemetry.Type
+}
+
+// setTelemetryDefaults sets the default values of the telemetry and returns true if it was changed.
+func (vs *VaultServiceSpec) setTelemetryDefaults() bool {
+	changed := false
+	if vs.Telemetry == nil {
+		vs.Telemetry = &TelemetrySpec{}
+		changed = true
+	}
+	if len(vs.Telemetry.Type) == 0 {
+		vs.Telemetry.Type = TelemetryStatsd
+		changed = true
+	}
+	if vs.Telemetry.Type != TelemetryPrometheus {
+		return changed
+	}
+	if vs.Telemetry.Prometheus == nil {
+		vs.Telemetry.Prometheus = &PrometheusTelemetrySpec{}
+		changed = true
+	}
+	if len(vs.Telemetry.Prometheus.RetentionTime) == 0 {
+		vs.Telemetry.Prometheus.RetentionTime = defaultPrometheusRetentionTime
+		changed = true
+	}
+	return changed
+}
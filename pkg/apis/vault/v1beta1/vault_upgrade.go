@@ -0,0 +1,156 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpgradePhase is the phase of the upgrade of a vault cluster.
+type UpgradePhase string
+
+const (
+	// UpgradePhasePending means the upgrade has not started since it is paused.
+	UpgradePhasePending UpgradePhase = "Pending"
+	// UpgradePhaseBackingUp means a backup of the storage is taken before the nodes are upgraded.
+	UpgradePhaseBackingUp UpgradePhase = "BackingUp"
+	// UpgradePhaseCanary means the canary node of the new version waits to be unsealed.
+	UpgradePhaseCanary UpgradePhase = "Canary"
+	// UpgradePhaseSoaking means the canary node has to stay healthy for the soak period.
+	UpgradePhaseSoaking UpgradePhase = "Soaking"
+	// UpgradePhaseRollingOut means all standby nodes are upgraded, after which the active node steps down.
+	UpgradePhaseRollingOut UpgradePhase = "RollingOut"
+	// UpgradePhaseCompleted means all nodes run the new version.
+	// With MultiHop, the upgrade to the next version starts afterwards until TargetVersion is reached.
+	UpgradePhaseCompleted UpgradePhase = "Completed"
+	// UpgradePhaseRolledBack means the new version was not unsealed in time,
+	// and the nodes were rolled back to the previous version.
+	UpgradePhaseRolledBack UpgradePhase = "RolledBack"
+
+	defaultCanarySoakPeriod = "5m"
+
+	// StepDownTokenKey is the key of the token in the Secret of UpgradeStrategy.StepDownTokenSecret.
+	StepDownTokenKey = "token"
+)
+
+// UpgradeStrategy defines how the vault nodes are upgraded when spec.version or spec.baseImage changes.
+type UpgradeStrategy struct {
+	// Paused keeps upgrades from starting, and halts an upgrade in progress.
+	Paused bool `json:"paused,omitempty"`
+
+	// Canary upgrades a single additional standby node first. The other nodes are only
+	// upgraded once the canary node is unsealed and stays healthy for the soak period.
+	Canary *CanarySpec `json:"canary,omitempty"`
+
+	// RollbackDeadline is the time the canary node, or all upgraded nodes, have to be
+	// unsealed. The vault nodes are rolled back to the previous version otherwise.
+	// Upgraded nodes are sealed until they are unsealed, so this is mostly useful with auto-unseal.
+	// If empty, upgrades are never rolled back.
+	RollbackDeadline string `json:"rollbackDeadline,omitempty"`
+
+	// MultiHop upgrades through the latest patch release of every release series between
+	// the current version and spec.version in sequence, instead of rejecting such an upgrade.
+	// Each intermediate upgrade completes before the next one starts.
+	MultiHop bool `json:"multiHop,omitempty"`
+
+	// Backup takes a backup of the storage before every upgrade. The upgrade does not start
+	// until the backup succeeded.
+	Backup *UpgradeBackupSpec `json:"backup,omitempty"`
+
+	// StepDownTokenSecret is the name of a Secret with a Vault token under the "token" key, which
+	// is allowed to use sys/step-down. If set, the active node of the previous version steps down
+	// before its pod is deleted, so that an upgraded node takes over right away.
+	StepDownTokenSecret string `json:"stepDownTokenSecret,omitempty"`
+
+	// Force allows downgrades, versions that are not supported by the operator,
+	// and upgrades that skip release series without MultiHop.
+	Force bool `json:"force,omitempty"`
+}
+
+// UpgradeBackupSpec defines where the backups before the upgrades are stored.
+// The etcd storage is backed up by the etcd backup operator, which has to be running.
+type UpgradeBackupSpec struct {
+	// S3 stores the backups in S3. It is currently the only supported backup storage.
+	S3 *S3BackupSpec `json:"s3,omitempty"`
+}
+
+// S3BackupSpec defines the S3 location of the backups.
+type S3BackupSpec struct {
+	// Prefix is the location of the backups in the format "<s3-bucket-name>[/<path>]".
+	// The backup of an upgrade is stored at "<prefix>/<vault-name>_v<from-version>_<time>".
+	Prefix string `json:"prefix"`
+
+	// AWSSecret is the name of the Secret with the AWS "credentials" and "config" files,
+	// as expected by the etcd backup operator.
+	AWSSecret string `json:"awsSecret"`
+
+	// Endpoint is the URL of an S3 compatible service, if not AWS S3.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// ForcePathStyle makes the S3 client use path style URLs, as needed by some S3 compatible services.
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+}
+
+// CanarySpec defines the canary step of an upgrade.
+type CanarySpec struct {
+	// SoakPeriod is how long the canary node has to stay unsealed.
+	// Default: "5m".
+	SoakPeriod string `json:"soakPeriod,omitempty"`
+}
+
+// UpgradeStatus is the status of the last upgrade of a vault cluster.
+type UpgradeStatus struct {
+	// Phase of the upgrade.
+	Phase UpgradePhase `json:"phase,omitempty"`
+
+	// FromVersion is the version of the vault nodes before the upgrade.
+	FromVersion string `json:"fromVersion,omitempty"`
+
+	// ToVersion is the version the vault nodes are upgraded to.
+	ToVersion string `json:"toVersion,omitempty"`
+
+	// TargetVersion is spec.version. It differs from ToVersion while
+	// the vault nodes are upgraded through an intermediate version.
+	TargetVersion string `json:"targetVersion,omitempty"`
+
+	// FromImage is the image of the vault nodes before the upgrade,
+	// which they are rolled back to.
+	FromImage string `json:"fromImage,omitempty"`
+
+	// BackupPath is the location of the backup taken before the upgrade,
+	// e.g. "<s3-bucket-name>/<path>" for S3.
+	BackupPath string `json:"backupPath,omitempty"`
+
+	// StartTime is when the current phase started.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CanaryReadyTime is when the canary node became unsealed, i.e. the start of the soak period.
+	CanaryReadyTime *metav1.Time `json:"canaryReadyTime,omitempty"`
+
+	// Message explains the phase, e.g. why the upgrade was rolled back.
+	Message string `json:"message,omitempty"`
+}
+
+// setUpgradeStrategyDefaults sets the default values of the upgrade strategy and returns true if it was changed.
+func (vs *VaultServiceSpec) setUpgradeStrategyDefaults() bool {
+	if vs.UpgradeStrategy == nil || vs.UpgradeStrategy.Canary == nil {
+		return false
+	}
+	if len(vs.UpgradeStrategy.Canary.SoakPeriod) == 0 {
+		vs.UpgradeStrategy.Canary.SoakPeriod = defaultCanarySoakPeriod
+		return true
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// WorkloadKind is the kind of the Kubernetes workload running the vault nodes.
+type WorkloadKind string
+
+const (
+	// WorkloadKindDeployment runs the vault nodes in a Deployment.
+	// The pods get new names whenever they are replaced, and are addressed by their IPs.
+	WorkloadKindDeployment WorkloadKind = "Deployment"
+	// WorkloadKindStatefulSet runs the vault nodes in a StatefulSet with a headless Service,
+	// so that every node keeps its name and DNS name across restarts and upgrades.
+	WorkloadKindStatefulSet WorkloadKind = "StatefulSet"
+)
+
+// WorkloadKindOf returns the workload kind of the vault spec, which is a Deployment by default.
+func WorkloadKindOf(vs *VaultServiceSpec) WorkloadKind {
+	if len(vs.Workload) == 0 {
+		return WorkloadKindDeployment
+	}
+	return vs.Workload
+}
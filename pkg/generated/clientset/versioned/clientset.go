@@ -12,11 +12,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Code generated by client-gen. DO NOT EDIT.
+
 package versioned
 
 import (
+	"fmt"
+	"net/http"
+
 	vaultv1alpha1 "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/typed/vault/v1alpha1"
-	glog "github.com/golang/glog"
+	vaultv1beta1 "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/typed/vault/v1beta1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
 	flowcontrol "k8s.io/client-go/util/flowcontrol"
@@ -25,15 +30,14 @@ import (
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
 	VaultV1alpha1() vaultv1alpha1.VaultV1alpha1Interface
-	// Deprecated: please explicitly pick a version if possible.
-	Vault() vaultv1alpha1.VaultV1alpha1Interface
+	VaultV1beta1() vaultv1beta1.VaultV1beta1Interface
 }
 
-// Clientset contains the clients for groups. Each group has exactly one
-// version included in a Clientset.
+// Clientset contains the clients for groups.
 type Clientset struct {
 	*discovery.DiscoveryClient
 	vaultV1alpha1 *vaultv1alpha1.VaultV1alpha1Client
+	vaultV1beta1  *vaultv1beta1.VaultV1beta1Client
 }
 
 // VaultV1alpha1 retrieves the VaultV1alpha1Client
@@ -41,10 +45,9 @@ func (c *Clientset) VaultV1alpha1() vaultv1alpha1.VaultV1alpha1Interface {
 	return c.vaultV1alpha1
 }
 
-// Deprecated: Vault retrieves the default version of VaultClient.
-// Please explicitly pick a version.
-func (c *Clientset) Vault() vaultv1alpha1.VaultV1alpha1Interface {
-	return c.vaultV1alpha1
+// VaultV1beta1 retrieves the VaultV1beta1Client
+func (c *Clientset) VaultV1beta1() vaultv1beta1.VaultV1beta1Interface {
+	return c.vaultV1beta1
 }
 
 // Discovery retrieves the DiscoveryClient
@@ -56,21 +59,52 @@ func (c *Clientset) Discovery() discovery.DiscoveryInterface {
 }
 
 // NewForConfig creates a new Clientset for the given config.
+// If config's RateLimiter is not set and QPS and Burst are acceptable,
+// NewForConfig will generate a rate-limiter in configShallowCopy.
+// NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
+// where httpClient was generated with rest.HTTPClientFor(c).
 func NewForConfig(c *rest.Config) (*Clientset, error) {
 	configShallowCopy := *c
+
+	if configShallowCopy.UserAgent == "" {
+		configShallowCopy.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	// share the transport between all clients
+	httpClient, err := rest.HTTPClientFor(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewForConfigAndClient(&configShallowCopy, httpClient)
+}
+
+// NewForConfigAndClient creates a new Clientset for the given config and http client.
+// Note the http client provided takes precedence over the configured transport values.
+// If config's RateLimiter is not set and QPS and Burst are acceptable,
+// NewForConfigAndClient will generate a rate-limiter in configShallowCopy.
+func NewForConfigAndClient(c *rest.Config, httpClient *http.Client) (*Clientset, error) {
+	configShallowCopy := *c
 	if configShallowCopy.RateLimiter == nil && configShallowCopy.QPS > 0 {
+		if configShallowCopy.Burst <= 0 {
+			return nil, fmt.Errorf("burst is required to be greater than 0 when RateLimiter is not set and QPS is set to greater than 0")
+		}
 		configShallowCopy.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(configShallowCopy.QPS, configShallowCopy.Burst)
 	}
+
 	var cs Clientset
 	var err error
-	cs.vaultV1alpha1, err = vaultv1alpha1.NewForConfig(&configShallowCopy)
+	cs.vaultV1alpha1, err = vaultv1alpha1.NewForConfigAndClient(&configShallowCopy, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	cs.vaultV1beta1, err = vaultv1beta1.NewForConfigAndClient(&configShallowCopy, httpClient)
 	if err != nil {
 		return nil, err
 	}
 
-	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(&configShallowCopy)
+	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfigAndClient(&configShallowCopy, httpClient)
 	if err != nil {
-		glog.Errorf("failed to create the DiscoveryClient: %v", err)
 		return nil, err
 	}
 	return &cs, nil
@@ -79,17 +113,18 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 // NewForConfigOrDie creates a new Clientset for the given config and
 // panics if there is an error in the config.
 func NewForConfigOrDie(c *rest.Config) *Clientset {
-	var cs Clientset
-	cs.vaultV1alpha1 = vaultv1alpha1.NewForConfigOrDie(c)
-
-	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
-	return &cs
+	cs, err := NewForConfig(c)
+	if err != nil {
+		panic(err)
+	}
+	return cs
 }
 
 // New creates a new Clientset for the given RESTClient.
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
 	cs.vaultV1alpha1 = vaultv1alpha1.New(c)
+	cs.vaultV1beta1 = vaultv1beta1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
 	return &cs
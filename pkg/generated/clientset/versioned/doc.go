@@ -12,5 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Code generated by client-gen. DO NOT EDIT.
+
 // This package has the automatically generated clientset.
 package versioned
@@ -12,12 +12,16 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Code generated by client-gen. DO NOT EDIT.
+
 package fake
 
 import (
 	clientset "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
 	vaultv1alpha1 "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/typed/vault/v1alpha1"
 	fakevaultv1alpha1 "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/typed/vault/v1alpha1/fake"
+	vaultv1beta1 "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/typed/vault/v1beta1"
+	fakevaultv1beta1 "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/typed/vault/v1beta1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -37,11 +41,20 @@ func NewSimpleClientset(objects ...runtime.Object) *Clientset {
 		}
 	}
 
-	fakePtr := testing.Fake{}
-	fakePtr.AddReactor("*", "*", testing.ObjectReaction(o))
-	fakePtr.AddWatchReactor("*", testing.DefaultWatchReactor(watch.NewFake(), nil))
+	cs := &Clientset{tracker: o}
+	cs.discovery = &fakediscovery.FakeDiscovery{Fake: &cs.Fake}
+	cs.AddReactor("*", "*", testing.ObjectReaction(o))
+	cs.AddWatchReactor("*", func(action testing.Action) (handled bool, ret watch.Interface, err error) {
+		gvr := action.GetResource()
+		ns := action.GetNamespace()
+		watch, err := o.Watch(gvr, ns)
+		if err != nil {
+			return false, nil, err
+		}
+		return true, watch, nil
+	})
 
-	return &Clientset{fakePtr, &fakediscovery.FakeDiscovery{Fake: &fakePtr}}
+	return cs
 }
 
 // Clientset implements clientset.Interface. Meant to be embedded into a
@@ -50,20 +63,28 @@ func NewSimpleClientset(objects ...runtime.Object) *Clientset {
 type Clientset struct {
 	testing.Fake
 	discovery *fakediscovery.FakeDiscovery
+	tracker   testing.ObjectTracker
 }
 
 func (c *Clientset) Discovery() discovery.DiscoveryInterface {
 	return c.discovery
 }
 
-var _ clientset.Interface = &Clientset{}
+func (c *Clientset) Tracker() testing.ObjectTracker {
+	return c.tracker
+}
+
+var (
+	_ clientset.Interface = &Clientset{}
+	_ testing.FakeClient  = &Clientset{}
+)
 
 // VaultV1alpha1 retrieves the VaultV1alpha1Client
 func (c *Clientset) VaultV1alpha1() vaultv1alpha1.VaultV1alpha1Interface {
 	return &fakevaultv1alpha1.FakeVaultV1alpha1{Fake: &c.Fake}
 }
 
-// Vault retrieves the VaultV1alpha1Client
-func (c *Clientset) Vault() vaultv1alpha1.VaultV1alpha1Interface {
-	return &fakevaultv1alpha1.FakeVaultV1alpha1{Fake: &c.Fake}
+// VaultV1beta1 retrieves the VaultV1beta1Client
+func (c *Clientset) VaultV1beta1() vaultv1beta1.VaultV1beta1Interface {
+	return &fakevaultv1beta1.FakeVaultV1beta1{Fake: &c.Fake}
 }
@@ -12,9 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Code generated by client-gen. DO NOT EDIT.
+
 package fake
 
 import (
+	"context"
+
 	v1alpha1 "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	labels "k8s.io/apimachinery/pkg/labels"
@@ -35,7 +39,7 @@ var vaultservicesResource = schema.GroupVersionResource{Group: "vault.security.c
 var vaultservicesKind = schema.GroupVersionKind{Group: "vault.security.coreos.com", Version: "v1alpha1", Kind: "VaultService"}
 
 // Get takes name of the vaultService, and returns the corresponding vaultService object, and an error if there is any.
-func (c *FakeVaultServices) Get(name string, options v1.GetOptions) (result *v1alpha1.VaultService, err error) {
+func (c *FakeVaultServices) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.VaultService, err error) {
 	obj, err := c.Fake.
 		Invokes(testing.NewGetAction(vaultservicesResource, c.ns, name), &v1alpha1.VaultService{})
 
@@ -46,7 +50,7 @@ func (c *FakeVaultServices) Get(name string, options v1.GetOptions) (result *v1a
 }
 
 // List takes label and field selectors, and returns the list of VaultServices that match those selectors.
-func (c *FakeVaultServices) List(opts v1.ListOptions) (result *v1alpha1.VaultServiceList, err error) {
+func (c *FakeVaultServices) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.VaultServiceList, err error) {
 	obj, err := c.Fake.
 		Invokes(testing.NewListAction(vaultservicesResource, vaultservicesKind, c.ns, opts), &v1alpha1.VaultServiceList{})
 
@@ -58,7 +62,7 @@ func (c *FakeVaultServices) List(opts v1.ListOptions) (result *v1alpha1.VaultSer
 	if label == nil {
 		label = labels.Everything()
 	}
-	list := &v1alpha1.VaultServiceList{}
+	list := &v1alpha1.VaultServiceList{ListMeta: obj.(*v1alpha1.VaultServiceList).ListMeta}
 	for _, item := range obj.(*v1alpha1.VaultServiceList).Items {
 		if label.Matches(labels.Set(item.Labels)) {
 			list.Items = append(list.Items, item)
@@ -68,14 +72,14 @@ func (c *FakeVaultServices) List(opts v1.ListOptions) (result *v1alpha1.VaultSer
 }
 
 // Watch returns a watch.Interface that watches the requested vaultServices.
-func (c *FakeVaultServices) Watch(opts v1.ListOptions) (watch.Interface, error) {
+func (c *FakeVaultServices) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
 	return c.Fake.
 		InvokesWatch(testing.NewWatchAction(vaultservicesResource, c.ns, opts))
 
 }
 
 // Create takes the representation of a vaultService and creates it.  Returns the server's representation of the vaultService, and an error, if there is any.
-func (c *FakeVaultServices) Create(vaultService *v1alpha1.VaultService) (result *v1alpha1.VaultService, err error) {
+func (c *FakeVaultServices) Create(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.CreateOptions) (result *v1alpha1.VaultService, err error) {
 	obj, err := c.Fake.
 		Invokes(testing.NewCreateAction(vaultservicesResource, c.ns, vaultService), &v1alpha1.VaultService{})
 
@@ -86,7 +90,7 @@ func (c *FakeVaultServices) Create(vaultService *v1alpha1.VaultService) (result
 }
 
 // Update takes the representation of a vaultService and updates it. Returns the server's representation of the vaultService, and an error, if there is any.
-func (c *FakeVaultServices) Update(vaultService *v1alpha1.VaultService) (result *v1alpha1.VaultService, err error) {
+func (c *FakeVaultServices) Update(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.UpdateOptions) (result *v1alpha1.VaultService, err error) {
 	obj, err := c.Fake.
 		Invokes(testing.NewUpdateAction(vaultservicesResource, c.ns, vaultService), &v1alpha1.VaultService{})
 
@@ -98,7 +102,7 @@ func (c *FakeVaultServices) Update(vaultService *v1alpha1.VaultService) (result
 
 // UpdateStatus was generated because the type contains a Status member.
 // Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
-func (c *FakeVaultServices) UpdateStatus(vaultService *v1alpha1.VaultService) (*v1alpha1.VaultService, error) {
+func (c *FakeVaultServices) UpdateStatus(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.UpdateOptions) (*v1alpha1.VaultService, error) {
 	obj, err := c.Fake.
 		Invokes(testing.NewUpdateSubresourceAction(vaultservicesResource, "status", c.ns, vaultService), &v1alpha1.VaultService{})
 
@@ -109,25 +113,25 @@ func (c *FakeVaultServices) UpdateStatus(vaultService *v1alpha1.VaultService) (*
 }
 
 // Delete takes name of the vaultService and deletes it. Returns an error if one occurs.
-func (c *FakeVaultServices) Delete(name string, options *v1.DeleteOptions) error {
+func (c *FakeVaultServices) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	_, err := c.Fake.
-		Invokes(testing.NewDeleteAction(vaultservicesResource, c.ns, name), &v1alpha1.VaultService{})
+		Invokes(testing.NewDeleteActionWithOptions(vaultservicesResource, c.ns, name, opts), &v1alpha1.VaultService{})
 
 	return err
 }
 
 // DeleteCollection deletes a collection of objects.
-func (c *FakeVaultServices) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
-	action := testing.NewDeleteCollectionAction(vaultservicesResource, c.ns, listOptions)
+func (c *FakeVaultServices) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(vaultservicesResource, c.ns, listOpts)
 
 	_, err := c.Fake.Invokes(action, &v1alpha1.VaultServiceList{})
 	return err
 }
 
 // Patch applies the patch and returns the patched vaultService.
-func (c *FakeVaultServices) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.VaultService, err error) {
+func (c *FakeVaultServices) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.VaultService, err error) {
 	obj, err := c.Fake.
-		Invokes(testing.NewPatchSubresourceAction(vaultservicesResource, c.ns, name, data, subresources...), &v1alpha1.VaultService{})
+		Invokes(testing.NewPatchSubresourceAction(vaultservicesResource, c.ns, name, pt, data, subresources...), &v1alpha1.VaultService{})
 
 	if obj == nil {
 		return nil, err
@@ -12,9 +12,14 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// Code generated by client-gen. DO NOT EDIT.
+
 package v1alpha1
 
 import (
+	"context"
+	"time"
+
 	v1alpha1 "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
 	scheme "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/scheme"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,15 +36,15 @@ type VaultServicesGetter interface {
 
 // VaultServiceInterface has methods to work with VaultService resources.
 type VaultServiceInterface interface {
-	Create(*v1alpha1.VaultService) (*v1alpha1.VaultService, error)
-	Update(*v1alpha1.VaultService) (*v1alpha1.VaultService, error)
-	UpdateStatus(*v1alpha1.VaultService) (*v1alpha1.VaultService, error)
-	Delete(name string, options *v1.DeleteOptions) error
-	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
-	Get(name string, options v1.GetOptions) (*v1alpha1.VaultService, error)
-	List(opts v1.ListOptions) (*v1alpha1.VaultServiceList, error)
-	Watch(opts v1.ListOptions) (watch.Interface, error)
-	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.VaultService, err error)
+	Create(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.CreateOptions) (*v1alpha1.VaultService, error)
+	Update(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.UpdateOptions) (*v1alpha1.VaultService, error)
+	UpdateStatus(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.UpdateOptions) (*v1alpha1.VaultService, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.VaultService, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.VaultServiceList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.VaultService, err error)
 	VaultServiceExpansion
 }
 
@@ -58,113 +63,131 @@ func newVaultServices(c *VaultV1alpha1Client, namespace string) *vaultServices {
 }
 
 // Get takes name of the vaultService, and returns the corresponding vaultService object, and an error if there is any.
-func (c *vaultServices) Get(name string, options v1.GetOptions) (result *v1alpha1.VaultService, err error) {
+func (c *vaultServices) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.VaultService, err error) {
 	result = &v1alpha1.VaultService{}
 	err = c.client.Get().
 		Namespace(c.ns).
 		Resource("vaultservices").
 		Name(name).
 		VersionedParams(&options, scheme.ParameterCodec).
-		Do().
+		Do(ctx).
 		Into(result)
 	return
 }
 
 // List takes label and field selectors, and returns the list of VaultServices that match those selectors.
-func (c *vaultServices) List(opts v1.ListOptions) (result *v1alpha1.VaultServiceList, err error) {
+func (c *vaultServices) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.VaultServiceList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
 	result = &v1alpha1.VaultServiceList{}
 	err = c.client.Get().
 		Namespace(c.ns).
 		Resource("vaultservices").
 		VersionedParams(&opts, scheme.ParameterCodec).
-		Do().
+		Timeout(timeout).
+		Do(ctx).
 		Into(result)
 	return
 }
 
 // Watch returns a watch.Interface that watches the requested vaultServices.
-func (c *vaultServices) Watch(opts v1.ListOptions) (watch.Interface, error) {
+func (c *vaultServices) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
 	opts.Watch = true
 	return c.client.Get().
 		Namespace(c.ns).
 		Resource("vaultservices").
 		VersionedParams(&opts, scheme.ParameterCodec).
-		Watch()
+		Timeout(timeout).
+		Watch(ctx)
 }
 
 // Create takes the representation of a vaultService and creates it.  Returns the server's representation of the vaultService, and an error, if there is any.
-func (c *vaultServices) Create(vaultService *v1alpha1.VaultService) (result *v1alpha1.VaultService, err error) {
+func (c *vaultServices) Create(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.CreateOptions) (result *v1alpha1.VaultService, err error) {
 	result = &v1alpha1.VaultService{}
 	err = c.client.Post().
 		Namespace(c.ns).
 		Resource("vaultservices").
+		VersionedParams(&opts, scheme.ParameterCodec).
 		Body(vaultService).
-		Do().
+		Do(ctx).
 		Into(result)
 	return
 }
 
 // Update takes the representation of a vaultService and updates it. Returns the server's representation of the vaultService, and an error, if there is any.
-func (c *vaultServices) Update(vaultService *v1alpha1.VaultService) (result *v1alpha1.VaultService, err error) {
+func (c *vaultServices) Update(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.UpdateOptions) (result *v1alpha1.VaultService, err error) {
 	result = &v1alpha1.VaultService{}
 	err = c.client.Put().
 		Namespace(c.ns).
 		Resource("vaultservices").
 		Name(vaultService.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
 		Body(vaultService).
-		Do().
+		Do(ctx).
 		Into(result)
 	return
 }
 
 // UpdateStatus was generated because the type contains a Status member.
 // Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
-
-func (c *vaultServices) UpdateStatus(vaultService *v1alpha1.VaultService) (result *v1alpha1.VaultService, err error) {
+func (c *vaultServices) UpdateStatus(ctx context.Context, vaultService *v1alpha1.VaultService, opts v1.UpdateOptions) (result *v1alpha1.VaultService, err error) {
 	result = &v1alpha1.VaultService{}
 	err = c.client.Put().
 		Namespace(c.ns).
 		Resource("vaultservices").
 		Name(vaultService.Name).
 		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
 		Body(vaultService).
-		Do().
+		Do(ctx).
 		Into(result)
 	return
 }
 
 // Delete takes name of the vaultService and deletes it. Returns an error if one occurs.
-func (c *vaultServices) Delete(name string, options *v1.DeleteOptions) error {
+func (c *vaultServices) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	return c.client.Delete().
 		Namespace(c.ns).
 		Resource("vaultservices").
 		Name(name).
-		Body(options).
-		Do().
+		Body(&opts).
+		Do(ctx).
 		Error()
 }
 
 // DeleteCollection deletes a collection of objects.
-func (c *vaultServices) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+func (c *vaultServices) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
 	return c.client.Delete().
 		Namespace(c.ns).
 		Resource("vaultservices").
-		VersionedParams(&listOptions, scheme.ParameterCodec).
-		Body(options).
-		Do().
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
 		Error()
 }
 
 // Patch applies the patch and returns the patched vaultService.
-func (c *vaultServices) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.VaultService, err error) {
+func (c *vaultServices) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.VaultService, err error) {
 	result = &v1alpha1.VaultService{}
 	err = c.client.Patch(pt).
 		Namespace(c.ns).
 		Resource("vaultservices").
-		SubResource(subresources...).
 		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
 		Body(data).
-		Do().
+		Do(ctx).
 		Into(result)
 	return
 }
@@ -12,12 +12,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// This file was automatically generated by informer-gen
+// Code generated by informer-gen. DO NOT EDIT.
 
 package v1alpha1
 
 import (
-	vault_v1alpha1 "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	"context"
+	time "time"
+
+	vaultv1alpha1 "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
 	versioned "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
 	internalinterfaces "github.com/nanosapp/vault-operator/pkg/generated/informers/externalversions/internalinterfaces"
 	v1alpha1 "github.com/nanosapp/vault-operator/pkg/generated/listers/vault/v1alpha1"
@@ -25,7 +28,6 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	watch "k8s.io/apimachinery/pkg/watch"
 	cache "k8s.io/client-go/tools/cache"
-	time "time"
 )
 
 // VaultServiceInformer provides access to a shared informer and lister for
@@ -36,34 +38,49 @@ type VaultServiceInformer interface {
 }
 
 type vaultServiceInformer struct {
-	factory internalinterfaces.SharedInformerFactory
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+	namespace        string
 }
 
 // NewVaultServiceInformer constructs a new informer for VaultService type.
 // Always prefer using an informer factory to get a shared informer instead of getting an independent
 // one. This reduces memory footprint and number of connections to the server.
 func NewVaultServiceInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredVaultServiceInformer(client, namespace, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredVaultServiceInformer constructs a new informer for VaultService type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredVaultServiceInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
 	return cache.NewSharedIndexInformer(
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
-				return client.VaultV1alpha1().VaultServices(namespace).List(options)
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.VaultV1alpha1().VaultServices(namespace).List(context.TODO(), options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
-				return client.VaultV1alpha1().VaultServices(namespace).Watch(options)
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.VaultV1alpha1().VaultServices(namespace).Watch(context.TODO(), options)
 			},
 		},
-		&vault_v1alpha1.VaultService{},
+		&vaultv1alpha1.VaultService{},
 		resyncPeriod,
 		indexers,
 	)
 }
 
-func defaultVaultServiceInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
-	return NewVaultServiceInformer(client, v1.NamespaceAll, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+func (f *vaultServiceInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredVaultServiceInformer(client, f.namespace, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
 }
 
 func (f *vaultServiceInformer) Informer() cache.SharedIndexInformer {
-	return f.factory.InformerFor(&vault_v1alpha1.VaultService{}, defaultVaultServiceInformer)
+	return f.factory.InformerFor(&vaultv1alpha1.VaultService{}, f.defaultInformer)
 }
 
 func (f *vaultServiceInformer) Lister() v1alpha1.VaultServiceLister {
@@ -0,0 +1,88 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	"context"
+	time "time"
+
+	vaultv1beta1 "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	versioned "github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
+	internalinterfaces "github.com/nanosapp/vault-operator/pkg/generated/informers/externalversions/internalinterfaces"
+	v1beta1 "github.com/nanosapp/vault-operator/pkg/generated/listers/vault/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// VaultServiceInformer provides access to a shared informer and lister for
+// VaultServices.
+type VaultServiceInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1beta1.VaultServiceLister
+}
+
+type vaultServiceInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+	namespace        string
+}
+
+// NewVaultServiceInformer constructs a new informer for VaultService type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewVaultServiceInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredVaultServiceInformer(client, namespace, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredVaultServiceInformer constructs a new informer for VaultService type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredVaultServiceInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.VaultV1beta1().VaultServices(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.VaultV1beta1().VaultServices(namespace).Watch(context.TODO(), options)
+			},
+		},
+		&vaultv1beta1.VaultService{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *vaultServiceInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredVaultServiceInformer(client, f.namespace, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *vaultServiceInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&vaultv1beta1.VaultService{}, f.defaultInformer)
+}
+
+func (f *vaultServiceInformer) Lister() v1beta1.VaultServiceLister {
+	return v1beta1.NewVaultServiceLister(f.Informer().GetIndexer())
+}
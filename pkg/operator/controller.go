@@ -17,46 +17,151 @@ package operator
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"time"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 	"github.com/nanosapp/vault-operator/pkg/util/probe"
 	"github.com/sirupsen/logrus"
 
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1"
+	"k8s.io/client-go/metadata/metadatainformer"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
-func (v *Vaults) run(ctx context.Context) {
-	source := cache.NewListWatchFromClient(
-		v.vaultsCRCli.VaultV1alpha1().RESTClient(),
-		api.VaultServicePlural,
-		v.namespace,
-		fields.Everything())
+// secretsResource is the resource of the secret metadata informers.
+var secretsResource = v1.SchemeGroupVersion.WithResource("secrets")
 
+func (v *Vaults) run(ctx context.Context) {
 	v.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "vault-operator")
-	v.indexer, v.informer = cache.NewIndexerInformer(source, &api.VaultService{}, 0, cache.ResourceEventHandlerFuncs{
-		AddFunc:    v.onAddVault,
-		UpdateFunc: v.onUpdateVault,
-		DeleteFunc: v.onDeleteVault,
-	}, cache.Indexers{})
-
 	defer v.queue.ShutDown()
 
-	logrus.Info("starting Vaults controller")
-	go v.informer.Run(ctx.Done())
+	var synced []cache.InformerSynced
+	for _, ns := range v.namespaces {
+		source := v.vaultListWatch(ctx, ns)
+
+		// The resync triggers the periodic health checks of the vault pods.
+		indexer, informer := cache.NewIndexerInformer(source, &api.VaultService{}, v.resyncPeriod, cache.ResourceEventHandlerFuncs{
+			AddFunc:    v.onAddVault,
+			UpdateFunc: v.onUpdateVault,
+			DeleteFunc: v.onDeleteVault,
+		}, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		v.indexers[ns] = indexer
+		v.informers = append(v.informers, informer)
+		synced = append(synced, informer.HasSynced)
+
+		podSource := v.podListWatch(ctx, ns)
+
+		podIndexer, podInformer := cache.NewIndexerInformer(podSource, &v1.Pod{}, 0, cache.ResourceEventHandlerFuncs{
+			AddFunc:    v.onAddPod,
+			UpdateFunc: v.onUpdatePod,
+			DeleteFunc: v.onDeletePod,
+		}, cache.Indexers{vaultIndex: vaultIndexFunc})
+		v.podIndexers[ns] = podIndexer
+		v.podInformers = append(v.podInformers, podInformer)
+		synced = append(synced, podInformer.HasSynced)
+
+		// The objects owned by the vaults are read from these caches during reconcile,
+		// and their changes requeue the owning vault.
+		factory := informers.NewSharedInformerFactoryWithOptions(v.kubecli, 0, informers.WithNamespace(ns))
+		ownedHandler := cache.ResourceEventHandlerFuncs{
+			AddFunc:    v.onAddOwned,
+			UpdateFunc: v.onUpdateOwned,
+			DeleteFunc: v.onDeleteOwned,
+		}
+		labeledFactory := informers.NewSharedInformerFactoryWithOptions(v.kubecli, 0, informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = k8sutil.VaultObjectsSelector
+			}))
+		for _, informer := range []cache.SharedIndexInformer{
+			factory.Apps().V1().Deployments().Informer(),
+			factory.Apps().V1().StatefulSets().Informer(),
+			factory.Core().V1().Services().Informer(),
+			labeledFactory.Core().V1().Secrets().Informer(),
+			labeledFactory.Core().V1().ConfigMaps().Informer(),
+			factory.Policy().V1().PodDisruptionBudgets().Informer(),
+			factory.Networking().V1().Ingresses().Informer(),
+			factory.Networking().V1().NetworkPolicies().Informer(),
+		} {
+			informer.AddEventHandler(ownedHandler)
+			synced = append(synced, informer.HasSynced)
+		}
+		v.kubeInformers[ns] = factory
+		v.labeledInformers[ns] = labeledFactory
+
+		// Only the metadata of the other secrets is cached, see getSecret.
+		metaFactory := metadatainformer.NewFilteredSharedInformerFactory(v.metadataCli, 0, ns, nil)
+		metaInformer := metaFactory.ForResource(secretsResource).Informer()
+		metaInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: v.onDeleteSecretMeta,
+		})
+		synced = append(synced, metaInformer.HasSynced)
+		v.secretMetaInformers[ns] = metaFactory
+	}
+
+	if v.namespaceSelector != nil {
+		source := &cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return v.kubecli.CoreV1().Namespaces().List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return v.kubecli.CoreV1().Namespaces().Watch(ctx, opts)
+			},
+		}
+
+		indexer, informer := cache.NewIndexerInformer(source, &v1.Namespace{}, 0, cache.ResourceEventHandlerFuncs{
+			AddFunc:    v.onAddNamespace,
+			UpdateFunc: v.onUpdateNamespace,
+		}, cache.Indexers{})
+		v.nsLister = corelisters.NewNamespaceLister(indexer)
+		v.nsInformer = informer
+		synced = append(synced, informer.HasSynced)
+	}
 
-	if !cache.WaitForCacheSync(ctx.Done(), v.informer.HasSynced) {
+	logrus.Infof("starting Vaults controller for namespaces %q", v.namespaces)
+	for _, informer := range v.informers {
+		go informer.Run(ctx.Done())
+	}
+	for _, informer := range v.podInformers {
+		go informer.Run(ctx.Done())
+	}
+	for _, factory := range v.kubeInformers {
+		factory.Start(ctx.Done())
+	}
+	for _, factory := range v.labeledInformers {
+		factory.Start(ctx.Done())
+	}
+	for _, factory := range v.secretMetaInformers {
+		factory.Start(ctx.Done())
+	}
+	if v.nsInformer != nil {
+		go v.nsInformer.Run(ctx.Done())
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
 		logrus.Error("Timed out waiting for caches to sync")
 		return
 	}
 
 	probe.SetReady()
 
-	const numWorkers = 1
-	for i := 0; i < numWorkers; i++ {
+	logrus.Infof("starting %d workers", v.workers)
+	for i := 0; i < v.workers; i++ {
 		go wait.Until(v.runWorker, time.Second, ctx.Done())
 	}
 
@@ -64,6 +169,184 @@ func (v *Vaults) run(ctx context.Context) {
 	logrus.Info("stopping Vaults controller")
 }
 
+// vaultListWatch lists and watches the vaults of the given namespace.
+// The typed clients are used instead of their REST clients so that the fake clientsets work.
+func (v *Vaults) vaultListWatch(ctx context.Context, namespace string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return v.vaultsCRCli.VaultV1beta1().VaultServices(namespace).List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return v.vaultsCRCli.VaultV1beta1().VaultServices(namespace).Watch(ctx, opts)
+		},
+	}
+}
+
+// podListWatch lists and watches the vault pods of the given namespace.
+func (v *Vaults) podListWatch(ctx context.Context, namespace string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = k8sutil.VaultPodsSelector
+			return v.kubecli.CoreV1().Pods(namespace).List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = k8sutil.VaultPodsSelector
+			return v.kubecli.CoreV1().Pods(namespace).Watch(ctx, opts)
+		},
+	}
+}
+
+// indexerFor returns the indexer holding the vaults of the given namespace.
+func (v *Vaults) indexerFor(namespace string) cache.Indexer {
+	if indexer, ok := v.indexers[namespace]; ok {
+		return indexer
+	}
+	return v.indexers[metav1.NamespaceAll]
+}
+
+// podIndexerFor returns the indexer holding the vault pods of the given namespace.
+func (v *Vaults) podIndexerFor(namespace string) cache.Indexer {
+	if indexer, ok := v.podIndexers[namespace]; ok {
+		return indexer
+	}
+	return v.podIndexers[metav1.NamespaceAll]
+}
+
+// kubeInformersFor returns the informer factory of the objects owned by the vaults of the given namespace.
+func (v *Vaults) kubeInformersFor(namespace string) informers.SharedInformerFactory {
+	if factory, ok := v.kubeInformers[namespace]; ok {
+		return factory
+	}
+	return v.kubeInformers[metav1.NamespaceAll]
+}
+
+// secretMetaInformersFor returns the informer factory of the secret metadata of the given namespace.
+func (v *Vaults) secretMetaInformersFor(namespace string) metadatainformer.SharedInformerFactory {
+	if factory, ok := v.secretMetaInformers[namespace]; ok {
+		return factory
+	}
+	return v.secretMetaInformers[metav1.NamespaceAll]
+}
+
+// labeledInformersFor returns the informer factory of the secrets and configmaps created for the vaults of the given namespace.
+func (v *Vaults) labeledInformersFor(namespace string) informers.SharedInformerFactory {
+	if factory, ok := v.labeledInformers[namespace]; ok {
+		return factory
+	}
+	return v.labeledInformers[metav1.NamespaceAll]
+}
+
+func (v *Vaults) deploymentLister(namespace string) appslisters.DeploymentNamespaceLister {
+	return v.kubeInformersFor(namespace).Apps().V1().Deployments().Lister().Deployments(namespace)
+}
+
+func (v *Vaults) statefulSetLister(namespace string) appslisters.StatefulSetNamespaceLister {
+	return v.kubeInformersFor(namespace).Apps().V1().StatefulSets().Lister().StatefulSets(namespace)
+}
+
+func (v *Vaults) serviceLister(namespace string) corelisters.ServiceNamespaceLister {
+	return v.kubeInformersFor(namespace).Core().V1().Services().Lister().Services(namespace)
+}
+
+// secretLister lists the secrets created by the operator, see getSecret for the secrets given by the user.
+func (v *Vaults) secretLister(namespace string) corelisters.SecretNamespaceLister {
+	return v.labeledInformersFor(namespace).Core().V1().Secrets().Lister().Secrets(namespace)
+}
+
+// configMapLister lists the configmaps created by the operator, see getConfigMap for the configmaps given by the user.
+func (v *Vaults) configMapLister(namespace string) corelisters.ConfigMapNamespaceLister {
+	return v.labeledInformersFor(namespace).Core().V1().ConfigMaps().Lister().ConfigMaps(namespace)
+}
+
+// secretMetaLister lists the metadata of all secrets, see getSecret.
+func (v *Vaults) secretMetaLister(namespace string) cache.GenericNamespaceLister {
+	return v.secretMetaInformersFor(namespace).ForResource(secretsResource).Lister().ByNamespace(namespace)
+}
+
+// getSecret returns a secret that is either created by the operator or given by the user.
+// The user's secrets are read from the apiserver, and kept until their resource version
+// in the metadata cache changes, so that they are not read on every reconcile.
+func (v *Vaults) getSecret(ctx context.Context, namespace, name string) (*v1.Secret, error) {
+	secret, err := v.secretLister(namespace).Get(name)
+	if !apierrors.IsNotFound(err) {
+		return secret, err
+	}
+
+	key := namespace + "/" + name
+	// A secret created moments ago may be missing from the metadata cache, it is kept once it is there.
+	var resourceVersion string
+	if obj, err := v.secretMetaLister(namespace).Get(name); err == nil {
+		resourceVersion = obj.(*metav1.PartialObjectMetadata).ResourceVersion
+		v.secretsMu.Lock()
+		secret = v.userSecrets[key]
+		v.secretsMu.Unlock()
+		if secret != nil && secret.ResourceVersion == resourceVersion {
+			return secret, nil
+		}
+	}
+
+	secret, err = v.kubecli.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if secret.ResourceVersion == resourceVersion {
+		v.secretsMu.Lock()
+		v.userSecrets[key] = secret
+		v.secretsMu.Unlock()
+	}
+	return secret, nil
+}
+
+// onDeleteSecretMeta drops a deleted secret given by the user from the secrets kept by getSecret.
+func (v *Vaults) onDeleteSecretMeta(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	v.secretsMu.Lock()
+	delete(v.userSecrets, key)
+	v.secretsMu.Unlock()
+}
+
+// getConfigMap returns a configmap that is either created by the operator or given by the user.
+// The user's configmaps are not cached, so they are read from the apiserver.
+func (v *Vaults) getConfigMap(ctx context.Context, namespace, name string) (*v1.ConfigMap, error) {
+	cm, err := v.configMapLister(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return v.kubecli.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	}
+	return cm, err
+}
+
+func (v *Vaults) pdbLister(namespace string) policylisters.PodDisruptionBudgetNamespaceLister {
+	return v.kubeInformersFor(namespace).Policy().V1().PodDisruptionBudgets().Lister().PodDisruptionBudgets(namespace)
+}
+
+func (v *Vaults) ingressLister(namespace string) networkinglisters.IngressNamespaceLister {
+	return v.kubeInformersFor(namespace).Networking().V1().Ingresses().Lister().Ingresses(namespace)
+}
+
+func (v *Vaults) networkPolicyLister(namespace string) networkinglisters.NetworkPolicyNamespaceLister {
+	return v.kubeInformersFor(namespace).Networking().V1().NetworkPolicies().Lister().NetworkPolicies(namespace)
+}
+
+// isWatched returns whether the vaults of the given namespace are managed by this operator.
+func (v *Vaults) isWatched(namespace string) bool {
+	if v.namespaceSelector == nil {
+		return true
+	}
+	ns, err := v.nsLister.Get(namespace)
+	if err != nil {
+		return false
+	}
+	return v.namespaceSelector.Matches(labels.Set(ns.Labels))
+}
+
+// vaultKey returns the namespace/name key of the vault cluster.
+func vaultKey(vr *api.VaultService) string {
+	return vr.Namespace + "/" + vr.Name
+}
+
 func (v *Vaults) onAddVault(obj interface{}) {
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -94,10 +377,7 @@ func (v *Vaults) onDeleteVault(obj interface{}) {
 		}
 	}
 
-	if cancel, ok := v.ctxCancels[vr.Name]; ok {
-		cancel()
-		delete(v.ctxCancels, vr.Name)
-	}
+	v.cancelVault(vaultKey(vr))
 
 	// IndexerInformer uses a delta queue, therefore for deletes we have to use this
 	// key function.
@@ -107,3 +387,140 @@ func (v *Vaults) onDeleteVault(obj interface{}) {
 	}
 	v.queue.Add(key)
 }
+
+// setCancel stores the cancel func of the in-flight health checks of the vault cluster with the given key.
+func (v *Vaults) setCancel(key string, cancel context.CancelFunc) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.ctxCancels[key] = cancel
+}
+
+// cancelVault cancels the in-flight health checks of the vault cluster with the given key.
+func (v *Vaults) cancelVault(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if cancel, ok := v.ctxCancels[key]; ok {
+		cancel()
+		delete(v.ctxCancels, key)
+	}
+}
+
+// vaultIndex indexes the vault pods by the namespace/name of their vault cluster.
+const vaultIndex = "vault"
+
+func vaultIndexFunc(obj interface{}) ([]string, error) {
+	p, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object in pod index: %#v", obj)
+	}
+	name, ok := p.Labels[k8sutil.VaultClusterLabel]
+	if !ok {
+		return nil, nil
+	}
+	return []string{p.Namespace + "/" + name}, nil
+}
+
+func (v *Vaults) onAddPod(obj interface{}) {
+	v.enqueuePodVault(obj.(*v1.Pod))
+}
+
+func (v *Vaults) onUpdatePod(oldObj, newObj interface{}) {
+	oldPod, newPod := oldObj.(*v1.Pod), newObj.(*v1.Pod)
+	if oldPod.ResourceVersion == newPod.ResourceVersion {
+		return
+	}
+	v.enqueuePodVault(newPod)
+}
+
+func (v *Vaults) onDeletePod(obj interface{}) {
+	p, ok := obj.(*v1.Pod)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			panic(fmt.Sprintf("unknown object from Pod delete event: %#v", obj))
+		}
+		p, ok = tombstone.Obj.(*v1.Pod)
+		if !ok {
+			panic(fmt.Sprintf("Tombstone contained object that is not a Pod: %#v", obj))
+		}
+	}
+	v.enqueuePodVault(p)
+}
+
+// enqueuePodVault adds the vault cluster of the pod to the work queue,
+// so that its status reflects the change of the pod.
+func (v *Vaults) enqueuePodVault(p *v1.Pod) {
+	if name, ok := p.Labels[k8sutil.VaultClusterLabel]; ok {
+		v.queue.Add(p.Namespace + "/" + name)
+	}
+}
+
+func (v *Vaults) onAddOwned(obj interface{}) {
+	v.enqueueOwner(obj)
+}
+
+func (v *Vaults) onUpdateOwned(oldObj, newObj interface{}) {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		panic(err)
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		panic(err)
+	}
+	if oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+		return
+	}
+	v.enqueueOwner(newObj)
+}
+
+func (v *Vaults) onDeleteOwned(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	v.enqueueOwner(obj)
+}
+
+// enqueueOwner adds the vault cluster controlling the object to the work queue,
+// so that the object is recreated or reverted if someone else deletes or changes it.
+func (v *Vaults) enqueueOwner(obj interface{}) {
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		logrus.Errorf("unknown object from owned object event: %#v", obj)
+		return
+	}
+	ref := metav1.GetControllerOf(o)
+	if ref == nil || ref.Kind != api.VaultServiceKind {
+		return
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != api.SchemeGroupVersion.Group {
+		return
+	}
+	v.queue.Add(o.GetNamespace() + "/" + ref.Name)
+}
+
+func (v *Vaults) onAddNamespace(obj interface{}) {
+	v.enqueueNamespace(obj.(*v1.Namespace).Name)
+}
+
+func (v *Vaults) onUpdateNamespace(oldObj, newObj interface{}) {
+	oldNs, newNs := oldObj.(*v1.Namespace), newObj.(*v1.Namespace)
+	if reflect.DeepEqual(oldNs.Labels, newNs.Labels) {
+		return
+	}
+	// The namespace may have started or stopped matching the namespace selector.
+	v.enqueueNamespace(newNs.Name)
+}
+
+// enqueueNamespace adds all vaults of the given namespace to the work queue.
+func (v *Vaults) enqueueNamespace(namespace string) {
+	objs, err := v.indexerFor(namespace).ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		logrus.Errorf("failed to list vaults in namespace (%s): %v", namespace, err)
+		return
+	}
+	for _, obj := range objs {
+		v.queue.Add(vaultKey(obj.(*api.VaultService)))
+	}
+}
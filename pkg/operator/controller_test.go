@@ -0,0 +1,92 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/metadata/metadatainformer"
+)
+
+func TestGetSecretKeepsUserSecrets(t *testing.T) {
+	ctx := context.TODO()
+	se := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "user-tls", Namespace: "default", ResourceVersion: "1"}}
+	kubecli := kubefake.NewSimpleClientset(se)
+	metaFactory := metadatainformer.NewSharedInformerFactory(metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()), 0)
+	metaIndexer := metaFactory.ForResource(secretsResource).Informer().GetIndexer()
+	v := &Vaults{
+		kubecli:             kubecli,
+		labeledInformers:    map[string]informers.SharedInformerFactory{metav1.NamespaceAll: informers.NewSharedInformerFactory(kubecli, 0)},
+		secretMetaInformers: map[string]metadatainformer.SharedInformerFactory{metav1.NamespaceAll: metaFactory},
+		userSecrets:         map[string]*v1.Secret{},
+	}
+	gets := func() int {
+		n := 0
+		for _, a := range kubecli.Actions() {
+			if a.GetVerb() == "get" && a.GetResource().Resource == "secrets" {
+				n++
+			}
+		}
+		return n
+	}
+	getSecret := func(wantGets int, wantVersion string) {
+		t.Helper()
+		got, err := v.getSecret(ctx, se.Namespace, se.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ResourceVersion != wantVersion {
+			t.Errorf("resource version = %s, want %s", got.ResourceVersion, wantVersion)
+		}
+		if n := gets(); n != wantGets {
+			t.Errorf("secret GETs = %d, want %d", n, wantGets)
+		}
+	}
+	setMeta := func(resourceVersion string) {
+		t.Helper()
+		meta := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: se.Name, Namespace: se.Namespace, ResourceVersion: resourceVersion}}
+		if err := metaIndexer.Update(meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The secret is read every time until it is in the metadata cache.
+	getSecret(1, "1")
+	getSecret(2, "1")
+	setMeta("1")
+	getSecret(3, "1")
+	getSecret(3, "1")
+
+	// A changed secret is read again.
+	updated := se.DeepCopy()
+	updated.ResourceVersion = "2"
+	if _, err := kubecli.CoreV1().Secrets(se.Namespace).Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	setMeta("2")
+	getSecret(4, "2")
+	getSecret(4, "2")
+
+	v.onDeleteSecretMeta(updated)
+	if len(v.userSecrets) != 0 {
+		t.Errorf("user secrets = %v, want none after the delete", v.userSecrets)
+	}
+}
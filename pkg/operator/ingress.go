@@ -0,0 +1,126 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	"github.com/sirupsen/logrus"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncIngress creates or updates the Ingress or TLSRoute of the vault cluster if spec.ingress is set,
+// and removes the one created before when spec.ingress is removed or its kind is changed.
+// TLSRoutes are skipped if the Gateway API CRDs are not installed.
+func (v *Vaults) syncIngress(ctx context.Context, vr *api.VaultService) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("sync ingress failed: %v", err)
+		}
+	}()
+
+	var kind api.IngressKind
+	if vr.Spec.Ingress != nil {
+		kind = vr.Spec.Ingress.Kind
+	}
+	if kind != api.IngressKindIngress {
+		err = v.deleteVaultIngress(ctx, vr)
+		if err != nil {
+			return err
+		}
+	}
+	if kind != api.IngressKindTLSRoute && vr.Status.IngressKind == api.IngressKindTLSRoute {
+		err = v.dynamicCli.Resource(k8sutil.TLSRouteResource).Namespace(vr.Namespace).Delete(ctx, vr.Name, metav1.DeleteOptions{})
+		if err == nil {
+			logrus.Infof("deleted the TLSRoute of vault (%s)", vaultKey(vr))
+		} else if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete TLSRoute (%s) failed: %v", vr.Name, err)
+		}
+	}
+	vr.Status.IngressKind = kind
+	if len(kind) == 0 {
+		return nil
+	}
+
+	if kind == api.IngressKindTLSRoute {
+		resources, err := k8sutil.GatewayResources(v.kubecli)
+		if err != nil {
+			return err
+		}
+		if !resources[k8sutil.TLSRouteResource.Resource] {
+			v.tlsRoutesSkipped.Do(func() {
+				logrus.Warningf("TLSRoutes are skipped since the Gateway API CRDs are not installed")
+			})
+			return nil
+		}
+		return v.createOrUpdateUnstructured(ctx, k8sutil.TLSRouteResource, k8sutil.NewVaultTLSRoute(vr))
+	}
+
+	ing := k8sutil.NewVaultIngress(vr)
+	old, err := v.ingressLister(vr.Namespace).Get(ing.Name)
+	if apierrors.IsNotFound(err) {
+		_, err = v.kubecli.NetworkingV1().Ingresses(vr.Namespace).Create(ctx, ing, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("create ingress (%s) failed: %v", ing.Name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if apiequality.Semantic.DeepEqual(old.Spec, ing.Spec) &&
+		apiequality.Semantic.DeepEqual(old.Labels, ing.Labels) &&
+		apiequality.Semantic.DeepEqual(old.Annotations, ing.Annotations) {
+		return nil
+	}
+	updated := old.DeepCopy()
+	updated.Labels = ing.Labels
+	updated.Annotations = ing.Annotations
+	updated.Spec = ing.Spec
+	_, err = v.kubecli.NetworkingV1().Ingresses(vr.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update ingress (%s) failed: %v", ing.Name, err)
+	}
+	return nil
+}
+
+// deleteVaultIngress deletes the Ingress of the vault cluster if the operator created one.
+func (v *Vaults) deleteVaultIngress(ctx context.Context, vr *api.VaultService) error {
+	ing, err := v.ingressLister(vr.Namespace).Get(vr.Name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ref := metav1.GetControllerOf(ing); ref == nil || ref.UID != vr.UID {
+		return nil
+	}
+	err = v.kubecli.NetworkingV1().Ingresses(vr.Namespace).Delete(ctx, ing.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &ing.UID},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete ingress (%s) failed: %v", ing.Name, err)
+	}
+	logrus.Infof("deleted the ingress of vault (%s)", vaultKey(vr))
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSyncIngressRemovesStale(t *testing.T) {
+	tests := []struct {
+		name string
+		// statusKind is the kind of the object synced before.
+		statusKind  api.IngressKind
+		otherOwner  bool
+		wantIngress bool
+		wantRoute   bool
+	}{{
+		name:       "ingress removed",
+		statusKind: api.IngressKindIngress,
+		wantRoute:  true,
+	}, {
+		name:        "ingress of the user kept",
+		statusKind:  api.IngressKindIngress,
+		otherOwner:  true,
+		wantIngress: true,
+		wantRoute:   true,
+	}, {
+		name:       "tlsroute removed",
+		statusKind: api.IngressKindTLSRoute,
+	}, {
+		// A TLSRoute that the operator did not record is not looked up on every sync.
+		name:      "unrecorded tlsroute kept",
+		wantRoute: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			vr := newTestVault("default", "example")
+			vr.Status.IngressKind = tt.statusKind
+			withIngress := vr.DeepCopy()
+			withIngress.Spec.Ingress = &api.IngressSpec{Host: "vault.example.com"}
+			withIngress.SetDefaults()
+
+			ing := k8sutil.NewVaultIngress(withIngress)
+			if tt.otherOwner {
+				ing.OwnerReferences = nil
+			}
+			kubecli := kubefake.NewSimpleClientset(ing)
+			factory := informers.NewSharedInformerFactory(kubecli, 0)
+			if err := factory.Networking().V1().Ingresses().Informer().GetIndexer().Add(ing); err != nil {
+				t.Fatal(err)
+			}
+			route := k8sutil.NewVaultTLSRoute(withIngress)
+			dynamicCli := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{k8sutil.TLSRouteResource: "TLSRouteList"}, route)
+			v := &Vaults{
+				kubecli:       kubecli,
+				dynamicCli:    dynamicCli,
+				kubeInformers: map[string]informers.SharedInformerFactory{metav1.NamespaceAll: factory},
+			}
+
+			if err := v.syncIngress(ctx, vr); err != nil {
+				t.Fatal(err)
+			}
+			if len(vr.Status.IngressKind) != 0 {
+				t.Errorf("status ingress kind = %q, want none", vr.Status.IngressKind)
+			}
+			_, err := kubecli.NetworkingV1().Ingresses(vr.Namespace).Get(ctx, ing.Name, metav1.GetOptions{})
+			if gotIngress := err == nil; gotIngress != tt.wantIngress {
+				t.Errorf("ingress exists = %v, want %v (%v)", gotIngress, tt.wantIngress, err)
+			}
+			_, err = dynamicCli.Resource(k8sutil.TLSRouteResource).Namespace(vr.Namespace).Get(ctx, route.GetName(), metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				t.Fatal(err)
+			}
+			if gotRoute := err == nil; gotRoute != tt.wantRoute {
+				t.Errorf("tlsroute exists = %v, want %v", gotRoute, tt.wantRoute)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/cronutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncMaintenance updates vr.Status.Maintenance from spec.maintenanceWindows.
+// The disruptive operations of the reconciliation check allowDisruption afterwards.
+func (v *Vaults) syncMaintenance(vr *api.VaultService) error {
+	if len(vr.Spec.MaintenanceWindows) == 0 {
+		vr.Status.Maintenance = nil
+		return nil
+	}
+	inWindow, next, err := maintenanceWindowAt(vr.Spec.MaintenanceWindows, time.Now())
+	if err != nil {
+		return fmt.Errorf("sync maintenance windows failed: %v", err)
+	}
+	m := &api.MaintenanceStatus{InWindow: inWindow}
+	if !next.IsZero() {
+		m.NextWindow = &metav1.Time{Time: next}
+	}
+	vr.Status.Maintenance = m
+	return nil
+}
+
+// allowDisruption returns whether the given disruptive operation may begin now, i.e. there are
+// no maintenance windows or one of them is open. Otherwise the operation is recorded as pending,
+// and vr is requeued for the start of the next window.
+func (v *Vaults) allowDisruption(vr *api.VaultService, op string) bool {
+	m := vr.Status.Maintenance
+	if m == nil || m.InWindow {
+		return true
+	}
+	m.PendingOperations = append(m.PendingOperations, op)
+	if m.NextWindow != nil {
+		v.queue.AddAfter(vaultKey(vr), time.Until(m.NextWindow.Time))
+	}
+	return false
+}
+
+// maintenanceWindowAt returns whether one of the maintenance windows is open at the given time,
+// and the next start of any of them after it.
+func maintenanceWindowAt(windows []api.MaintenanceWindow, t time.Time) (bool, time.Time, error) {
+	inWindow := false
+	var next time.Time
+	for _, w := range windows {
+		sched, err := cronutil.Parse(w.Schedule)
+		if err != nil {
+			return false, time.Time{}, err
+		}
+		d, err := time.ParseDuration(w.Duration)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid duration (%s): %v", w.Duration, err)
+		}
+		tz := w.TimeZone
+		if len(tz) == 0 {
+			tz = "UTC"
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid time zone (%s): %v", tz, err)
+		}
+
+		local := t.In(loc)
+		// The window is open if it started within its duration before t.
+		if start := sched.Next(local.Add(-d)); !start.IsZero() && !start.After(local) {
+			inWindow = true
+		}
+		if start := sched.Next(local); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return inWindow, next, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestMaintenanceWindowAt(t *testing.T) {
+	weekdayNights := api.MaintenanceWindow{Schedule: "0 22 * * 1-5", Duration: "6h"}
+	weekends := api.MaintenanceWindow{Schedule: "0 0 * * 6,0", Duration: "24h", TimeZone: "Europe/Berlin"}
+	date := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2019, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		windows  []api.MaintenanceWindow
+		t        time.Time
+		inWindow bool
+		next     time.Time
+		wantErr  bool
+	}{{
+		// 2019-03-04 is a Monday.
+		name:    "before the window",
+		windows: []api.MaintenanceWindow{weekdayNights},
+		t:       date(3, 4, 12, 0),
+		next:    date(3, 4, 22, 0),
+	}, {
+		name:     "at the start of the window",
+		windows:  []api.MaintenanceWindow{weekdayNights},
+		t:        date(3, 4, 22, 0),
+		inWindow: true,
+		next:     date(3, 5, 22, 0),
+	}, {
+		name:     "in the window after midnight",
+		windows:  []api.MaintenanceWindow{weekdayNights},
+		t:        date(3, 5, 3, 59),
+		inWindow: true,
+		next:     date(3, 5, 22, 0),
+	}, {
+		name:    "at the end of the window",
+		windows: []api.MaintenanceWindow{weekdayNights},
+		t:       date(3, 5, 4, 0),
+		next:    date(3, 5, 22, 0),
+	}, {
+		// Saturday 2019-03-09 00:00 in Berlin is Friday 23:00 UTC.
+		name:     "in the window of another time zone",
+		windows:  []api.MaintenanceWindow{weekends},
+		t:        date(3, 8, 23, 30),
+		inWindow: true,
+		next:     date(3, 9, 23, 0),
+	}, {
+		name:    "before the window of another time zone",
+		windows: []api.MaintenanceWindow{weekends},
+		t:       date(3, 8, 22, 30),
+		next:    date(3, 8, 23, 0),
+	}, {
+		name:     "any window open",
+		windows:  []api.MaintenanceWindow{weekends, weekdayNights},
+		t:        date(3, 8, 22, 30),
+		inWindow: true,
+		next:     date(3, 8, 23, 0),
+	}, {
+		name:    "earliest next window",
+		windows: []api.MaintenanceWindow{weekends, weekdayNights},
+		t:       date(3, 8, 12, 0),
+		next:    date(3, 8, 22, 0),
+	}, {
+		name:    "invalid schedule",
+		windows: []api.MaintenanceWindow{{Schedule: "0 22 * *", Duration: "1h"}},
+		wantErr: true,
+	}, {
+		name:    "invalid duration",
+		windows: []api.MaintenanceWindow{{Schedule: "0 22 * * *", Duration: "1 hour"}},
+		wantErr: true,
+	}, {
+		name:    "invalid time zone",
+		windows: []api.MaintenanceWindow{{Schedule: "0 22 * * *", Duration: "1h", TimeZone: "Mars/Olympus"}},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+				t.Skipf("time zone data not available: %v", err)
+			}
+			inWindow, next, err := maintenanceWindowAt(tt.windows, tt.t)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expect an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if inWindow != tt.inWindow {
+				t.Errorf("expect inWindow %v, got %v", tt.inWindow, inWindow)
+			}
+			if !next.Equal(tt.next) {
+				t.Errorf("expect next window at %v, got %v", tt.next, next)
+			}
+		})
+	}
+}
+
+func TestAllowDisruption(t *testing.T) {
+	v := &Vaults{queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test")}
+	defer v.queue.ShutDown()
+
+	vr := newTestVault("default", "example")
+	if !v.allowDisruption(vr, api.MaintenanceOperationUpgrade) {
+		t.Error("expect disruptions to be allowed without maintenance windows")
+	}
+
+	vr.Status.Maintenance = &api.MaintenanceStatus{InWindow: true}
+	if !v.allowDisruption(vr, api.MaintenanceOperationUpgrade) {
+		t.Error("expect disruptions to be allowed in a maintenance window")
+	}
+	if len(vr.Status.Maintenance.PendingOperations) != 0 {
+		t.Errorf("expect no pending operations, got %v", vr.Status.Maintenance.PendingOperations)
+	}
+
+	vr.Status.Maintenance = &api.MaintenanceStatus{
+		NextWindow: &metav1.Time{Time: time.Now().Add(50 * time.Millisecond)},
+	}
+	if v.allowDisruption(vr, api.MaintenanceOperationMigration) || v.allowDisruption(vr, api.MaintenanceOperationCertRotation) {
+		t.Error("expect disruptions to wait for the next maintenance window")
+	}
+	want := []string{api.MaintenanceOperationMigration, api.MaintenanceOperationCertRotation}
+	if got := vr.Status.Maintenance.PendingOperations; !reflect.DeepEqual(got, want) {
+		t.Errorf("expect pending operations %v, got %v", want, got)
+	}
+	// The vault is requeued for the start of the next window.
+	key, _ := v.queue.Get()
+	if key != vaultKey(vr) {
+		t.Errorf("expect vault (%s) to be requeued, got %v", vaultKey(vr), key)
+	}
+}
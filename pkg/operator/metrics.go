@@ -0,0 +1,261 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/tlsutil"
+	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const metricsNamespace = "vault_operator"
+
+// clusterLabels label the per cluster metrics.
+var clusterLabels = []string{"namespace", "name"}
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_total",
+		Help:      "Total number of reconciles per vault cluster.",
+	}, clusterLabels)
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Total number of failed reconciles per vault cluster.",
+	}, clusterLabels)
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of the reconciles per vault cluster.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, clusterLabels)
+
+	clusterActiveNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_active_nodes",
+		Help:      "Number of active vault nodes per vault cluster.",
+	}, clusterLabels)
+	clusterStandbyNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_standby_nodes",
+		Help:      "Number of standby vault nodes per vault cluster.",
+	}, clusterLabels)
+	clusterSealedNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_sealed_nodes",
+		Help:      "Number of sealed vault nodes per vault cluster.",
+	}, clusterLabels)
+	clusterInitialized = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_initialized",
+		Help:      "Whether the vault cluster is initialized (1) or not (0).",
+	}, clusterLabels)
+	certExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "tls_cert_expiry_timestamp_seconds",
+		Help:      "Expiry time of the TLS certificates of the vault cluster in seconds since epoch.",
+	}, append(clusterLabels, "cert"))
+	healthCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "health_check_duration_seconds",
+		Help:      "Latency of the health check requests to the vault pods.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, clusterLabels)
+
+	// clusterVecs are the metrics deleted together with their vault cluster.
+	clusterVecs = []interface {
+		DeleteLabelValues(...string) bool
+	}{
+		reconcileTotal,
+		reconcileErrors,
+		reconcileDuration,
+		clusterActiveNodes,
+		clusterStandbyNodes,
+		clusterSealedNodes,
+		clusterInitialized,
+		healthCheckDuration,
+	}
+)
+
+var (
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Current depth of the workqueue.",
+	}, []string{"queue"})
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Total number of adds handled by the workqueue.",
+	}, []string{"queue"})
+	// The workqueue reports its durations in seconds.
+	workqueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "queue_duration_seconds",
+		Help:      "How long an item stays in the workqueue before being requested.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"queue"})
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_seconds",
+		Help:      "How long processing an item from the workqueue takes.",
+		Buckets:   prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"queue"})
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "unfinished_work_seconds",
+		Help:      "How long the work in progress has been running.",
+	}, []string{"queue"})
+	workqueueLongestRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "longest_running_processor_seconds",
+		Help:      "How long the longest running processor of the workqueue has been running.",
+	}, []string{"queue"})
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Total number of retries handled by the workqueue.",
+	}, []string{"queue"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		reconcileTotal,
+		reconcileErrors,
+		reconcileDuration,
+		clusterActiveNodes,
+		clusterStandbyNodes,
+		clusterSealedNodes,
+		clusterInitialized,
+		certExpiry,
+		healthCheckDuration,
+		workqueueDepth,
+		workqueueAdds,
+		workqueueLatency,
+		workqueueWorkDuration,
+		workqueueUnfinishedWork,
+		workqueueLongestRunning,
+		workqueueRetries,
+	)
+	// The provider must be set before the workqueue is created.
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider exposes the metrics of the client-go workqueue to prometheus.
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunning.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+// observeReconcile records a reconcile of the vault cluster that started at the given time.
+func observeReconcile(namespace, name string, start time.Time, err error) {
+	reconcileTotal.WithLabelValues(namespace, name).Inc()
+	reconcileDuration.WithLabelValues(namespace, name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		reconcileErrors.WithLabelValues(namespace, name).Inc()
+	}
+}
+
+// recordClusterStatus records the node counts of the vault cluster from its status.
+func recordClusterStatus(vr *api.VaultService, s *api.VaultServiceStatus) {
+	active := 0.0
+	if len(s.VaultStatus.Active) != 0 {
+		active = 1
+	}
+	initialized := 0.0
+	if s.Initialized {
+		initialized = 1
+	}
+	clusterActiveNodes.WithLabelValues(vr.Namespace, vr.Name).Set(active)
+	clusterStandbyNodes.WithLabelValues(vr.Namespace, vr.Name).Set(float64(len(s.VaultStatus.Standby)))
+	clusterSealedNodes.WithLabelValues(vr.Namespace, vr.Name).Set(float64(len(s.VaultStatus.Sealed)))
+	clusterInitialized.WithLabelValues(vr.Namespace, vr.Name).Set(initialized)
+}
+
+// recordCertExpiry records the expiry time of the server certificate and
+// the CA certificate given to the clients of the vault cluster.
+func (v *Vaults) recordCertExpiry(ctx context.Context, vr *api.VaultService) error {
+	certs := []struct {
+		cert, secret, key string
+	}{
+		{"server", vr.Spec.TLS.Static.ServerSecret, vaultutil.ServerTLSCertName},
+		{"client-ca", vr.Spec.TLS.Static.ClientSecret, api.CATLSCertName},
+	}
+	for _, c := range certs {
+		secret, err := v.getSecret(ctx, vr.Namespace, c.secret)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get secret (%s): %v", c.secret, err)
+		}
+		cert, err := tlsutil.ParsePEMEncodedCACert(secret.Data[c.key])
+		if err != nil {
+			return fmt.Errorf("failed to parse %s of secret (%s): %v", c.key, c.secret, err)
+		}
+		certExpiry.WithLabelValues(vr.Namespace, vr.Name, c.cert).Set(float64(cert.NotAfter.Unix()))
+	}
+	return nil
+}
+
+// deleteClusterMetrics deletes the metrics of a deleted vault cluster.
+func deleteClusterMetrics(namespace, name string) {
+	for _, vec := range clusterVecs {
+		vec.DeleteLabelValues(namespace, name)
+	}
+	certExpiry.DeleteLabelValues(namespace, name, "server")
+	certExpiry.DeleteLabelValues(namespace, name, "client-ca")
+}
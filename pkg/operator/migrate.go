@@ -0,0 +1,49 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MigrateStorageVersion rewrites every VaultService in the watched namespaces
+// so that the apiserver persists it in the current storage version (v1beta1).
+// Afterwards v1alpha1 can be removed from the CRD's status.storedVersions.
+func (v *Vaults) MigrateStorageVersion(ctx context.Context) error {
+	for _, ns := range v.namespaces {
+		vrs, err := v.vaultsCRCli.VaultV1beta1().VaultServices(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("list vault services failed: %v", err)
+		}
+		for i := range vrs.Items {
+			vr := &vrs.Items[i]
+			_, err = v.vaultsCRCli.VaultV1beta1().VaultServices(vr.Namespace).Update(ctx, vr, metav1.UpdateOptions{})
+			// A concurrent write has already stored the object in the storage version.
+			if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("migrate vault service (%s) failed: %v", vaultKey(vr), err)
+			}
+			logrus.Infof("migrated vault service (%s) to the storage version", vaultKey(vr))
+		}
+	}
+	return nil
+}
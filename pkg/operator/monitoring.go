@@ -0,0 +1,111 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// syncMonitoring creates or updates the ServiceMonitor and PrometheusRule of the vault cluster
+// if spec.monitoring.serviceMonitor is set. They are skipped if the Prometheus Operator CRDs
+// are not installed. The ServiceMonitor is deleted once the telemetry is disabled.
+func (v *Vaults) syncMonitoring(ctx context.Context, vr *api.VaultService) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("sync monitoring failed: %v", err)
+		}
+	}()
+
+	if vr.Spec.Monitoring == nil || vr.Spec.Monitoring.ServiceMonitor == nil {
+		return nil
+	}
+
+	resources, err := k8sutil.MonitoringResources(v.kubecli)
+	if err != nil {
+		return err
+	}
+
+	if api.TelemetryTypeOf(&vr.Spec) == api.TelemetryDisabled {
+		if resources[k8sutil.ServiceMonitorResource.Resource] {
+			err = v.dynamicCli.Resource(k8sutil.ServiceMonitorResource).Namespace(vr.Namespace).Delete(ctx, vr.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("delete ServiceMonitor (%s) failed: %v", vr.Name, err)
+			}
+		}
+	} else {
+		if resources[k8sutil.ServiceMonitorResource.Resource] {
+			err = v.createOrUpdateUnstructured(ctx, k8sutil.ServiceMonitorResource, k8sutil.NewServiceMonitor(vr))
+			if err != nil {
+				return err
+			}
+		} else {
+			v.monitoringSkipped.Do(func() {
+				logrus.Warningf("ServiceMonitors are skipped since the Prometheus Operator CRDs are not installed")
+			})
+		}
+	}
+
+	if !vr.Spec.Monitoring.ServiceMonitor.DisableRules {
+		if resources[k8sutil.PrometheusRuleResource.Resource] {
+			err = v.createOrUpdateUnstructured(ctx, k8sutil.PrometheusRuleResource, k8sutil.NewPrometheusRule(vr))
+			if err != nil {
+				return err
+			}
+		} else {
+			v.rulesSkipped.Do(func() {
+				logrus.Warningf("PrometheusRules are skipped since the Prometheus Operator CRDs are not installed")
+			})
+		}
+	}
+	return nil
+}
+
+// createOrUpdateUnstructured creates the object, or updates its labels and spec if it exists.
+func (v *Vaults) createOrUpdateUnstructured(ctx context.Context, resource schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	ri := v.dynamicCli.Resource(resource).Namespace(obj.GetNamespace())
+	old, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = ri.Create(ctx, obj, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("create %s (%s) failed: %v", obj.GetKind(), obj.GetName(), err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %s (%s) failed: %v", obj.GetKind(), obj.GetName(), err)
+	}
+
+	if reflect.DeepEqual(old.Object["spec"], obj.Object["spec"]) && reflect.DeepEqual(old.GetLabels(), obj.GetLabels()) {
+		return nil
+	}
+	old.SetLabels(obj.GetLabels())
+	old.Object["spec"] = obj.Object["spec"]
+	_, err = ri.Update(ctx, old, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update %s (%s) failed: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	return nil
+}
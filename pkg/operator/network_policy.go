@@ -0,0 +1,94 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncNetworkPolicies creates or updates the NetworkPolicies of the vault and etcd pods
+// if spec.networkPolicy is set, and deletes them otherwise.
+func (v *Vaults) syncNetworkPolicies(ctx context.Context, vr *api.VaultService) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("sync network policies failed: %v", err)
+		}
+	}()
+
+	nps := v.kubecli.NetworkingV1().NetworkPolicies(vr.Namespace)
+	if vr.Spec.NetworkPolicy == nil {
+		for _, name := range []string{k8sutil.VaultNetworkPolicyName(vr.Name), k8sutil.EtcdNetworkPolicyName(vr.Name)} {
+			_, err = v.networkPolicyLister(vr.Namespace).Get(name)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			err = nps.Delete(ctx, name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("delete network policy (%s) failed: %v", name, err)
+			}
+		}
+		return nil
+	}
+
+	// A namespaced etcd operator runs in the namespace of its etcd clusters.
+	etcdOperatorNamespace := vr.Namespace
+	if v.etcdClusterWide {
+		etcdOperatorNamespace = ""
+	}
+	vaultOperator := k8sutil.OperatorPeer(v.operatorPodLabels, v.operatorNamespace, vr.Namespace)
+	etcdOperators := []networkingv1.NetworkPolicyPeer{k8sutil.OperatorPeer(v.etcdOperatorPodLabels, etcdOperatorNamespace, vr.Namespace)}
+	// The etcd backup operator takes the backups before the upgrades.
+	if us := vr.Spec.UpgradeStrategy; us != nil && us.Backup != nil {
+		etcdOperators = append(etcdOperators, k8sutil.OperatorPeer(v.etcdBackupOperatorPodLabels, etcdOperatorNamespace, vr.Namespace))
+	}
+
+	for _, np := range k8sutil.NewVaultNetworkPolicies(vr, vaultOperator, etcdOperators) {
+		old, err := v.networkPolicyLister(vr.Namespace).Get(np.Name)
+		if apierrors.IsNotFound(err) {
+			_, err = nps.Create(ctx, np, metav1.CreateOptions{})
+			if err != nil && !apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("create network policy (%s) failed: %v", np.Name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if apiequality.Semantic.DeepEqual(old.Spec, np.Spec) && apiequality.Semantic.DeepEqual(old.Labels, np.Labels) {
+			continue
+		}
+		updated := old.DeepCopy()
+		updated.Labels = np.Labels
+		updated.Spec = np.Spec
+		_, err = nps.Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("update network policy (%s) failed: %v", np.Name, err)
+		}
+	}
+	return nil
+}
@@ -16,43 +16,162 @@ package operator
 
 import (
 	"context"
-	"os"
+	"sync"
+	"time"
 
 	"github.com/nanosapp/vault-operator/pkg/client"
 	"github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 
-	etcdCRClientPkg "github.com/coreos/etcd-operator/pkg/client"
-	etcdCRClient "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
+// Config configures the vault operator.
+type Config struct {
+	// Namespace is the namespace the operator runs in.
+	// Only this namespace is watched unless ClusterWide or Namespaces is set.
+	Namespace string
+	// ClusterWide makes the operator watch VaultServices in all namespaces.
+	ClusterWide bool
+	// NamespaceSelector restricts the namespaces watched in the cluster-wide mode
+	// to those with matching labels. Nil selects all namespaces.
+	NamespaceSelector labels.Selector
+	// Namespaces is an explicit list of namespaces to watch.
+	Namespaces []string
+	// EtcdClusterWide annotates the etcd clusters so that they are
+	// managed by an etcd operator running in the cluster-wide mode.
+	EtcdClusterWide bool
+	// OperatorPodLabels, EtcdOperatorPodLabels and EtcdBackupOperatorPodLabels select the pods
+	// of the vault operator, of the etcd operator and of the etcd backup operator,
+	// which are allowed by the NetworkPolicies of spec.networkPolicy.
+	OperatorPodLabels           map[string]string
+	EtcdOperatorPodLabels       map[string]string
+	EtcdBackupOperatorPodLabels map[string]string
+
+	// ResyncPeriod is the period after which every vault cluster is reconciled
+	// and health checked again, even if nothing has changed.
+	ResyncPeriod time.Duration
+	// HealthCheckTimeout is the timeout of a health check request to a vault pod.
+	HealthCheckTimeout time.Duration
+	// Workers is the number of vault clusters reconciled in parallel.
+	Workers int
+}
+
 type Vaults struct {
-	namespace string
+	// namespaces are the namespaces to watch.
+	// It is []string{metav1.NamespaceAll} in the cluster-wide mode.
+	namespaces        []string
+	namespaceSelector labels.Selector
+	etcdClusterWide   bool
+
+	// operatorNamespace is the namespace the operator runs in.
+	operatorNamespace           string
+	operatorPodLabels           map[string]string
+	etcdOperatorPodLabels       map[string]string
+	etcdBackupOperatorPodLabels map[string]string
+
+	resyncPeriod       time.Duration
+	healthCheckTimeout time.Duration
+	workers            int
+
+	// mu guards ctxCancels, which is accessed by the informer event handlers and the workers.
+	mu sync.Mutex
 	// ctxCancels stores vault clusters' contexts that are used to
-	// cancel their goroutines when they are deleted
+	// cancel their in-flight health checks when they are deleted.
+	// It is keyed by the namespace/name of the vault cluster.
 	ctxCancels map[string]context.CancelFunc
 
 	// k8s workqueue pattern
-	indexer  cache.Indexer
-	informer cache.Controller
-	queue    workqueue.RateLimitingInterface
+	// There is one indexer and informer per watched namespace.
+	indexers  map[string]cache.Indexer
+	informers []cache.Controller
+	queue     workqueue.RateLimitingInterface
+
+	// podIndexers hold the vault pods of each watched namespace,
+	// indexed by the namespace/name of their vault cluster.
+	podIndexers  map[string]cache.Indexer
+	podInformers []cache.Controller
+
+	// kubeInformers hold the informers of the objects owned by the vaults,
+	// like deployments, services and secrets, one factory per watched namespace.
+	kubeInformers map[string]informers.SharedInformerFactory
+	// labeledInformers hold the secrets and configmaps created by the operator,
+	// selected by their labels so that the data of the other secrets of a namespace is not cached.
+	labeledInformers map[string]informers.SharedInformerFactory
+	// secretMetaInformers hold the metadata of the secrets, one factory per watched namespace,
+	// so that the secrets given by the users are only read again after they changed, see getSecret.
+	secretMetaInformers map[string]metadatainformer.SharedInformerFactory
+
+	// secretsMu guards userSecrets, the secrets given by the users keyed by their namespace/name.
+	secretsMu   sync.Mutex
+	userSecrets map[string]*v1.Secret
+
+	// nsLister lists the namespaces matched against namespaceSelector.
+	nsLister   corelisters.NamespaceLister
+	nsInformer cache.Controller
+
+	// monitoringSkipped and rulesSkipped log once that the Prometheus Operator CRDs are missing.
+	monitoringSkipped sync.Once
+	rulesSkipped      sync.Once
+	// tlsRoutesSkipped logs once that the Gateway API CRDs are missing.
+	tlsRoutesSkipped sync.Once
 
 	kubecli     kubernetes.Interface
 	vaultsCRCli versioned.Interface
-	etcdCRCli   etcdCRClient.Interface
+	// dynamicCli also manages the etcd operator objects.
+	dynamicCli  dynamic.Interface
+	metadataCli metadata.Interface
 }
 
 // New creates a vault operator.
-func New() *Vaults {
+func New(cfg Config) *Vaults {
+	return newVaults(cfg, k8sutil.MustNewKubeClient(), client.MustNewInCluster(), k8sutil.MustNewDynamicClient(), k8sutil.MustNewMetadataClient())
+}
+
+func newVaults(cfg Config, kubecli kubernetes.Interface, vaultsCRCli versioned.Interface, dynamicCli dynamic.Interface, metadataCli metadata.Interface) *Vaults {
+	namespaces := []string{cfg.Namespace}
+	switch {
+	case cfg.ClusterWide:
+		namespaces = []string{metav1.NamespaceAll}
+	case len(cfg.Namespaces) != 0:
+		namespaces = cfg.Namespaces
+	}
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
 	return &Vaults{
-		namespace:   os.Getenv("MY_POD_NAMESPACE"),
-		ctxCancels:  map[string]context.CancelFunc{},
-		kubecli:     k8sutil.MustNewKubeClient(),
-		vaultsCRCli: client.MustNewInCluster(),
-		etcdCRCli:   etcdCRClientPkg.MustNewInCluster(),
+		namespaces:                  namespaces,
+		namespaceSelector:           cfg.NamespaceSelector,
+		etcdClusterWide:             cfg.EtcdClusterWide,
+		operatorNamespace:           cfg.Namespace,
+		operatorPodLabels:           cfg.OperatorPodLabels,
+		etcdOperatorPodLabels:       cfg.EtcdOperatorPodLabels,
+		etcdBackupOperatorPodLabels: cfg.EtcdBackupOperatorPodLabels,
+		resyncPeriod:                cfg.ResyncPeriod,
+		healthCheckTimeout:          cfg.HealthCheckTimeout,
+		workers:                     workers,
+		ctxCancels:                  map[string]context.CancelFunc{},
+		indexers:                    map[string]cache.Indexer{},
+		podIndexers:                 map[string]cache.Indexer{},
+		kubeInformers:               map[string]informers.SharedInformerFactory{},
+		labeledInformers:            map[string]informers.SharedInformerFactory{},
+		secretMetaInformers:         map[string]metadatainformer.SharedInformerFactory{},
+		userSecrets:                 map[string]*v1.Secret{},
+		kubecli:                     kubecli,
+		vaultsCRCli:                 vaultsCRCli,
+		dynamicCli:                  dynamicCli,
+		metadataCli:                 metadataCli,
 	}
 }
 
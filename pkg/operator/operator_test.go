@@ -0,0 +1,182 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+// newTestVault returns a vault CR in the Running phase, so that the reconcile
+// skips the etcd cluster, which would never become ready with the fake clients.
+func newTestVault(namespace, name string) *api.VaultService {
+	return &api.VaultService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       types.UID(namespace + "-" + name),
+		},
+		Spec: api.VaultServiceSpec{
+			Nodes:   2,
+			Version: "0.9.1-0",
+		},
+		Status: api.VaultServiceStatus{
+			Phase: api.ClusterPhaseRunning,
+		},
+	}
+}
+
+func TestParallelReconcile(t *testing.T) {
+	namespaces := []string{"ns-1", "ns-2", "ns-3"}
+	names := []string{"example", "other"}
+
+	vaultsCRCli := fake.NewSimpleClientset()
+	for _, ns := range namespaces {
+		for _, name := range names {
+			if _, err := vaultsCRCli.VaultV1beta1().VaultServices(ns).Create(context.TODO(), newTestVault(ns, name), metav1.CreateOptions{}); err != nil {
+				t.Fatalf("failed to create vault (%s/%s): %v", ns, name, err)
+			}
+		}
+	}
+	kubecli := kubefake.NewSimpleClientset()
+
+	v := newVaults(Config{
+		ClusterWide:        true,
+		ResyncPeriod:       time.Minute,
+		HealthCheckTimeout: time.Second,
+		Workers:            4,
+	}, kubecli, vaultsCRCli, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		v.run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	err := wait.Poll(100*time.Millisecond, 30*time.Second, func() (bool, error) {
+		for _, ns := range namespaces {
+			for _, name := range names {
+				vr, err := vaultsCRCli.VaultV1beta1().VaultServices(ns).Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				if len(vr.Status.ServiceName) == 0 {
+					return false, nil
+				}
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to wait for the status of all vaults: %v", err)
+	}
+
+	for _, ns := range namespaces {
+		for _, name := range names {
+			vr, err := vaultsCRCli.VaultV1beta1().VaultServices(ns).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vr.Status.ServiceName != name {
+				t.Errorf("vault (%s/%s): expected service name %q, got %q", ns, name, name, vr.Status.ServiceName)
+			}
+			if want := fmt.Sprintf("app=vault,vault_cluster=%s", name); vr.Status.Selector != want {
+				t.Errorf("vault (%s/%s): expected selector %q, got %q", ns, name, want, vr.Status.Selector)
+			}
+
+			d, err := kubecli.AppsV1().Deployments(ns).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("vault (%s/%s): failed to get deployment: %v", ns, name, err)
+			}
+			if err = checkOwner(d.OwnerReferences, vr); err != nil {
+				t.Errorf("vault (%s/%s): deployment: %v", ns, name, err)
+			}
+			if *d.Spec.Replicas != vr.Spec.Nodes {
+				t.Errorf("vault (%s/%s): expected %d replicas, got %d", ns, name, vr.Spec.Nodes, *d.Spec.Replicas)
+			}
+
+			svc, err := kubecli.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("vault (%s/%s): failed to get service: %v", ns, name, err)
+			}
+			if err = checkOwner(svc.OwnerReferences, vr); err != nil {
+				t.Errorf("vault (%s/%s): service: %v", ns, name, err)
+			}
+		}
+	}
+}
+
+func checkOwner(refs []metav1.OwnerReference, vr *api.VaultService) error {
+	if len(refs) != 1 || refs[0].UID != vr.UID {
+		return fmt.Errorf("expected to be owned by %s, got %v", vr.UID, refs)
+	}
+	return nil
+}
+
+func TestConcurrentCancel(t *testing.T) {
+	v := newVaults(Config{}, kubefake.NewSimpleClientset(), fake.NewSimpleClientset(), dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()))
+
+	const n = 50
+	ctxs := make([]context.Context, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		// The workqueue never hands the same key to two workers at once.
+		key := fmt.Sprintf("ns/vault-%d", i)
+		var cancel context.CancelFunc
+		ctxs[i], cancel = context.WithCancel(context.Background())
+
+		wg.Add(2)
+		// Like a worker reconciling the vault.
+		go func(key string, cancel context.CancelFunc) {
+			defer wg.Done()
+			v.setCancel(key, cancel)
+			v.cancelVault(key)
+		}(key, cancel)
+		// Like the informer handling the deletion of the vault.
+		go func(key string) {
+			defer wg.Done()
+			v.cancelVault(key)
+		}(key)
+	}
+	wg.Wait()
+
+	if len(v.ctxCancels) != 0 {
+		t.Errorf("expected no cancel funcs left, got %d", len(v.ctxCancels))
+	}
+	for i, ctx := range ctxs {
+		if ctx.Err() == nil {
+			t.Errorf("context %d was not cancelled", i)
+		}
+	}
+}
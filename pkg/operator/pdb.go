@@ -0,0 +1,77 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncPodDisruptionBudget keeps at least one unsealed node of an HA vault cluster
+// available during voluntary disruptions, e.g. node drains.
+// The PodDisruptionBudget is deleted once the cluster is scaled down to a single node,
+// since it would block evicting that node forever.
+func (v *Vaults) syncPodDisruptionBudget(ctx context.Context, vr *api.VaultService) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("sync pod disruption budget failed: %v", err)
+		}
+	}()
+
+	pdbs := v.kubecli.PolicyV1().PodDisruptionBudgets(vr.Namespace)
+	old, err := v.pdbLister(vr.Namespace).Get(vr.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	if vr.Spec.Nodes <= 1 {
+		if !exists {
+			return nil
+		}
+		err = pdbs.Delete(ctx, vr.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete pod disruption budget (%s) failed: %v", vr.Name, err)
+		}
+		return nil
+	}
+
+	pdb := k8sutil.NewVaultPodDisruptionBudget(vr)
+	if !exists {
+		_, err = pdbs.Create(ctx, pdb, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("create pod disruption budget (%s) failed: %v", vr.Name, err)
+		}
+		return nil
+	}
+
+	if reflect.DeepEqual(old.Spec, pdb.Spec) {
+		return nil
+	}
+	updated := old.DeepCopy()
+	updated.Spec = pdb.Spec
+	_, err = pdbs.Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update pod disruption budget (%s) failed: %v", vr.Name, err)
+	}
+	return nil
+}
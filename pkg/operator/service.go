@@ -0,0 +1,168 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// syncServices creates the missing services of the vault cluster,
+// and updates the existing ones to spec.service.
+// Annotations added by others, e.g. cloud controllers, are kept.
+func (v *Vaults) syncServices(ctx context.Context, vr *api.VaultService) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("sync services failed: %v", err)
+		}
+	}()
+
+	for _, svc := range k8sutil.NewVaultServices(vr) {
+		old, err := v.serviceLister(vr.Namespace).Get(svc.Name)
+		if apierrors.IsNotFound(err) {
+			_, err = v.kubecli.CoreV1().Services(vr.Namespace).Create(ctx, svc, metav1.CreateOptions{})
+			if err != nil && !apierrors.IsAlreadyExists(err) {
+				return fmt.Errorf("create service (%s) failed: %v", svc.Name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		updated := old.DeepCopy()
+		updateService(updated, svc)
+		if apiequality.Semantic.DeepEqual(old, updated) {
+			continue
+		}
+		_, err = v.kubecli.CoreV1().Services(vr.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("update service (%s) failed: %v", svc.Name, err)
+		}
+	}
+	return nil
+}
+
+// updateService updates the labels, annotations and spec of svc to the desired service.
+// The fields allocated by the API server, like the cluster IP, are kept.
+func updateService(svc, desired *v1.Service) {
+	if svc.Labels == nil {
+		svc.Labels = map[string]string{}
+	}
+	for k, val := range desired.Labels {
+		svc.Labels[k] = val
+	}
+	if svc.Annotations == nil && len(desired.Annotations) != 0 {
+		svc.Annotations = map[string]string{}
+	}
+	for k, val := range desired.Annotations {
+		svc.Annotations[k] = val
+	}
+
+	// The node ports are kept as long as the service type allocates them.
+	nodePorts := map[string]int32{}
+	if desired.Spec.Type == v1.ServiceTypeNodePort || desired.Spec.Type == v1.ServiceTypeLoadBalancer {
+		for _, p := range svc.Spec.Ports {
+			nodePorts[p.Name] = p.NodePort
+		}
+	}
+	ports := make([]v1.ServicePort, 0, len(desired.Spec.Ports))
+	for _, p := range desired.Spec.Ports {
+		p.NodePort = nodePorts[p.Name]
+		if p.TargetPort.IntValue() == 0 && len(p.TargetPort.StrVal) == 0 {
+			// The API server defaults the target port to the port.
+			for _, op := range svc.Spec.Ports {
+				if op.Name == p.Name {
+					p.TargetPort = op.TargetPort
+				}
+			}
+		}
+		ports = append(ports, p)
+	}
+
+	svc.Spec.Type = desired.Spec.Type
+	svc.Spec.Selector = desired.Spec.Selector
+	svc.Spec.Ports = ports
+	svc.Spec.LoadBalancerSourceRanges = desired.Spec.LoadBalancerSourceRanges
+	svc.Spec.ExternalTrafficPolicy = desired.Spec.ExternalTrafficPolicy
+	if svc.Spec.ExternalTrafficPolicy != v1.ServiceExternalTrafficPolicyTypeLocal {
+		svc.Spec.HealthCheckNodePort = 0
+	}
+}
+
+// podRole returns the role of a vault pod from its health info.
+func podRole(hr *vaultapi.HealthResponse) string {
+	switch {
+	case !hr.Initialized || hr.Sealed:
+		return ""
+	case hr.Standby:
+		return k8sutil.VaultRoleStandby
+	default:
+		return k8sutil.VaultRoleActive
+	}
+}
+
+// updatePodRoles sets the vault role label of the pods from their health info,
+// which selects them into the "-active" and "-standby" services.
+// Pods whose health check failed keep their label, since they are not ready anyway.
+// The label of the former active pod is changed first, so that the "-active" service
+// never points to two vault nodes at once.
+func (v *Vaults) updatePodRoles(ctx context.Context, health []podHealth) error {
+	var changes []podHealth
+	for _, ph := range health {
+		if ph.err != nil {
+			continue
+		}
+		if ph.pod.Labels[k8sutil.VaultRoleLabel] != podRole(ph.hr) {
+			changes = append(changes, ph)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return podRole(changes[i].hr) != k8sutil.VaultRoleActive && podRole(changes[j].hr) == k8sutil.VaultRoleActive
+	})
+
+	for _, ph := range changes {
+		// A null label value removes the label.
+		var role interface{}
+		if r := podRole(ph.hr); len(r) != 0 {
+			role = r
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": map[string]interface{}{k8sutil.VaultRoleLabel: role},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = v.kubecli.CoreV1().Pods(ph.pod.Namespace).Patch(ctx, ph.pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to label the role of the vault pod (%s/%s): %v", ph.pod.Namespace, ph.pod.Name, err)
+		}
+	}
+	return nil
+}
@@ -18,17 +18,18 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
-	"reflect"
+	"time"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
 
 	"github.com/sirupsen/logrus"
-	appsv1beta1 "k8s.io/api/apps/v1beta1"
 	"k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -98,177 +99,263 @@ func (v *Vaults) syncVault(key string) (err error) {
 		}
 	}()
 
-	obj, exists, err := v.indexer.GetByKey(key)
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	obj, exists, err := v.indexerFor(namespace).GetByKey(key)
 	if err != nil {
 		return err
 	}
 	if !exists {
 		logrus.Infof("Vault CR (%s) is deleted", key)
+		deleteClusterMetrics(namespace, name)
+		return nil
+	}
+	if !v.isWatched(namespace) {
+		// The namespace does not match the namespace selector (anymore).
 		return nil
 	}
 
 	vr := obj.(*api.VaultService).DeepCopy()
+	start := time.Now()
+	defer func() {
+		observeReconcile(vr.Namespace, vr.Name, start, err)
+	}()
 
-	// Simulate initializer.
-	// TODO: remove this when we have initializers for Vault CR.
+	// The client calls, step-downs and health checks are cancelled if the vault cluster is deleted meanwhile.
+	ctx, cancel := context.WithCancel(context.Background())
+	v.setCancel(vaultKey(vr), cancel)
+	defer v.cancelVault(vaultKey(vr))
+
+	// Defaults are normally applied by the mutating admission webhook.
+	// Keep applying them here for clusters where the webhook is not registered.
 	changed := vr.SetDefaults()
 	if changed {
-		vr, err = v.vaultsCRCli.VaultV1alpha1().VaultServices(vr.Namespace).Update(vr)
+		vr, err = v.vaultsCRCli.VaultV1beta1().VaultServices(vr.Namespace).Update(ctx, vr, metav1.UpdateOptions{})
 		if err != nil {
 			return err
 		}
 	}
 
-	return v.reconcileVault(vr)
+	return v.reconcileVault(ctx, vr)
 }
 
 // reconcileVault reconciles the vault cluster's state to the spec specified by vr
 // by preparing the TLS secrets, deploying the etcd and vault cluster,
-// and finally updating the vault deployment if needed.
-func (v *Vaults) reconcileVault(vr *api.VaultService) (err error) {
+// updating the vault deployment or statefulset if needed, and finally updating the status
+// from the health of the vault pods.
+func (v *Vaults) reconcileVault(ctx context.Context, vr *api.VaultService) (err error) {
+	// vr.Status is changed by the sync steps, and written at last by syncVaultStatus.
+	oldStatus := vr.Status.DeepCopy()
+
+	// The maintenance windows are synced first, since every disruptive step below checks allowDisruption.
+	err = v.syncMaintenance(vr)
+	if err != nil {
+		return err
+	}
+
 	// After first time reconcile, phase will switch to "Running".
 	if vr.Status.Phase == api.ClusterPhaseInitial {
-		err = v.prepareEtcdTLSSecrets(vr)
+		err = v.prepareEtcdTLSSecrets(ctx, vr)
 		if err != nil {
 			return err
 		}
 		// etcd cluster should only be created in first time reconcile.
-		err = k8sutil.DeployEtcdCluster(v.etcdCRCli, vr)
+		err = k8sutil.DeployEtcdCluster(ctx, v.dynamicCli, vr, v.etcdClusterWide)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = v.prepareDefaultVaultTLSSecrets(vr)
+	certHash, err := v.prepareDefaultVaultTLSSecrets(ctx, vr)
 	if err != nil {
 		return err
 	}
+	if err = v.recordCertExpiry(ctx, vr); err != nil {
+		logrus.Warningf("failed to record the TLS certificate expiry of vault (%s): %v", vaultKey(vr), err)
+	}
 
-	err = v.prepareVaultConfig(vr)
+	configHash, err := v.prepareVaultConfig(ctx, vr)
 	if err != nil {
+		// The ConfigValid condition is written right away, since the reconcile stops here until the config is fixed.
+		if !apiequality.Semantic.DeepEqual(*oldStatus, vr.Status) {
+			if _, serr := v.updateVaultCRStatus(ctx, vr.Name, vr.Namespace, vr.Status); serr != nil {
+				logrus.Warningf("failed to update the status of vault (%s): %v", vaultKey(vr), serr)
+			}
+		}
 		return err
 	}
+	if len(certHash) != 0 {
+		// The vault nodes load the server certificate at start, so a reissued certificate is rolled out like a changed config.
+		configHash = k8sutil.VaultConfigHash(configHash + certHash)
+	}
 
-	// TODO: we should do
-	// if ! deployment exists -> then create deployment
-	// else -> check size, version skew
-	// If ! service exists -> then create service
-	err = k8sutil.DeployVault(v.kubecli, vr)
+	// The deployment or statefulset and the services are (re)created if they are missing from the caches.
+	// Their creation requeues vr through the informers, so the rest of the reconcile is done then.
+	w, err := v.getWorkload(ctx, vr, configHash)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		return k8sutil.DeployVault(ctx, v.kubecli, vr, configHash)
+	}
+	err = v.syncServices(ctx, vr)
 	if err != nil {
 		return err
 	}
 
-	// TODO: make use of deployment informer
-	d, err := v.kubecli.AppsV1beta1().Deployments(vr.Namespace).Get(vr.Name, metav1.GetOptions{})
+	err = v.scaleWorkload(ctx, vr, w)
 	if err != nil {
 		return err
 	}
 
-	if *d.Spec.Replicas != vr.Spec.Nodes {
-		d.Spec.Replicas = &(vr.Spec.Nodes)
-		_, err = v.kubecli.AppsV1beta1().Deployments(vr.Namespace).Update(d)
-		if err != nil {
-			return fmt.Errorf("failed to update size of deployment (%s): %v", d.Name, err)
-		}
+	err = v.syncNetworkPolicies(ctx, vr)
+	if err != nil {
+		return err
+	}
+
+	err = v.syncIngress(ctx, vr)
+	if err != nil {
+		return err
 	}
 
-	err = v.syncUpgrade(vr, d)
+	err = v.syncPodDisruptionBudget(ctx, vr)
 	if err != nil {
 		return err
 	}
 
-	if _, ok := v.ctxCancels[vr.Name]; !ok {
-		ctx, cancel := context.WithCancel(context.Background())
-		v.ctxCancels[vr.Name] = cancel
-		go v.monitorAndUpdateStatus(ctx, vr)
+	// Upgrades wait until a migration to a statefulset is done.
+	if !w.migrating {
+		err = v.syncUpgrade(ctx, vr, w)
+		if err != nil {
+			return err
+		}
+		err = v.syncPodTemplate(ctx, vr, w, configHash)
+		if err != nil {
+			return err
+		}
+		err = v.syncStatefulSetPods(ctx, vr, w)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = v.syncMonitoring(ctx, vr)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return v.syncVaultStatus(ctx, vr, oldStatus)
 }
 
-// prepareVaultConfig applies our section into Vault config file.
-// - If given user configmap, appends into user provided vault config
+// prepareVaultConfig merges our sections into the Vault config file, see newVaultConfig,
+// and returns the hash of the merged config, see k8sutil.VaultConfigHash.
+// - If given user configmap, merges it into user provided vault config
 //   and creates another configmap "${configMapName}-copy" for it.
 // - Otherwise, creates a new configmap "${vaultName}-copy" with our section.
-func (v *Vaults) prepareVaultConfig(vr *api.VaultService) error {
-	// TODO: What if user initially didn't give ConfigMapName but then update it later?
+// The config is merged on every sync, and the copy is updated when it changed.
+// The vault nodes are rolled out to the changed config by syncPodTemplate.
+func (v *Vaults) prepareVaultConfig(ctx context.Context, vr *api.VaultService) (string, error) {
+	name := k8sutil.ConfigMapNameForVault(vr)
+	old, err := v.configMapLister(vr.Namespace).Get(name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("prepare vault config error: get configmap (%s) failed: %v", name, err)
+	}
+	if err != nil {
+		old = nil
+	}
 
-	var cfgData string
+	var userData string
 	if len(vr.Spec.ConfigMapName) != 0 {
-		cm, err := v.kubecli.CoreV1().ConfigMaps(vr.Namespace).Get(vr.Spec.ConfigMapName, metav1.GetOptions{})
+		cm, err := v.getConfigMap(ctx, vr.Namespace, vr.Spec.ConfigMapName)
+		if err != nil {
+			return "", fmt.Errorf("prepare vault config error: get configmap (%s) failed: %v", vr.Spec.ConfigMapName, err)
+		}
+		userData = cm.Data[filepath.Base(k8sutil.VaultConfigPath)]
+	}
+	cfgData, err := newVaultConfig(vr, userData)
+	if err != nil {
+		setConfigCondition(vr, v1.ConditionFalse, api.ConfigReasonParseError, err.Error())
+		return "", fmt.Errorf("prepare vault config error: %v", err)
+	}
+	setConfigCondition(vr, v1.ConditionTrue, api.ConfigReasonMerged, "")
+
+	key := filepath.Base(k8sutil.VaultConfigPath)
+	hash := k8sutil.VaultConfigHash(cfgData)
+	if old != nil {
+		if old.Data[key] == cfgData {
+			return hash, nil
+		}
+		updated := old.DeepCopy()
+		updated.Data = map[string]string{key: cfgData}
+		_, err = v.kubecli.CoreV1().ConfigMaps(vr.Namespace).Update(ctx, updated, metav1.UpdateOptions{})
 		if err != nil {
-			return fmt.Errorf("prepare vault config error: get configmap (%s) failed: %v", vr.Spec.ConfigMapName, err)
+			return "", fmt.Errorf("prepare vault config error: update configmap (%s) failed: %v", name, err)
 		}
-		cfgData = cm.Data[filepath.Base(k8sutil.VaultConfigPath)]
+		logrus.Infof("updated the vault config of vault (%s)", vaultKey(vr))
+		return hash, nil
 	}
-	cfgData = vaultutil.NewConfigWithDefaultParams(cfgData)
-	cfgData = vaultutil.NewConfigWithEtcd(cfgData, k8sutil.EtcdURLForVault(vr.Name))
 
 	cm := &v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   k8sutil.ConfigMapNameForVault(vr),
+			Name:   name,
 			Labels: k8sutil.LabelsForVault(vr.Name),
 		},
 		Data: map[string]string{
-			filepath.Base(k8sutil.VaultConfigPath): cfgData,
+			key: cfgData,
 		},
 	}
 
 	k8sutil.AddOwnerRefToObject(cm, k8sutil.AsOwner(vr))
-	_, err := v.kubecli.CoreV1().ConfigMaps(vr.Namespace).Create(cm)
+	_, err = v.kubecli.CoreV1().ConfigMaps(vr.Namespace).Create(ctx, cm, metav1.CreateOptions{})
 	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return fmt.Errorf("prepare vault config error: create new configmap (%s) failed: %v", cm.Name, err)
+		return "", fmt.Errorf("prepare vault config error: create new configmap (%s) failed: %v", cm.Name, err)
 	}
 
-	return nil
+	return hash, nil
 }
 
-func (v *Vaults) syncUpgrade(vr *api.VaultService, d *appsv1beta1.Deployment) (err error) {
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("syncUpgrade failed: %v", err)
-		}
-	}()
-
-	// If the deployment version hasn't been updated, roll forward the deployment version
-	// but keep the existing active Vault node alive though.
-	if !k8sutil.IsVaultVersionMatch(d.Spec.Template.Spec, vr.Spec) {
-		err = k8sutil.UpgradeDeployment(v.kubecli, vr, d)
-		if err != nil {
-			return err
-		}
+// newVaultConfig merges the settings of spec.config and the sections of the operator
+// into the user config data.
+func newVaultConfig(vr *api.VaultService, userData string) (string, error) {
+	cfg, err := vaultutil.ParseConfig(userData)
+	if err != nil {
+		return "", err
 	}
-
-	// If there is one active node belonging to the old version, and all other nodes are
-	// standby and uptodate, then trigger step-down on active node.
-	// It maps to the following conditions on Status:
-	// 1. check standby == updated
-	// 2. check Available - Updated == Active
-	readyToTriggerStepdown := func() bool {
-		if len(vr.Status.VaultStatus.Active) == 0 {
-			return false
-		}
-
-		if !reflect.DeepEqual(vr.Status.VaultStatus.Standby, vr.Status.UpdatedNodes) {
-			return false
-		}
-
-		ava := append(vr.Status.VaultStatus.Standby, vr.Status.VaultStatus.Sealed...)
-		if !reflect.DeepEqual(ava, vr.Status.UpdatedNodes) {
-			return false
-		}
-		return true
-	}()
-
-	if readyToTriggerStepdown {
-		// This will send SIGTERM to the active Vault pod. It should release HA lock and exit properly.
-		// If it failed for some reason, kubelet will send SIGKILL after default grace period (30s) eventually.
-		// It take longer but the the lock will get released eventually on failure case.
-		err = v.kubecli.CoreV1().Pods(vr.Namespace).Delete(vr.Status.VaultStatus.Active, nil)
-		if err != nil && !apierrors.IsNotFound(err) {
-			return fmt.Errorf("step down: failed to delete active Vault pod (%s): %v", vr.Status.VaultStatus.Active, err)
+	telemetry := vr.Spec.Telemetry
+	unauthenticatedMetrics := api.TelemetryTypeOf(&vr.Spec) == api.TelemetryPrometheus &&
+		telemetry.Prometheus != nil && telemetry.Prometheus.UnauthenticatedMetricsAccess
+	// The settings of the user config take precedence over spec.config.
+	cfg.SetServerConfig(vr.Spec.Config)
+	cfg.SetDefaultParams(unauthenticatedMetrics)
+	switch api.TelemetryTypeOf(&vr.Spec) {
+	case api.TelemetryStatsd:
+		cfg.SetStatsdTelemetry(k8sutil.StatsdExporterAddr)
+	case api.TelemetryPrometheus:
+		var retentionTime string
+		if telemetry.Prometheus != nil {
+			retentionTime = telemetry.Prometheus.RetentionTime
 		}
+		cfg.SetPrometheusTelemetry(retentionTime)
+	}
+	cfg.SetEtcdStorage(k8sutil.EtcdURLForVault(vr.Name))
+	if vr.Spec.Seal != nil {
+		cfg.SetSeal(vr.Spec.Seal.Type, vr.Spec.Seal.Config)
 	}
+	if replaced := cfg.Replaced(); len(replaced) != 0 {
+		logrus.Infof("the %v sections of the vault config of vault (%s) are replaced by the operator", replaced, vaultKey(vr))
+	}
+	return cfg.Render()
+}
 
-	return nil
+// setConfigCondition sets the ConfigValid condition of vr.
+func setConfigCondition(vr *api.VaultService, status v1.ConditionStatus, reason, message string) {
+	vr.Status.SetCondition(api.VaultServiceCondition{
+		Type:               api.VaultServiceConditionConfigValid,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
 }
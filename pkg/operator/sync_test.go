@@ -0,0 +1,118 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
+)
+
+func TestNewVaultConfig(t *testing.T) {
+	ui := false
+	tests := []struct {
+		name     string
+		modify   func(vr *api.VaultService)
+		userData string
+		want     []string
+		notWant  []string
+	}{{
+		name: "defaults",
+		want: []string{
+			"ui = true",
+			`statsd_address = "localhost:9125"`,
+			`address       = "https://example-etcd-client:2379"`,
+		},
+		notWant: []string{"seal", "log_level"},
+	}, {
+		name: "spec.config",
+		modify: func(vr *api.VaultService) {
+			vr.Spec.Config = &api.ConfigSpec{LogLevel: "debug", MaxLeaseTTL: "768h", UI: &ui}
+		},
+		want:    []string{`log_level = "debug"`, `max_lease_ttl = "768h"`, "ui = false"},
+		notWant: []string{"ui = true"},
+	}, {
+		name: "the user config takes precedence over spec.config",
+		modify: func(vr *api.VaultService) {
+			vr.Spec.Config = &api.ConfigSpec{LogLevel: "debug", MaxLeaseTTL: "768h"}
+		},
+		userData: `
+max_lease_ttl = "24h"
+listener "tcp" {
+  address = "127.0.0.1:8200"
+}
+`,
+		want:    []string{`log_level = "debug"`, `max_lease_ttl = "24h"`, `address         = "0.0.0.0:8200"`},
+		notWant: []string{`"768h"`, "127.0.0.1"},
+	}, {
+		name: "seal and prometheus telemetry",
+		modify: func(vr *api.VaultService) {
+			vr.Spec.Seal = &api.SealSpec{Type: "awskms", Config: map[string]string{"region": "us-east-1"}}
+			vr.Spec.Telemetry = &api.TelemetrySpec{
+				Type:       api.TelemetryPrometheus,
+				Prometheus: &api.PrometheusTelemetrySpec{RetentionTime: "1h", UnauthenticatedMetricsAccess: true},
+			}
+		},
+		want: []string{
+			`seal "awskms"`,
+			`region = "us-east-1"`,
+			`prometheus_retention_time = "1h"`,
+			"unauthenticated_metrics_access = true",
+		},
+		notWant: []string{"statsd_address"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vr := newTestVault("default", "example")
+			if tt.modify != nil {
+				tt.modify(vr)
+			}
+			got, err := newVaultConfig(vr, tt.userData)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("expect the config to contain %q, got\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("expect the config not to contain %q, got\n%s", notWant, got)
+				}
+			}
+			// The rendered config is rendered again as it is.
+			again, err := newVaultConfig(vr, got)
+			if err != nil {
+				t.Fatalf("unexpected error rendering the config again: %v", err)
+			}
+			if again != got {
+				t.Errorf("expect the config to be rendered again as\n%s\ngot\n%s", got, again)
+			}
+			if _, err = vaultutil.ParseConfig(got); err != nil {
+				t.Errorf("expect a valid config, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewVaultConfigInvalid(t *testing.T) {
+	vr := newTestVault("default", "example")
+	if _, err := newVaultConfig(vr, `telemetry = "statsd"`); err == nil || !strings.Contains(err.Error(), `"telemetry" must be a block`) {
+		t.Errorf("expect a parse error, got %v", err)
+	}
+}
@@ -15,15 +15,20 @@
 package operator
 
 import (
+	"bytes"
+	"context"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 	"github.com/nanosapp/vault-operator/pkg/util/tlsutil"
 	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
 
+	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -34,9 +39,17 @@ var (
 	defaultClusterDomain = "cluster.local"
 )
 
+const (
+	// caKeyName and caCertName are the keys of the CA secret of the default vault TLS secrets.
+	caKeyName  = "ca.key"
+	caCertName = "ca.crt"
+)
+
 // prepareDefaultVaultTLSSecrets creates the default secrets for the vault server's TLS assets.
 // Currently we self-generate the CA, and use the self generated CA to sign all the TLS certs.
-func (v *Vaults) prepareDefaultVaultTLSSecrets(vr *api.VaultService) (err error) {
+// It returns the hash of the server certificate the operator manages, which the vault nodes load at start,
+// or an empty string if the server certificate is given by the user.
+func (v *Vaults) prepareDefaultVaultTLSSecrets(ctx context.Context, vr *api.VaultService) (certHash string, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("prepare default vault TLS secrets failed: %v", err)
@@ -46,52 +59,180 @@ func (v *Vaults) prepareDefaultVaultTLSSecrets(vr *api.VaultService) (err error)
 	// if TLS spec doesn't exist or secrets doesn't exist, then we can go create secrets.
 	// TODO: we won't need IsTLSConfigured() check once we have initializers.
 	if api.IsTLSConfigured(vr.Spec.TLS) {
-		// TODO: use secrets informer
-		_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Get(vr.Spec.TLS.Static.ServerSecret, metav1.GetOptions{})
+		var se *v1.Secret
+		se, err = v.getSecret(ctx, vr.Namespace, vr.Spec.TLS.Static.ServerSecret)
 		if err == nil {
-			return nil
+			return v.reissueDefaultVaultTLSSecrets(ctx, vr, se)
 		}
 		if !apierrors.IsNotFound(err) {
-			return err
+			return "", err
 		}
 	}
 
-	// TODO: optional user pass-in CA.
-	caKey, caCrt, err := newCACert()
+	caKey, caCrt, err := v.vaultCA(ctx, vr)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	se, err := newVaultServerTLSSecret(vr, caKey, caCrt)
 	if err != nil {
-		return err
+		return "", err
 	}
 	k8sutil.AddOwnerRefToObject(se, k8sutil.AsOwner(vr))
-	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(se)
+	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(ctx, se, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		se, err = v.getSecret(ctx, vr.Namespace, se.Name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	cs := newVaultClientTLSSecret(vr, caCrt)
+	k8sutil.AddOwnerRefToObject(cs, k8sutil.AsOwner(vr))
+	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(ctx, cs, metav1.CreateOptions{})
 	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return err
+		return "", err
+	}
+	return serverCertHash(se), nil
+}
+
+// reissueDefaultVaultTLSSecrets reissues the default vault server certificate of a vault cluster
+// if it lacks the DNS names of the headless service of a statefulset or the host of the ingress,
+// and returns the hash of the server certificate, see prepareDefaultVaultTLSSecrets.
+// The certificate is signed by the CA of the vault cluster, so clients keep trusting it.
+// Vault clusters created before the CA was kept get a new CA, which is added to the CA bundle
+// of the client secret next to the previous one.
+// The vault nodes are rolled out to the reissued certificate by syncPodTemplate.
+func (v *Vaults) reissueDefaultVaultTLSSecrets(ctx context.Context, vr *api.VaultService, serverSecret *v1.Secret) (string, error) {
+	if vr.Spec.TLS.Static.ServerSecret != api.DefaultVaultServerTLSSecretName(vr.Name) ||
+		vr.Spec.TLS.Static.ClientSecret != api.DefaultVaultClientTLSSecretName(vr.Name) {
+		return "", nil
+	}
+	if ref := metav1.GetControllerOf(serverSecret); ref == nil || ref.UID != vr.UID {
+		// The secret was created by the user.
+		return "", nil
+	}
+	crt, err := tlsutil.ParsePEMEncodedCACert(serverSecret.Data[vaultutil.ServerTLSCertName])
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s of secret (%s): %v", vaultutil.ServerTLSCertName, serverSecret.Name, err)
+	}
+	var missing []string
+	for _, host := range vaultServerHosts(vr) {
+		if crt.VerifyHostname(host) != nil {
+			missing = append(missing, host)
+		}
+	}
+	if len(missing) == 0 || !v.allowDisruption(vr, api.MaintenanceOperationCertRotation) {
+		return serverCertHash(serverSecret), nil
+	}
+	logrus.Infof("reissuing the default server certificate of vault (%s) for the DNS names %v", vaultKey(vr), missing)
+
+	caKey, caCrt, err := v.vaultCA(ctx, vr)
+	if err != nil {
+		return "", err
+	}
+	// The CA is added to the client secret first, so that a failure is retried while the server certificate is still outdated.
+	clientSecret, err := v.getSecret(ctx, vr.Namespace, vr.Spec.TLS.Static.ClientSecret)
+	if err != nil {
+		return "", err
+	}
+	caPEM := tlsutil.EncodeCertificatePEM(caCrt)
+	if bundle := clientSecret.Data[api.CATLSCertName]; !bytes.Contains(bundle, caPEM) {
+		clientSecret = clientSecret.DeepCopy()
+		clientSecret.Data[api.CATLSCertName] = append(append([]byte{}, bundle...), caPEM...)
+		_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Update(ctx, clientSecret, metav1.UpdateOptions{})
+		if err != nil {
+			return "", fmt.Errorf("update secret (%s) failed: %v", clientSecret.Name, err)
+		}
 	}
 
-	se = newVaultClientTLSSecret(vr, caCrt)
+	se, err := newVaultServerTLSSecret(vr, caKey, caCrt)
+	if err != nil {
+		return "", err
+	}
+	serverSecret = serverSecret.DeepCopy()
+	serverSecret.Data = se.Data
+	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Update(ctx, serverSecret, metav1.UpdateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("update secret (%s) failed: %v", serverSecret.Name, err)
+	}
+	return serverCertHash(serverSecret), nil
+}
+
+// vaultServerHosts returns the DNS names the default server certificate must be valid for,
+// besides those of the services every vault cluster has.
+func vaultServerHosts(vr *api.VaultService) []string {
+	var hosts []string
+	if api.WorkloadKindOf(&vr.Spec) == api.WorkloadKindStatefulSet {
+		hosts = append(hosts, fmt.Sprintf("%s-0.%s.%s.svc", vr.Name, k8sutil.HeadlessServiceName(vr.Name), vr.Namespace))
+	}
+	if vr.Spec.Ingress != nil && len(vr.Spec.Ingress.Host) != 0 {
+		hosts = append(hosts, vr.Spec.Ingress.Host)
+	}
+	return hosts
+}
+
+// serverCertHash returns the hash of the server certificate of the secret.
+func serverCertHash(se *v1.Secret) string {
+	sum := sha256.Sum256(se.Data[vaultutil.ServerTLSCertName])
+	return hex.EncodeToString(sum[:])
+}
+
+// vaultCA returns the self-generated CA of the default vault TLS secrets from its secret,
+// or creates it if it does not exist yet.
+// The operator did not keep the CA before, so vault clusters created earlier get a new one.
+func (v *Vaults) vaultCA(ctx context.Context, vr *api.VaultService) (*rsa.PrivateKey, *x509.Certificate, error) {
+	name := k8sutil.VaultCATLSSecretName(vr.Name)
+	se, err := v.secretLister(vr.Namespace).Get(name)
+	if err == nil {
+		caKey, err := tlsutil.ParsePEMEncodedPrivateKey(se.Data[caKeyName])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s of secret (%s): %v", caKeyName, name, err)
+		}
+		caCrt, err := tlsutil.ParsePEMEncodedCACert(se.Data[caCertName])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s of secret (%s): %v", caCertName, name, err)
+		}
+		return caKey, caCrt, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, nil, err
+	}
+
+	// TODO: optional user pass-in CA.
+	caKey, caCrt, err := newCACert()
+	if err != nil {
+		return nil, nil, err
+	}
+	se = &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: k8sutil.LabelsForVault(vr.Name),
+		},
+		Data: map[string][]byte{
+			caKeyName:  tlsutil.EncodePrivateKeyPEM(caKey),
+			caCertName: tlsutil.EncodeCertificatePEM(caCrt),
+		},
+	}
 	k8sutil.AddOwnerRefToObject(se, k8sutil.AsOwner(vr))
-	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(se)
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return err
+	// An existing secret is not in the cache yet, so its CA is read on the retry.
+	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(ctx, se, metav1.CreateOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("create secret (%s) failed: %v", name, err)
 	}
-	return nil
+	return caKey, caCrt, nil
 }
 
 // prepareEtcdTLSSecrets creates three etcd TLS secrets (client, server, peer) containing TLS assets.
 // Currently we self-generate the CA, and use the self generated CA to sign all the TLS certs.
-func (v *Vaults) prepareEtcdTLSSecrets(vr *api.VaultService) (err error) {
+func (v *Vaults) prepareEtcdTLSSecrets(ctx context.Context, vr *api.VaultService) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("prepare TLS secrets failed: %v", err)
 		}
 	}()
 
-	// TODO: use secrets informer
-	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Get(k8sutil.EtcdClientTLSSecretName(vr.Name), metav1.GetOptions{})
+	_, err = v.secretLister(vr.Namespace).Get(k8sutil.EtcdClientTLSSecretName(vr.Name))
 	if err == nil {
 		return nil
 	}
@@ -110,7 +251,7 @@ func (v *Vaults) prepareEtcdTLSSecrets(vr *api.VaultService) (err error) {
 		return err
 	}
 	k8sutil.AddOwnerRefToObject(se, k8sutil.AsOwner(vr))
-	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(se)
+	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(ctx, se, metav1.CreateOptions{})
 	if err != nil && !apierrors.IsAlreadyExists(err) {
 		return err
 	}
@@ -120,7 +261,7 @@ func (v *Vaults) prepareEtcdTLSSecrets(vr *api.VaultService) (err error) {
 		return err
 	}
 	k8sutil.AddOwnerRefToObject(se, k8sutil.AsOwner(vr))
-	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(se)
+	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(ctx, se, metav1.CreateOptions{})
 	if err != nil && !apierrors.IsAlreadyExists(err) {
 		return err
 	}
@@ -130,7 +271,7 @@ func (v *Vaults) prepareEtcdTLSSecrets(vr *api.VaultService) (err error) {
 		return err
 	}
 	k8sutil.AddOwnerRefToObject(se, k8sutil.AsOwner(vr))
-	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(se)
+	_, err = v.kubecli.CoreV1().Secrets(vr.Namespace).Create(ctx, se, metav1.CreateOptions{})
 	if err != nil && !apierrors.IsAlreadyExists(err) {
 		return err
 	}
@@ -138,26 +279,26 @@ func (v *Vaults) prepareEtcdTLSSecrets(vr *api.VaultService) (err error) {
 }
 
 // cleanupTLSSecrets cleans up etcd TLS secrets generated by operator for the given vault.
-func (v *Vaults) cleanupEtcdTLSSecrets(vr *api.VaultService) (err error) {
+func (v *Vaults) cleanupEtcdTLSSecrets(ctx context.Context, vr *api.VaultService) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("cleanup TLS secrets failed: %v", err)
 		}
 	}()
 	name := k8sutil.EtcdClientTLSSecretName(vr.Name)
-	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(name, nil)
+	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("delete secret (%s) failed: %v", name, err)
 	}
 
 	name = k8sutil.EtcdServerTLSSecretName(vr.Name)
-	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(name, nil)
+	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("delete secret (%s) failed: %v", name, err)
 	}
 
 	name = k8sutil.EtcdPeerTLSSecretName(vr.Name)
-	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(name, nil)
+	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("delete secret (%s) failed: %v", name, err)
 	}
@@ -210,20 +351,26 @@ func newEtcdPeerTLSSecret(vr *api.VaultService, caKey *rsa.PrivateKey, caCrt *x5
 }
 
 // cleanupDefaultVaultTLSSecrets cleans up any auto generated vault TLS secrets for the given vault cluster
-func (v *Vaults) cleanupDefaultVaultTLSSecrets(vr *api.VaultService) (err error) {
+func (v *Vaults) cleanupDefaultVaultTLSSecrets(ctx context.Context, vr *api.VaultService) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("cleanup vault TLS secrets failed: %v", err)
 		}
 	}()
 	name := api.DefaultVaultServerTLSSecretName(vr.Name)
-	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(name, nil)
+	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("delete secret (%s) failed: %v", name, err)
 	}
 
 	name = api.DefaultVaultClientTLSSecretName(vr.Name)
-	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(name, nil)
+	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete secret (%s) failed: %v", name, err)
+	}
+
+	name = k8sutil.VaultCATLSSecretName(vr.Name)
+	err = v.kubecli.CoreV1().Secrets(vr.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("delete secret (%s) failed: %v", name, err)
 	}
@@ -232,12 +379,20 @@ func (v *Vaults) cleanupDefaultVaultTLSSecrets(vr *api.VaultService) (err error)
 
 // newVaultServerTLSSecret returns a secret containing vault server TLS assets
 func newVaultServerTLSSecret(vr *api.VaultService, caKey *rsa.PrivateKey, caCrt *x509.Certificate) (*v1.Secret, error) {
+	addrs := []string{
+		"localhost",
+		fmt.Sprintf("*.%s.pod", vr.Namespace),
+		fmt.Sprintf("%s.%s.svc", vr.Name, vr.Namespace),
+		fmt.Sprintf("%s.%s.svc", k8sutil.ActiveServiceName(vr.Name), vr.Namespace),
+		fmt.Sprintf("%s.%s.svc", k8sutil.StandbyServiceName(vr.Name), vr.Namespace),
+		// The nodes of a statefulset, also of a deployment based cluster migrated to one later.
+		fmt.Sprintf("*.%s.%s.svc", k8sutil.HeadlessServiceName(vr.Name), vr.Namespace),
+	}
+	if vr.Spec.Ingress != nil && len(vr.Spec.Ingress.Host) != 0 {
+		addrs = append(addrs, vr.Spec.Ingress.Host)
+	}
 	return newTLSSecret(vr, caKey, caCrt, "vault server", api.DefaultVaultServerTLSSecretName(vr.Name),
-		[]string{
-			"localhost",
-			fmt.Sprintf("*.%s.pod", vr.Namespace),
-			fmt.Sprintf("%s.%s.svc", vr.Name, vr.Namespace),
-		},
+		addrs,
 		map[string]string{
 			"key":  vaultutil.ServerTLSKeyName,
 			"cert": vaultutil.ServerTLSCertName,
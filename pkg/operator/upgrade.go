@@ -0,0 +1,569 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// stepDownTimeout is how long an upgraded node has to become active
+	// after the active node of the previous version stepped down.
+	stepDownTimeout = 15 * time.Second
+
+	// backupPollPeriod is how often the status of the backup before an upgrade is checked.
+	backupPollPeriod = 5 * time.Second
+	// backupRetryPeriod is the time after which a failed backup before an upgrade is retried.
+	backupRetryPeriod = time.Minute
+)
+
+// syncUpgrade upgrades the vault nodes to the image of the spec, and records
+// the progress in vr.Status.Upgrade, which is written by syncVaultStatus:
+//
+//   Pending -> [BackingUp ->] [Canary -> Soaking ->] RollingOut -> Completed
+//
+// An upgrade is Pending while spec.upgradeStrategy.paused is set, or outside of the
+// maintenance windows of spec.maintenanceWindows. With a backup, the upgrade only starts
+// once the storage is backed up. With a canary step, a canary pod of the new version
+// has to be unsealed and stay unsealed for the soak period before the other nodes are upgraded.
+// If the canary pod or the upgraded nodes are not unsealed within the rollback deadline,
+// the upgrade ends up RolledBack on the previous image.
+// With spec.upgradeStrategy.multiHop, the nodes are upgraded through the intermediate
+// versions of vaultutil.UpgradePath, one completed upgrade after another.
+func (v *Vaults) syncUpgrade(ctx context.Context, vr *api.VaultService, w *vaultWorkload) (err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("syncUpgrade failed: %v", err)
+		}
+	}()
+
+	strategy := vr.Spec.UpgradeStrategy
+	if strategy == nil {
+		strategy = &api.UpgradeStrategy{}
+	}
+	current := k8sutil.PodVaultImage(w.podTemplate().Spec)
+	u := vr.Status.Upgrade
+
+	// A rolled back upgrade is not retried until spec.version changes.
+	if u != nil && u.Phase == api.UpgradePhaseRolledBack && u.TargetVersion == vr.Spec.Version {
+		return v.deleteCanaryPod(ctx, vr)
+	}
+
+	if !upgradeInProgress(u) || u.TargetVersion != vr.Spec.Version {
+		version := nextUpgradeVersion(vr, current)
+		target := k8sutil.VaultVersionImage(vr.Spec, version)
+		if current != target {
+			return v.startUpgrade(ctx, vr, w, strategy, current, version)
+		}
+		// Step down the old active node of an upgrade that started before the upgrade status existed.
+		if u == nil {
+			return v.stepDownOldActive(ctx, vr, target)
+		}
+		// The workload already runs the version of the spec.
+		if u.Phase == api.UpgradePhasePending || upgradeInProgress(u) {
+			u.ToVersion = version
+			u.TargetVersion = vr.Spec.Version
+			setUpgradePhase(u, api.UpgradePhaseCompleted, "")
+			return v.deleteCanaryPod(ctx, vr)
+		}
+		return nil
+	}
+	target := k8sutil.VaultVersionImage(vr.Spec, u.ToVersion)
+
+	// The deployment is paused as well, so that the rollout stops.
+	// The pods of a statefulset are replaced by syncStatefulSetPods, which stops by itself.
+	paused := strategy.Paused && u.Phase == api.UpgradePhaseRollingOut
+	if d := w.deployment; d != nil && d.Spec.Paused != paused {
+		d.Spec.Paused = paused
+		_, err = v.kubecli.AppsV1().Deployments(d.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to set paused of deployment (%s) to %v: %v", d.Name, paused, err)
+		}
+		return nil
+	}
+	if strategy.Paused {
+		u.Message = "upgrade is paused"
+		return nil
+	}
+
+	switch u.Phase {
+	case api.UpgradePhaseBackingUp:
+		return v.syncBackup(ctx, vr, w, strategy, target)
+	case api.UpgradePhaseCanary, api.UpgradePhaseSoaking:
+		return v.syncCanary(ctx, vr, w, strategy, target)
+	case api.UpgradePhaseRollingOut:
+		return v.syncRollout(ctx, vr, w, strategy, target)
+	}
+	return nil
+}
+
+// nextUpgradeVersion returns the version to upgrade the vault nodes to from the current image.
+// It is spec.version, unless the nodes are upgraded through an intermediate version first.
+func nextUpgradeVersion(vr *api.VaultService, current string) string {
+	if us := vr.Spec.UpgradeStrategy; us == nil || !us.MultiHop {
+		return vr.Spec.Version
+	}
+	from, err := vaultutil.ParseVersion(k8sutil.ImageVersion(current))
+	if err != nil {
+		return vr.Spec.Version
+	}
+	to, err := vaultutil.ParseVersion(vr.Spec.Version)
+	if err != nil {
+		return vr.Spec.Version
+	}
+	path, err := vaultutil.UpgradePath(from, to)
+	if err != nil {
+		// The upgrade is forced, so there is no path through supported versions.
+		return vr.Spec.Version
+	}
+	if len(path) > 1 {
+		return path[0].String()
+	}
+	return vr.Spec.Version
+}
+
+// startUpgrade starts an upgrade from the current image of the workload to the given version.
+// An upgrade in progress to another version is superseded.
+func (v *Vaults) startUpgrade(ctx context.Context, vr *api.VaultService, w *vaultWorkload, strategy *api.UpgradeStrategy, current, version string) error {
+	err := v.deleteCanaryPod(ctx, vr)
+	if err != nil {
+		return err
+	}
+
+	u := vr.Status.Upgrade
+	if u == nil || u.TargetVersion != vr.Spec.Version || u.Phase == api.UpgradePhaseCompleted || u.Phase == api.UpgradePhaseRolledBack {
+		u = &api.UpgradeStatus{
+			FromVersion:   k8sutil.ImageVersion(current),
+			FromImage:     current,
+			TargetVersion: vr.Spec.Version,
+		}
+		vr.Status.Upgrade = u
+	}
+	u.ToVersion = version
+	target := k8sutil.VaultVersionImage(vr.Spec, version)
+
+	if strategy.Paused {
+		setUpgradePhase(u, api.UpgradePhasePending, "upgrade is paused")
+		return nil
+	}
+	if !v.allowDisruption(vr, api.MaintenanceOperationUpgrade) {
+		setUpgradePhase(u, api.UpgradePhasePending, "waiting for the next maintenance window")
+		return nil
+	}
+
+	logrus.Infof("upgrading vault (%s) from %s to %s", vaultKey(vr), u.FromVersion, u.ToVersion)
+	if strategy.Backup != nil && strategy.Backup.S3 != nil {
+		setUpgradePhase(u, api.UpgradePhaseBackingUp, "waiting for the backup of the storage")
+		return v.syncBackup(ctx, vr, w, strategy, target)
+	}
+	return v.beginUpgrade(ctx, vr, w, strategy, target)
+}
+
+// beginUpgrade upgrades the canary node, or all nodes without a canary step, to the target image.
+func (v *Vaults) beginUpgrade(ctx context.Context, vr *api.VaultService, w *vaultWorkload, strategy *api.UpgradeStrategy, target string) error {
+	u := vr.Status.Upgrade
+	if strategy.Canary != nil {
+		setUpgradePhase(u, api.UpgradePhaseCanary, "waiting for the canary node to be unsealed")
+		return v.createCanaryPod(ctx, vr, w, target)
+	}
+	setUpgradePhase(u, api.UpgradePhaseRollingOut, "")
+	return v.upgradeWorkload(ctx, vr, w, target)
+}
+
+// syncBackup backs up the etcd storage with the etcd backup operator, and begins the upgrade
+// once the backup succeeded. A failed backup is retried after backupRetryPeriod,
+// so the upgrade does not start without a backup.
+func (v *Vaults) syncBackup(ctx context.Context, vr *api.VaultService, w *vaultWorkload, strategy *api.UpgradeStrategy, target string) error {
+	u := vr.Status.Upgrade
+	if strategy.Backup == nil || strategy.Backup.S3 == nil {
+		// The backup was removed from the strategy meanwhile.
+		u.BackupPath = ""
+		err := v.beginUpgrade(ctx, vr, w, strategy, target)
+		if err != nil {
+			return err
+		}
+		return v.deleteUpgradeBackup(ctx, vr)
+	}
+	if len(u.BackupPath) == 0 {
+		u.BackupPath = k8sutil.UpgradeBackupPath(vr, u.FromVersion, time.Now())
+	}
+
+	name := k8sutil.UpgradeBackupName(vr.Name)
+	eb, err := k8sutil.GetEtcdBackup(ctx, v.dynamicCli, vr.Namespace, name)
+	if apierrors.IsNotFound(err) {
+		err = k8sutil.CreateEtcdBackup(ctx, v.dynamicCli, k8sutil.NewUpgradeEtcdBackup(vr, u.BackupPath))
+		if err != nil {
+			return fmt.Errorf("failed to create etcd backup (%s): %v", name, err)
+		}
+		v.queue.AddAfter(vaultKey(vr), backupPollPeriod)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get etcd backup (%s): %v", name, err)
+	}
+	if eb.Spec.S3 == nil || eb.Spec.S3.Path != u.BackupPath {
+		// The backup is left over from another upgrade.
+		v.queue.AddAfter(vaultKey(vr), backupPollPeriod)
+		return v.deleteUpgradeBackup(ctx, vr)
+	}
+
+	switch {
+	case eb.Status.Succeeded && eb.Status.EtcdRevision > 0:
+		logrus.Infof("backed up vault (%s) to %s before the upgrade to %s", vaultKey(vr), u.BackupPath, u.ToVersion)
+		err = v.beginUpgrade(ctx, vr, w, strategy, target)
+		if err != nil {
+			return err
+		}
+		return v.deleteUpgradeBackup(ctx, vr)
+	case len(eb.Status.Reason) != 0:
+		if left := backupRetryPeriod - time.Since(eb.CreationTimestamp.Time); left > 0 {
+			u.Message = fmt.Sprintf("backup failed, retrying in %v: %s", left.Round(time.Second), eb.Status.Reason)
+			v.queue.AddAfter(vaultKey(vr), left)
+			return nil
+		}
+		logrus.Warningf("backup of vault (%s) before the upgrade failed, retrying: %s", vaultKey(vr), eb.Status.Reason)
+		u.BackupPath = ""
+		v.queue.AddAfter(vaultKey(vr), backupPollPeriod)
+		return v.deleteUpgradeBackup(ctx, vr)
+	default:
+		v.queue.AddAfter(vaultKey(vr), backupPollPeriod)
+		return nil
+	}
+}
+
+func (v *Vaults) deleteUpgradeBackup(ctx context.Context, vr *api.VaultService) error {
+	name := k8sutil.UpgradeBackupName(vr.Name)
+	err := k8sutil.DeleteEtcdBackup(ctx, v.dynamicCli, vr.Namespace, name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete etcd backup (%s): %v", name, err)
+	}
+	return nil
+}
+
+// syncCanary waits until the canary pod is unsealed, and then for the soak period,
+// before rolling out the new version to all nodes.
+func (v *Vaults) syncCanary(ctx context.Context, vr *api.VaultService, w *vaultWorkload, strategy *api.UpgradeStrategy, target string) error {
+	u := vr.Status.Upgrade
+	if strategy.Canary == nil {
+		// The canary step was removed from the strategy meanwhile.
+		u.CanaryReadyTime = nil
+		setUpgradePhase(u, api.UpgradePhaseRollingOut, "")
+		err := v.upgradeWorkload(ctx, vr, w, target)
+		if err != nil {
+			return err
+		}
+		return v.deleteCanaryPod(ctx, vr)
+	}
+
+	p, err := v.canaryPod(vr)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return v.createCanaryPod(ctx, vr, w, target)
+	}
+
+	if k8sutil.IsPodUnsealed(*p) && p.DeletionTimestamp == nil {
+		if u.CanaryReadyTime == nil {
+			now := metav1.Now()
+			u.CanaryReadyTime = &now
+			setUpgradePhase(u, api.UpgradePhaseSoaking, "")
+		}
+		soak, err := time.ParseDuration(strategy.Canary.SoakPeriod)
+		if err != nil {
+			return fmt.Errorf("invalid soak period (%s): %v", strategy.Canary.SoakPeriod, err)
+		}
+		if left := soak - time.Since(u.CanaryReadyTime.Time); left > 0 {
+			u.Message = fmt.Sprintf("canary node is unsealed, rolling out in %v", left.Round(time.Second))
+			v.queue.AddAfter(vaultKey(vr), left)
+			return nil
+		}
+
+		logrus.Infof("canary node of vault (%s) stayed unsealed for %v, rolling out %s", vaultKey(vr), soak, u.ToVersion)
+		u.CanaryReadyTime = nil
+		setUpgradePhase(u, api.UpgradePhaseRollingOut, "")
+		err = v.upgradeWorkload(ctx, vr, w, target)
+		if err != nil {
+			return err
+		}
+		return v.deleteCanaryPod(ctx, vr)
+	}
+
+	if u.Phase == api.UpgradePhaseSoaking {
+		u.CanaryReadyTime = nil
+		setUpgradePhase(u, api.UpgradePhaseCanary, "canary node became sealed or unhealthy during the soak period")
+	}
+	expired, err := v.rollbackDeadlineExpired(vr, strategy)
+	if err != nil || !expired {
+		return err
+	}
+	// The workload still runs the previous version, so only the canary pod has to go.
+	logrus.Warningf("canary node of vault (%s) did not become unsealed in %s, rolling back", vaultKey(vr), strategy.RollbackDeadline)
+	setUpgradePhase(u, api.UpgradePhaseRolledBack, fmt.Sprintf("canary node did not become unsealed within %s", strategy.RollbackDeadline))
+	return v.deleteCanaryPod(ctx, vr)
+}
+
+// syncRollout waits until all upgraded nodes are unsealed, steps down the active node
+// of the previous version, and completes the upgrade once all nodes run the new version.
+func (v *Vaults) syncRollout(ctx context.Context, vr *api.VaultService, w *vaultWorkload, strategy *api.UpgradeStrategy, target string) error {
+	u := vr.Status.Upgrade
+
+	pods, err := v.runningVaultPods(vr)
+	if err != nil {
+		return err
+	}
+	unsealed, old := 0, 0
+	for _, p := range pods {
+		if k8sutil.PodVaultImage(p.Spec) != target {
+			old++
+			continue
+		}
+		if k8sutil.IsPodUnsealed(*p) {
+			unsealed++
+		}
+	}
+
+	if old == 0 && unsealed >= int(vr.Spec.Nodes) {
+		logrus.Infof("vault (%s) is upgraded to %s", vaultKey(vr), u.ToVersion)
+		if u.ToVersion != u.TargetVersion {
+			// Continue with the upgrade to the next version.
+			setUpgradePhase(u, api.UpgradePhaseCompleted, fmt.Sprintf("upgrading to %s next", u.TargetVersion))
+			v.queue.Add(vaultKey(vr))
+			return nil
+		}
+		setUpgradePhase(u, api.UpgradePhaseCompleted, "")
+		return nil
+	}
+	u.Message = fmt.Sprintf("%d of %d upgraded nodes are unsealed", unsealed, vr.Spec.Nodes)
+
+	if unsealed < int(vr.Spec.Nodes) {
+		expired, err := v.rollbackDeadlineExpired(vr, strategy)
+		if err != nil || !expired {
+			return err
+		}
+		logrus.Warningf("upgraded nodes of vault (%s) did not become unsealed in %s, rolling back to %s", vaultKey(vr), strategy.RollbackDeadline, u.FromImage)
+		setUpgradePhase(u, api.UpgradePhaseRolledBack,
+			fmt.Sprintf("%d of %d upgraded nodes were unsealed after %s", unsealed, vr.Spec.Nodes, strategy.RollbackDeadline))
+		return v.rollbackWorkload(ctx, w, u.FromImage)
+	}
+	if w.statefulSet != nil {
+		// The active node steps down before syncStatefulSetPods replaces it.
+		return nil
+	}
+	return v.stepDownOldActive(ctx, vr, target)
+}
+
+// stepDownOldActive makes the active node of the previous version step down,
+// once all other nodes run the target image and are standby.
+func (v *Vaults) stepDownOldActive(ctx context.Context, vr *api.VaultService, target string) error {
+	pods, err := v.runningVaultPods(vr)
+	if err != nil {
+		return err
+	}
+	var updated []string
+	var updatedPods []*v1.Pod
+	var active *v1.Pod
+	for _, p := range pods {
+		if k8sutil.PodVaultImage(p.Spec) == target {
+			updated = append(updated, p.Name)
+			updatedPods = append(updatedPods, p)
+		}
+		if p.Name == vr.Status.VaultStatus.Active {
+			active = p
+		}
+	}
+
+	// If there is one active node belonging to the old version, and all other nodes are
+	// standby and uptodate, then trigger step-down on active node.
+	// It maps to the following conditions on Status:
+	// 1. check standby == updated
+	// 2. check Available - Updated == Active
+	readyToTriggerStepdown := func() bool {
+		if len(vr.Status.VaultStatus.Active) == 0 {
+			return false
+		}
+
+		if !reflect.DeepEqual(vr.Status.VaultStatus.Standby, updated) {
+			return false
+		}
+
+		ava := append(vr.Status.VaultStatus.Standby, vr.Status.VaultStatus.Sealed...)
+		if !reflect.DeepEqual(ava, updated) {
+			return false
+		}
+		return true
+	}()
+
+	if readyToTriggerStepdown {
+		us := vr.Spec.UpgradeStrategy
+		if us != nil && len(us.StepDownTokenSecret) != 0 && active != nil {
+			err = v.stepDown(ctx, vr, active, updatedPods, us.StepDownTokenSecret)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				logrus.Warningf("graceful step-down of vault (%s) failed, deleting the active pod (%s): %v",
+					vaultKey(vr), vr.Status.VaultStatus.Active, err)
+			}
+		}
+
+		// Without a step-down, this will send SIGTERM to the active Vault pod. It should release HA lock and exit properly.
+		// If it failed for some reason, kubelet will send SIGKILL after default grace period (30s) eventually.
+		// It take longer but the the lock will get released eventually on failure case.
+		err = v.kubecli.CoreV1().Pods(vr.Namespace).Delete(ctx, vr.Status.VaultStatus.Active, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("step down: failed to delete active Vault pod (%s): %v", vr.Status.VaultStatus.Active, err)
+		}
+	}
+	return nil
+}
+
+// stepDown makes the active vault node step down with sys/step-down,
+// and waits until one of the upgraded nodes has taken over.
+// The token in the given secret has to be allowed to use sys/step-down.
+func (v *Vaults) stepDown(ctx context.Context, vr *api.VaultService, active *v1.Pod, upgraded []*v1.Pod, tokenSecret string) error {
+	secret, err := v.getSecret(ctx, vr.Namespace, tokenSecret)
+	if err != nil {
+		return fmt.Errorf("failed to get step-down token secret (%s): %v", tokenSecret, err)
+	}
+	token := string(secret.Data[api.StepDownTokenKey])
+	if len(token) == 0 {
+		return fmt.Errorf("step-down token secret (%s) has no %q key", tokenSecret, api.StepDownTokenKey)
+	}
+	secret, err = v.getSecret(ctx, vr.Namespace, vr.Spec.TLS.Static.ClientSecret)
+	if err != nil {
+		return fmt.Errorf("failed to get client TLS secret (%s): %v", vr.Spec.TLS.Static.ClientSecret, err)
+	}
+	tlsConfig, err := k8sutil.VaultTLSFromSecretData(secret)
+	if err != nil {
+		return fmt.Errorf("failed to read TLS config for vault client: %v", err)
+	}
+
+	vapi, err := vaultutil.NewClientWithTimeout(k8sutil.PodDNSName(*active), "8200", tlsConfig, v.healthCheckTimeout)
+	if err != nil {
+		return fmt.Errorf("failed creating client for the vault pod (%s/%s): %v", active.Namespace, active.Name, err)
+	}
+	vapi.SetToken(token)
+	err = vapi.Sys().StepDown()
+	if err != nil {
+		return fmt.Errorf("failed stepping down the vault pod (%s/%s): %v", active.Namespace, active.Name, err)
+	}
+	logrus.Infof("active node (%s) of vault (%s) stepped down", active.Name, vaultKey(vr))
+
+	// A standby node usually acquires the HA lock within a few seconds.
+	// The wait ends early when ctx is cancelled, e.g. when the operator loses its leadership.
+	pctx, cancel := context.WithTimeout(ctx, stepDownTimeout)
+	defer cancel()
+	err = wait.PollImmediateUntilWithContext(pctx, time.Second, func(ctx context.Context) (bool, error) {
+		health, err := v.checkHealth(ctx, upgraded, tlsConfig)
+		if err != nil {
+			return false, err
+		}
+		for _, ph := range health {
+			if ph.err == nil && podRole(ph.hr) == k8sutil.VaultRoleActive {
+				logrus.Infof("upgraded node (%s) of vault (%s) became active", ph.pod.Name, vaultKey(vr))
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil && ctx.Err() == nil && pctx.Err() != nil {
+		return fmt.Errorf("no upgraded node of vault (%s) became active within %v", vaultKey(vr), stepDownTimeout)
+	}
+	return err
+}
+
+// rollbackDeadlineExpired returns whether the current upgrade phase lasts longer than
+// the rollback deadline. Otherwise vr is requeued for when the deadline expires.
+func (v *Vaults) rollbackDeadlineExpired(vr *api.VaultService, strategy *api.UpgradeStrategy) (bool, error) {
+	if len(strategy.RollbackDeadline) == 0 {
+		return false, nil
+	}
+	deadline, err := time.ParseDuration(strategy.RollbackDeadline)
+	if err != nil {
+		return false, fmt.Errorf("invalid rollback deadline (%s): %v", strategy.RollbackDeadline, err)
+	}
+	left := deadline - time.Since(vr.Status.Upgrade.StartTime.Time)
+	if left > 0 {
+		v.queue.AddAfter(vaultKey(vr), left)
+		return false, nil
+	}
+	return true, nil
+}
+
+// canaryPod returns the canary pod of vr from the pod cache, or nil if it does not exist.
+func (v *Vaults) canaryPod(vr *api.VaultService) (*v1.Pod, error) {
+	obj, exists, err := v.podIndexerFor(vr.Namespace).GetByKey(vr.Namespace + "/" + k8sutil.CanaryPodName(vr.Name))
+	if err != nil || !exists {
+		return nil, err
+	}
+	return obj.(*v1.Pod), nil
+}
+
+func (v *Vaults) createCanaryPod(ctx context.Context, vr *api.VaultService, w *vaultWorkload, image string) error {
+	p := k8sutil.NewCanaryPod(vr, w.podTemplate(), image)
+	_, err := v.kubecli.CoreV1().Pods(vr.Namespace).Create(ctx, p, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create canary pod (%s): %v", p.Name, err)
+	}
+	return nil
+}
+
+func (v *Vaults) deleteCanaryPod(ctx context.Context, vr *api.VaultService) error {
+	p, err := v.canaryPod(vr)
+	if err != nil || p == nil {
+		return err
+	}
+	err = v.kubecli.CoreV1().Pods(vr.Namespace).Delete(ctx, p.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete canary pod (%s): %v", p.Name, err)
+	}
+	return nil
+}
+
+// upgradeInProgress returns whether the upgrade with the given status is started and not finished.
+func upgradeInProgress(u *api.UpgradeStatus) bool {
+	if u == nil {
+		return false
+	}
+	switch u.Phase {
+	case api.UpgradePhaseBackingUp, api.UpgradePhaseCanary, api.UpgradePhaseSoaking, api.UpgradePhaseRollingOut:
+		return true
+	}
+	return false
+}
+
+// setUpgradePhase moves the upgrade to the given phase, which starts now unless it is the current phase.
+func setUpgradePhase(u *api.UpgradeStatus, phase api.UpgradePhase, message string) {
+	if u.Phase != phase {
+		now := metav1.Now()
+		u.StartTime = &now
+		u.Phase = phase
+	}
+	u.Message = message
+}
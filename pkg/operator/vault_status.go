@@ -16,72 +16,138 @@ package operator
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"sort"
 	"time"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
 
 	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
 )
 
-// monitorAndUpdateStatus monitors the vault service and replicas statuses, and
-// updates the status resource in the vault CR item.
-func (vs *Vaults) monitorAndUpdateStatus(ctx context.Context, vr *api.VaultService) {
-	var tlsConfig *vaultapi.TLSConfig
+// podHealth is the result of the health check of a vault pod.
+type podHealth struct {
+	pod *v1.Pod
+	hr  *vaultapi.HealthResponse
+	err error
+}
 
-	s := api.VaultServiceStatus{
-		Phase:       api.ClusterPhaseRunning,
-		ServiceName: vr.GetName(),
-		ClientPort:  k8sutil.VaultClientPort,
+// syncVaultStatus checks the health of the vault pods of vr concurrently,
+// and updates the status resource in the vault CR item if it has changed from oldStatus,
+// the status before the reconcile, including the changes of vr.Status during the reconcile.
+// It is called on every reconcile, which is triggered by changes of the
+// vault CR and of its pods, and by the periodic resync.
+func (vs *Vaults) syncVaultStatus(ctx context.Context, vr *api.VaultService, oldStatus *api.VaultServiceStatus) error {
+	s := vr.Status.DeepCopy()
+	s.Phase = api.ClusterPhaseRunning
+	s.ServiceName = vr.GetName()
+	s.ActiveServiceName = k8sutil.ActiveServiceName(vr.GetName())
+	s.StandbyServiceName = k8sutil.StandbyServiceName(vr.GetName())
+	s.ClientPort = k8sutil.VaultClientPort
+	s.Selector = labels.SelectorFromSet(k8sutil.LabelsForVault(vr.GetName())).String()
+
+	pods, err := vs.runningVaultPods(vr)
+	if err != nil {
+		return err
 	}
+	s.Nodes = int32(len(pods))
 
-	for {
-		// Do not wait to update Phase ASAP.
-		latest, err := vs.updateVaultCRStatus(ctx, vr.GetName(), vr.GetNamespace(), s)
+	if len(pods) != 0 {
+		secret, err := vs.getSecret(ctx, vr.Namespace, vr.Spec.TLS.Static.ClientSecret)
+		if err != nil {
+			return fmt.Errorf("failed to get client TLS secret (%s): %v", vr.Spec.TLS.Static.ClientSecret, err)
+		}
+		tlsConfig, err := k8sutil.VaultTLSFromSecretData(secret)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS config for vault client: %v", err)
+		}
+		health, err := vs.checkHealth(ctx, pods, tlsConfig)
 		if err != nil {
-			logrus.Errorf("failed updating the status for the vault service: %s (%v)", vr.GetName(), err)
+			return err
 		}
-		if latest != nil {
-			vr = latest
+		updateVaultStatus(vr, s, health)
+		err = vs.updatePodRoles(ctx, health)
+		if err != nil {
+			return err
 		}
+	}
+	recordClusterStatus(vr, s)
 
-		select {
-		case err := <-ctx.Done():
-			logrus.Infof("stop monitoring vault (%s), reason: %v", vr.GetName(), err)
-			return
-		case <-time.After(10 * time.Second):
+	// Times are compared semantically, since they lose their location and precision when stored.
+	if apiequality.Semantic.DeepEqual(*oldStatus, *s) {
+		return nil
+	}
+	_, err = vs.updateVaultCRStatus(ctx, vr.GetName(), vr.GetNamespace(), *s)
+	if err != nil {
+		return fmt.Errorf("failed updating the status for the vault service: %s (%v)", vr.GetName(), err)
+	}
+	return nil
+}
+
+// runningVaultPods returns the running vault pods of vr from the pod cache, sorted by name.
+func (vs *Vaults) runningVaultPods(vr *api.VaultService) ([]*v1.Pod, error) {
+	objs, err := vs.podIndexerFor(vr.Namespace).ByIndex(vaultIndex, vaultKey(vr))
+	if err != nil {
+		return nil, fmt.Errorf("failed listing pods for the vault service (%s): %v", vaultKey(vr), err)
+	}
+	var pods []*v1.Pod
+	for _, obj := range objs {
+		p := obj.(*v1.Pod)
+		// If a pod is Terminating, it is still Running but has no IP.
+		if p.Status.Phase != v1.PodRunning || p.DeletionTimestamp != nil {
+			continue
 		}
+		pods = append(pods, p)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
 
-		if tlsConfig == nil {
-			var err error
-			tlsConfig, err = k8sutil.VaultTLSFromSecret(vs.kubecli, vr)
+// checkHealth requests the health info of all pods concurrently.
+// Every request fails after the health check timeout of the operator.
+func (vs *Vaults) checkHealth(ctx context.Context, pods []*v1.Pod, tlsConfig *vaultapi.TLSConfig) ([]podHealth, error) {
+	// Buffered so that the requests never block if we stop waiting for them.
+	results := make(chan podHealth, len(pods))
+	for _, p := range pods {
+		go func(p *v1.Pod) {
+			ph := podHealth{pod: p}
+			start := time.Now()
+			vapi, err := vaultutil.NewClientWithTimeout(k8sutil.PodDNSName(*p), "8200", tlsConfig, vs.healthCheckTimeout)
 			if err != nil {
-				logrus.Errorf("failed to read TLS config for vault client: %v", err)
-				continue
+				ph.err = fmt.Errorf("failed creating client for the vault pod (%s/%s): %v", p.Namespace, p.Name, err)
+			} else if ph.hr, err = vapi.Sys().Health(); err != nil {
+				ph.err = fmt.Errorf("failed requesting health info for the vault pod (%s/%s): %v", p.Namespace, p.Name, err)
 			}
-		}
-		vs.updateLocalVaultCRStatus(ctx, vr, &s, tlsConfig)
+			healthCheckDuration.WithLabelValues(p.Namespace, p.Labels[k8sutil.VaultClusterLabel]).Observe(time.Since(start).Seconds())
+			results <- ph
+		}(p)
 	}
-}
 
-// updateLocalVaultCRStatus updates local vault CR status by querying each vault pod's API.
-func (vs *Vaults) updateLocalVaultCRStatus(ctx context.Context, vr *api.VaultService, s *api.VaultServiceStatus, tlsConfig *vaultapi.TLSConfig) {
-	name, namespace := vr.Name, vr.Namespace
-	sel := k8sutil.LabelsForVault(name)
-	// TODO: handle upgrades when pods from two replicaset can co-exist :(
-	opt := metav1.ListOptions{LabelSelector: labels.SelectorFromSet(sel).String()}
-	pods, err := vs.kubecli.CoreV1().Pods(namespace).List(opt)
-	if err != nil {
-		logrus.Errorf("failed to update vault replica status: failed listing pods for the vault service (%s.%s): %v", name, namespace, err)
-		return
+	health := make([]podHealth, 0, len(pods))
+	for range pods {
+		select {
+		case ph := <-results:
+			health = append(health, ph)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
+	sort.Slice(health, func(i, j int) bool { return health[i].pod.Name < health[j].pod.Name })
+	return health, nil
+}
 
+// updateVaultStatus updates the vault node statuses in s from the health info of the pods.
+func updateVaultStatus(vr *api.VaultService, s *api.VaultServiceStatus, health []podHealth) {
+	var active string
 	var sealNodes []string
 	var standByNodes []string
 	var updated []string
@@ -89,25 +155,13 @@ func (vs *Vaults) updateLocalVaultCRStatus(ctx context.Context, vr *api.VaultSer
 	// If it can't talk to any vault pod, we are not going to change the status.
 	changed := false
 
-	for _, p := range pods.Items {
-		// If a pod is Terminating, it is still Running but has no IP.
-		if p.Status.Phase != v1.PodRunning || p.DeletionTimestamp != nil {
-			continue
-		}
-
-		vapi, err := vaultutil.NewClient(k8sutil.PodDNSName(p), "8200", tlsConfig)
-		if err != nil {
-			logrus.Errorf("failed to update vault replica status: failed creating client for the vault pod (%s/%s): %v", namespace, p.GetName(), err)
+	for _, ph := range health {
+		if ph.err != nil {
+			logrus.Errorf("failed to update vault replica status: %v", ph.err)
 			continue
 		}
-
-		hr, err := vapi.Sys().Health()
-		if err != nil {
-			logrus.Errorf("failed to update vault replica status: failed requesting health info for the vault pod (%s/%s): %v", namespace, p.GetName(), err)
-			continue
-		}
-
 		changed = true
+		p, hr := ph.pod, ph.hr
 
 		if k8sutil.IsVaultVersionMatch(p.Spec, vr.Spec) {
 			updated = append(updated, p.GetName())
@@ -115,7 +169,7 @@ func (vs *Vaults) updateLocalVaultCRStatus(ctx context.Context, vr *api.VaultSer
 
 		// TODO: add to vaultutil?
 		if hr.Initialized && !hr.Sealed && !hr.Standby {
-			s.VaultStatus.Active = p.GetName()
+			active = p.GetName()
 		}
 		if hr.Initialized && !hr.Sealed && hr.Standby {
 			standByNodes = append(standByNodes, p.GetName())
@@ -132,22 +186,34 @@ func (vs *Vaults) updateLocalVaultCRStatus(ctx context.Context, vr *api.VaultSer
 		return
 	}
 
+	s.VaultStatus.Active = active
 	s.VaultStatus.Standby = standByNodes
 	s.VaultStatus.Sealed = sealNodes
+	s.SealedNodes = int32(len(sealNodes))
 	s.Initialized = inited
 	s.UpdatedNodes = updated
 }
 
-// updateVaultCRStatus updates the status field of the Vault CR.
+// updateVaultCRStatus updates the status subresource of the Vault CR.
+// It retries on conflicts, since users may change the spec concurrently.
 func (vs *Vaults) updateVaultCRStatus(ctx context.Context, name, namespace string, status api.VaultServiceStatus) (*api.VaultService, error) {
-	vault, err := vs.vaultsCRCli.VaultV1alpha1().VaultServices(namespace).Get(name, metav1.GetOptions{})
-	if err != nil {
-		return nil, err
-	}
-	if reflect.DeepEqual(vault.Status, status) {
-		return vault, nil
-	}
-	vault.Status = status
-	_, err = vs.vaultsCRCli.VaultV1alpha1().VaultServices(namespace).Update(vault)
+	var vault *api.VaultService
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := vs.vaultsCRCli.VaultV1beta1().VaultServices(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		vault = latest
+		if reflect.DeepEqual(vault.Status, status) {
+			return nil
+		}
+		vault.Status = status
+		updated, err := vs.vaultsCRCli.VaultV1beta1().VaultServices(namespace).UpdateStatus(ctx, vault, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		vault = updated
+		return nil
+	})
 	return vault, err
 }
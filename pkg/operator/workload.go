@@ -0,0 +1,362 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// vaultWorkload is the deployment or the statefulset running the vault nodes, see spec.workload.
+// Exactly one of deployment and statefulSet is set.
+type vaultWorkload struct {
+	deployment  *appsv1.Deployment
+	statefulSet *appsv1.StatefulSet
+
+	// migrating is set while the nodes of the deployment of a vault cluster are
+	// replaced by the nodes of its statefulset.
+	migrating bool
+}
+
+// podTemplate returns the pod template of the vault nodes.
+func (w *vaultWorkload) podTemplate() *v1.PodTemplateSpec {
+	if w.statefulSet != nil {
+		return &w.statefulSet.Spec.Template
+	}
+	return &w.deployment.Spec.Template
+}
+
+// getWorkload returns a copy of the workload of the vault nodes from the caches,
+// or nil if it has to be deployed.
+//
+// A deployment based vault cluster whose spec.workload is changed to StatefulSet is migrated:
+// the statefulset is created with the vault image of the deployment, and its nodes join
+// the vault cluster. Once all of them are unsealed, the deployment is deleted.
+// The migration begins in a maintenance window, see allowDisruption.
+// The statefulset runs the vault config with the given hash, see k8sutil.VaultConfigHash.
+func (v *Vaults) getWorkload(ctx context.Context, vr *api.VaultService, configHash string) (*vaultWorkload, error) {
+	d, err := v.deploymentLister(vr.Namespace).Get(vr.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err != nil {
+		d = nil
+	}
+	ss, err := v.statefulSetLister(vr.Namespace).Get(vr.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err != nil {
+		ss = nil
+	}
+
+	if api.WorkloadKindOf(&vr.Spec) == api.WorkloadKindDeployment {
+		if ss != nil {
+			return nil, fmt.Errorf("vault nodes run in statefulset (%s), which cannot be migrated back to a deployment", ss.Name)
+		}
+		if d == nil {
+			return nil, nil
+		}
+		return &vaultWorkload{deployment: d.DeepCopy()}, nil
+	}
+
+	if ss == nil {
+		if d == nil {
+			return nil, nil
+		}
+		// The nodes keep running in the deployment until the migration may begin.
+		if !v.allowDisruption(vr, api.MaintenanceOperationMigration) {
+			return &vaultWorkload{deployment: d.DeepCopy()}, nil
+		}
+		logrus.Infof("migrating vault (%s) from a deployment to a statefulset", vaultKey(vr))
+		ss, err = v.kubecli.AppsV1().StatefulSets(vr.Namespace).Create(ctx, k8sutil.NewVaultStatefulSet(vr, k8sutil.PodVaultImage(d.Spec.Template.Spec), configHash), metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create statefulset (%s): %v", vr.Name, err)
+		}
+	}
+	w := &vaultWorkload{statefulSet: ss.DeepCopy()}
+	if d == nil {
+		return w, nil
+	}
+
+	w.migrating = true
+	pods, err := v.statefulSetPods(vr, ss)
+	if err != nil {
+		return nil, err
+	}
+	unsealed := 0
+	for _, p := range pods {
+		if k8sutil.IsPodUnsealed(*p) {
+			unsealed++
+		}
+	}
+	if unsealed < int(vr.Spec.Nodes) {
+		return w, nil
+	}
+	// The active node of the deployment steps down when it is terminated.
+	logrus.Infof("all nodes of the statefulset of vault (%s) are unsealed, deleting the deployment", vaultKey(vr))
+	err = v.kubecli.AppsV1().Deployments(vr.Namespace).Delete(ctx, d.Name, k8sutil.CascadeDeleteBackground())
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to delete deployment (%s): %v", d.Name, err)
+	}
+	return w, nil
+}
+
+// scaleWorkload updates the replicas of the workload to spec.nodes.
+func (v *Vaults) scaleWorkload(ctx context.Context, vr *api.VaultService, w *vaultWorkload) error {
+	if w.statefulSet != nil {
+		if *w.statefulSet.Spec.Replicas == vr.Spec.Nodes {
+			return nil
+		}
+		w.statefulSet.Spec.Replicas = &(vr.Spec.Nodes)
+		ss, err := v.kubecli.AppsV1().StatefulSets(vr.Namespace).Update(ctx, w.statefulSet, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update size of statefulset (%s): %v", w.statefulSet.Name, err)
+		}
+		w.statefulSet = ss
+		return nil
+	}
+
+	if *w.deployment.Spec.Replicas == vr.Spec.Nodes {
+		return nil
+	}
+	w.deployment.Spec.Replicas = &(vr.Spec.Nodes)
+	d, err := v.kubecli.AppsV1().Deployments(vr.Namespace).Update(ctx, w.deployment, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update size of deployment (%s): %v", w.deployment.Name, err)
+	}
+	w.deployment = d
+	return nil
+}
+
+// upgradeWorkload rolls the workload forward to the given vault image.
+func (v *Vaults) upgradeWorkload(ctx context.Context, vr *api.VaultService, w *vaultWorkload, image string) error {
+	if w.statefulSet != nil {
+		return k8sutil.UpdateStatefulSetImage(ctx, v.kubecli, w.statefulSet, image)
+	}
+	return k8sutil.UpgradeDeployment(ctx, v.kubecli, vr, w.deployment, image)
+}
+
+// rollbackWorkload rolls the workload back to the given vault image.
+func (v *Vaults) rollbackWorkload(ctx context.Context, w *vaultWorkload, image string) error {
+	if w.statefulSet != nil {
+		return k8sutil.UpdateStatefulSetImage(ctx, v.kubecli, w.statefulSet, image)
+	}
+	return k8sutil.RollbackDeployment(ctx, v.kubecli, w.deployment, image)
+}
+
+// syncPodTemplate rolls the vault nodes out to a changed pod template, e.g. after a change of the
+// vault config, spec.pod, spec.telemetry or spec.ingress, by replacing the pod template of the workload.
+// Changes are detected by the hash of the pod template, see k8sutil.PodTemplateHash. The vault image
+// of the workload is kept, since it is changed by the upgrades only. A deployment replaces its pods
+// right away, while the pods of a statefulset are replaced one at a time by syncStatefulSetPods.
+// The rollout waits for a running upgrade, and begins in a maintenance window, see allowDisruption.
+func (v *Vaults) syncPodTemplate(ctx context.Context, vr *api.VaultService, w *vaultWorkload, configHash string) error {
+	pt := k8sutil.NewVaultPodTemplate(vr, configHash)
+	if k8sutil.PodTemplateHash(w.podTemplate()) == k8sutil.PodTemplateHash(&pt) {
+		return nil
+	}
+	if upgradeInProgress(vr.Status.Upgrade) {
+		return nil
+	}
+	if !v.allowDisruption(vr, api.MaintenanceOperationConfigChange) {
+		return nil
+	}
+
+	logrus.Infof("rolling out the changed pod template of vault (%s)", vaultKey(vr))
+	pt.Spec.Containers[0].Image = k8sutil.PodVaultImage(w.podTemplate().Spec)
+	*w.podTemplate() = pt
+	if w.statefulSet != nil {
+		ss, err := v.kubecli.AppsV1().StatefulSets(vr.Namespace).Update(ctx, w.statefulSet, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to roll out the pod template of statefulset (%s): %v", w.statefulSet.Name, err)
+		}
+		w.statefulSet = ss
+		return nil
+	}
+	d, err := v.kubecli.AppsV1().Deployments(vr.Namespace).Update(ctx, w.deployment, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to roll out the pod template of deployment (%s): %v", w.deployment.Name, err)
+	}
+	w.deployment = d
+	return nil
+}
+
+// syncStatefulSetPods replaces the pods of the statefulset that do not run its current revision,
+// since the statefulset leaves that to the operator (OnDelete). The pods are replaced one at a time:
+//   - Outdated nodes that are not unsealed first, since that does not reduce the availability,
+//     e.g. the upgraded nodes of a rolled back upgrade.
+//   - Once all nodes are unsealed, the outdated standby nodes from the highest ordinal down.
+//   - The active node last, after it stepped down, see stepDownBeforeReplace.
+//
+// So the active node changes once per rollout, and an updated node takes over.
+// Nothing is replaced while spec.upgradeStrategy.paused is set.
+func (v *Vaults) syncStatefulSetPods(ctx context.Context, vr *api.VaultService, w *vaultWorkload) error {
+	ss := w.statefulSet
+	if ss == nil {
+		return nil
+	}
+	if us := vr.Spec.UpgradeStrategy; us != nil && us.Paused {
+		return nil
+	}
+	if ss.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType {
+		// Statefulsets created by earlier operator versions use partitioned rolling updates,
+		// which replace the pods by their ordinals regardless of their vault roles.
+		ss.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType}
+		updated, err := v.kubecli.AppsV1().StatefulSets(vr.Namespace).Update(ctx, ss, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to set the update strategy of statefulset (%s): %v", ss.Name, err)
+		}
+		w.statefulSet = updated
+		return nil
+	}
+	if ss.Status.ObservedGeneration < ss.Generation {
+		// The update revision is not yet computed for the current pod template.
+		return nil
+	}
+
+	pods, err := v.statefulSetPods(vr, ss)
+	if err != nil {
+		return err
+	}
+	if len(pods) < int(*ss.Spec.Replicas) {
+		// The statefulset controller is creating a pod.
+		return nil
+	}
+	unsealed := 0
+	var sealed, active *v1.Pod
+	var standbys []*v1.Pod
+	for _, p := range pods {
+		if p.DeletionTimestamp != nil {
+			// A pod is being replaced already.
+			return nil
+		}
+		if k8sutil.IsPodUnsealed(*p) {
+			unsealed++
+		}
+		if p.Labels[appsv1.StatefulSetRevisionLabel] == ss.Status.UpdateRevision {
+			continue
+		}
+		switch p.Labels[k8sutil.VaultRoleLabel] {
+		case k8sutil.VaultRoleActive:
+			active = p
+		case k8sutil.VaultRoleStandby:
+			standbys = append(standbys, p)
+		default:
+			sealed = p
+		}
+	}
+
+	if sealed != nil {
+		return v.replaceStatefulSetPod(ctx, vr, ss, sealed)
+	}
+	if unsealed < len(pods) {
+		return nil
+	}
+	if len(standbys) != 0 {
+		sort.Slice(standbys, func(i, j int) bool {
+			oi, _ := statefulSetPodOrdinal(ss, standbys[i])
+			oj, _ := statefulSetPodOrdinal(ss, standbys[j])
+			return oi > oj
+		})
+		return v.replaceStatefulSetPod(ctx, vr, ss, standbys[0])
+	}
+	if active == nil {
+		return nil
+	}
+	v.stepDownBeforeReplace(ctx, vr, active, ss.Status.UpdateRevision)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return v.replaceStatefulSetPod(ctx, vr, ss, active)
+}
+
+// stepDownBeforeReplace makes the active node step down gracefully if spec.upgradeStrategy.stepDownTokenSecret
+// is set and an updated node is unsealed to take over. Otherwise the active node steps down when it is terminated.
+func (v *Vaults) stepDownBeforeReplace(ctx context.Context, vr *api.VaultService, active *v1.Pod, revision string) {
+	us := vr.Spec.UpgradeStrategy
+	if us == nil || len(us.StepDownTokenSecret) == 0 {
+		return
+	}
+	pods, err := v.runningVaultPods(vr)
+	if err != nil {
+		logrus.Warningf("failed to list the pods of vault (%s) for the step-down: %v", vaultKey(vr), err)
+		return
+	}
+	var updated []*v1.Pod
+	for _, p := range pods {
+		if p.Labels[appsv1.StatefulSetRevisionLabel] == revision && k8sutil.IsPodUnsealed(*p) {
+			updated = append(updated, p)
+		}
+	}
+	if len(updated) == 0 {
+		return
+	}
+	if err = v.stepDown(ctx, vr, active, updated, us.StepDownTokenSecret); err != nil && ctx.Err() == nil {
+		logrus.Warningf("graceful step-down of vault (%s) failed, replacing the active pod (%s): %v", vaultKey(vr), active.Name, err)
+	}
+}
+
+// replaceStatefulSetPod deletes an outdated pod of the statefulset, which the statefulset controller
+// recreates from its update revision. The pod is not deleted if it was replaced meanwhile.
+func (v *Vaults) replaceStatefulSetPod(ctx context.Context, vr *api.VaultService, ss *appsv1.StatefulSet, p *v1.Pod) error {
+	logrus.Infof("replacing pod (%s) of vault (%s) with a node of revision %s", p.Name, vaultKey(vr), ss.Status.UpdateRevision)
+	err := v.kubecli.CoreV1().Pods(vr.Namespace).Delete(ctx, p.Name, metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(p.UID))})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		return fmt.Errorf("failed to delete the outdated pod (%s): %v", p.Name, err)
+	}
+	return nil
+}
+
+// statefulSetPods returns the pods of the statefulset of vr from the pod cache.
+func (v *Vaults) statefulSetPods(vr *api.VaultService, ss *appsv1.StatefulSet) ([]*v1.Pod, error) {
+	objs, err := v.podIndexerFor(vr.Namespace).ByIndex(vaultIndex, vaultKey(vr))
+	if err != nil {
+		return nil, fmt.Errorf("failed listing pods for the vault service (%s): %v", vaultKey(vr), err)
+	}
+	var pods []*v1.Pod
+	for _, obj := range objs {
+		p := obj.(*v1.Pod)
+		if ref := metav1.GetControllerOf(p); ref == nil || ref.UID != ss.UID {
+			continue
+		}
+		pods = append(pods, p)
+	}
+	return pods, nil
+}
+
+// statefulSetPodOrdinal returns the ordinal of a pod of the statefulset from its name <statefulset>-<ordinal>.
+func statefulSetPodOrdinal(ss *appsv1.StatefulSet, p *v1.Pod) (int32, bool) {
+	if !strings.HasPrefix(p.Name, ss.Name+"-") {
+		return 0, false
+	}
+	ordinal, err := strconv.ParseInt(strings.TrimPrefix(p.Name, ss.Name+"-"), 10, 32)
+	if err != nil || ordinal < 0 {
+		return 0, false
+	}
+	return int32(ordinal), true
+}
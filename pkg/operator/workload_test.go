@@ -0,0 +1,291 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestSyncPodTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		statefulSet bool
+		// modify changes vr before the workload is created, change afterwards.
+		modify      func(vr *api.VaultService)
+		change      func(vr *api.VaultService)
+		configHash  string
+		wantRollout bool
+	}{
+		{name: "unchanged", configHash: "old"},
+		{name: "config of deployment", configHash: "new", wantRollout: true},
+		{name: "config of statefulset", statefulSet: true, configHash: "new", wantRollout: true},
+		{
+			name: "pod policy",
+			change: func(vr *api.VaultService) {
+				vr.Spec.Pod = &api.PodPolicy{Labels: map[string]string{"team": "security"}}
+			},
+			configHash: "old", wantRollout: true,
+		},
+		{
+			name: "telemetry disabled",
+			change: func(vr *api.VaultService) {
+				vr.Spec.Telemetry = &api.TelemetrySpec{Type: api.TelemetryDisabled}
+			},
+			configHash: "new", wantRollout: true,
+		},
+		{
+			name: "upgrade in progress",
+			modify: func(vr *api.VaultService) {
+				vr.Status.Upgrade = &api.UpgradeStatus{Phase: api.UpgradePhaseRollingOut}
+			},
+			configHash: "new",
+		},
+		{
+			name:        "outside of the maintenance windows",
+			statefulSet: true,
+			modify: func(vr *api.VaultService) {
+				vr.Status.Maintenance = &api.MaintenanceStatus{
+					NextWindow: &metav1.Time{Time: time.Now().Add(time.Hour)},
+				}
+			},
+			configHash: "new",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			kubecli := kubefake.NewSimpleClientset()
+			v := &Vaults{
+				kubecli: kubecli,
+				queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test"),
+			}
+			defer v.queue.ShutDown()
+
+			vr := newTestVault("default", "example")
+			vr.SetDefaults()
+			if tt.modify != nil {
+				tt.modify(vr)
+			}
+			// The workload runs another vault image than the spec, e.g. during a paused upgrade.
+			image := "vault:0.9.0-0"
+			w := &vaultWorkload{}
+			if tt.statefulSet {
+				ss, err := kubecli.AppsV1().StatefulSets(vr.Namespace).Create(ctx, k8sutil.NewVaultStatefulSet(vr, image, "old"), metav1.CreateOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				w.statefulSet = ss
+			} else {
+				if err := k8sutil.DeployVault(ctx, kubecli, vr, "old"); err != nil {
+					t.Fatal(err)
+				}
+				d, err := kubecli.AppsV1().Deployments(vr.Namespace).Get(ctx, vr.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				d.Spec.Template.Spec.Containers[0].Image = image
+				w.deployment = d
+			}
+			old := w.podTemplate().DeepCopy()
+			if tt.change != nil {
+				tt.change(vr)
+			}
+
+			if err := v.syncPodTemplate(ctx, vr, w, tt.configHash); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var pt *v1.PodTemplateSpec
+			if tt.statefulSet {
+				ss, err := kubecli.AppsV1().StatefulSets(vr.Namespace).Get(ctx, vr.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				pt = &ss.Spec.Template
+			} else {
+				d, err := kubecli.AppsV1().Deployments(vr.Namespace).Get(ctx, vr.Name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				pt = &d.Spec.Template
+			}
+			if !tt.wantRollout {
+				if got, want := k8sutil.PodTemplateHash(pt), k8sutil.PodTemplateHash(old); got != want {
+					t.Errorf("expect the pod template hash %q to be kept, got %q", want, got)
+				}
+			} else {
+				want := k8sutil.NewVaultPodTemplate(vr, tt.configHash)
+				if got := k8sutil.PodTemplateHash(pt); got != k8sutil.PodTemplateHash(&want) {
+					t.Errorf("expect pod template hash %q, got %q", k8sutil.PodTemplateHash(&want), got)
+				}
+				if got := k8sutil.PodVaultConfigHash(pt); got != tt.configHash {
+					t.Errorf("expect config hash %q, got %q", tt.configHash, got)
+				}
+				if got := k8sutil.PodVaultImage(pt.Spec); got != image {
+					t.Errorf("expect the vault image %s to be kept, got %s", image, got)
+				}
+			}
+
+			if m := vr.Status.Maintenance; m != nil && !m.InWindow {
+				if want := []string{api.MaintenanceOperationConfigChange}; !reflect.DeepEqual(m.PendingOperations, want) {
+					t.Errorf("expect pending operations %v, got %v", want, m.PendingOperations)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncStatefulSetPods(t *testing.T) {
+	// The pods are given by revision and vault role, "" for a sealed node.
+	type pod struct {
+		revision, role string
+		terminating    bool
+	}
+	tests := []struct {
+		name          string
+		pods          []pod
+		paused        bool
+		rollingUpdate bool
+		wantDeleted   []string
+	}{
+		{
+			name:        "outdated standby nodes first, from the highest ordinal down",
+			pods:        []pod{{"old", "standby", false}, {"old", "standby", false}, {"old", "active", false}},
+			wantDeleted: []string{"example-1"},
+		},
+		{
+			name:        "active node last",
+			pods:        []pod{{"new", "standby", false}, {"new", "standby", false}, {"old", "active", false}},
+			wantDeleted: []string{"example-2"},
+		},
+		{
+			name:        "outdated sealed node right away",
+			pods:        []pod{{"old", "", false}, {"new", "", false}, {"old", "active", false}},
+			wantDeleted: []string{"example-0"},
+		},
+		{
+			name: "wait until the updated nodes are unsealed",
+			pods: []pod{{"old", "standby", false}, {"new", "", false}, {"old", "active", false}},
+		},
+		{
+			name: "wait until the replaced pod is terminated",
+			pods: []pod{{"old", "standby", false}, {"new", "standby", true}, {"old", "active", false}},
+		},
+		{
+			name:   "paused",
+			pods:   []pod{{"new", "standby", false}, {"new", "standby", false}, {"old", "active", false}},
+			paused: true,
+		},
+		{
+			name:          "statefulset of an earlier operator version",
+			pods:          []pod{{"new", "standby", false}, {"new", "standby", false}, {"old", "active", false}},
+			rollingUpdate: true,
+		},
+		{
+			name: "all pods updated",
+			pods: []pod{{"new", "standby", false}, {"new", "standby", false}, {"new", "active", false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			vr := newTestVault("default", "example")
+			vr.Spec.Nodes = int32(len(tt.pods))
+			vr.SetDefaults()
+			if tt.paused {
+				vr.Spec.UpgradeStrategy = &api.UpgradeStrategy{Paused: true}
+			}
+			ss := k8sutil.NewVaultStatefulSet(vr, k8sutil.VaultImage(vr.Spec), "hash")
+			ss.Namespace = vr.Namespace
+			ss.UID = "statefulset-uid"
+			ss.Status.UpdateRevision = "new"
+			if tt.rollingUpdate {
+				ss.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
+			}
+
+			kubecli := kubefake.NewSimpleClientset(ss)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{vaultIndex: vaultIndexFunc})
+			for i, tp := range tt.pods {
+				p := &v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      fmt.Sprintf("%s-%d", ss.Name, i),
+						Namespace: vr.Namespace,
+						UID:       types.UID(fmt.Sprintf("pod-%d", i)),
+						Labels: map[string]string{
+							k8sutil.VaultClusterLabel:       vr.Name,
+							appsv1.StatefulSetRevisionLabel: tp.revision,
+						},
+					},
+				}
+				if len(tp.role) != 0 {
+					p.Labels[k8sutil.VaultRoleLabel] = tp.role
+				}
+				if tp.terminating {
+					now := metav1.Now()
+					p.DeletionTimestamp = &now
+				}
+				k8sutil.AddOwnerRefToObject(p, *metav1.NewControllerRef(ss, appsv1.SchemeGroupVersion.WithKind("StatefulSet")))
+				if err := indexer.Add(p); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := kubecli.CoreV1().Pods(vr.Namespace).Create(ctx, p, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			kubecli.ClearActions()
+			v := &Vaults{
+				kubecli:     kubecli,
+				podIndexers: map[string]cache.Indexer{metav1.NamespaceAll: indexer},
+			}
+
+			if err := v.syncStatefulSetPods(ctx, vr, &vaultWorkload{statefulSet: ss}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var deleted []string
+			for _, a := range kubecli.Actions() {
+				if d, ok := a.(k8stesting.DeleteAction); ok && a.GetResource().Resource == "pods" {
+					deleted = append(deleted, d.GetName())
+				}
+			}
+			if !reflect.DeepEqual(deleted, tt.wantDeleted) {
+				t.Errorf("expect deleted pods %v, got %v", tt.wantDeleted, deleted)
+			}
+			got, err := kubecli.AppsV1().StatefulSets(vr.Namespace).Get(ctx, ss.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType {
+				t.Errorf("expect update strategy %s, got %s", appsv1.OnDeleteStatefulSetStrategyType, got.Spec.UpdateStrategy.Type)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cronutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fields are the fields of a schedule with their ranges.
+// 7 is accepted as Sunday in the day of week, like 0.
+var fields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// maxSearch bounds the search of the next start of a schedule that matches rarely or never, like "0 0 30 2 *".
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Schedule is a parsed cron schedule "<minute> <hour> <day-of-month> <month> <day-of-week>".
+// Every field is "*", a number, a range "1-5", a step "*/15" or "1-5/2", or a list of them "1,3-5".
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// If both the day of month and the day of week are restricted, a day matching either matches.
+	domAny, dowAny bool
+}
+
+// Parse parses a cron schedule.
+func Parse(spec string) (*Schedule, error) {
+	f := strings.Fields(spec)
+	if len(f) != len(fields) {
+		return nil, fmt.Errorf("invalid schedule (%s): expect <minute> <hour> <day-of-month> <month> <day-of-week>", spec)
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseField(f[i], field.min, field.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule (%s): %s: %v", spec, field.name, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is 0.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: strings.HasPrefix(f[2], "*"),
+		dowAny: strings.HasPrefix(f[4], "*"),
+	}, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		var err error
+		switch i := strings.Index(rng, "-"); {
+		case rng == "*":
+		case i >= 0:
+			if lo, err = strconv.Atoi(rng[:i]); err == nil {
+				hi, err = strconv.Atoi(rng[i+1:])
+			}
+		default:
+			if lo, err = strconv.Atoi(rng); err == nil && step == 1 {
+				hi = lo
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid value in %q", part)
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first start of the schedule after t, in the location of t.
+// It returns the zero time if the schedule does not match within the next five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	end := t.Add(maxSearch)
+	for t.Before(end) {
+		var next time.Time
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		// Daylight saving time transitions may normalize the next candidate to an earlier time.
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cronutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"0 22 * * 1-5",
+		"*/15 0-6/2 1,15 1-12 0,7",
+		"30 4 1-7 * 0",
+		"0 0 29 2 *",
+	}
+	for _, spec := range valid {
+		if _, err := Parse(spec); err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", spec, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@daily",
+	}
+	for _, spec := range invalid {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q): expect an error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	date := func(loc *time.Location, year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		spec string
+		t    time.Time
+		want time.Time
+	}{
+		// Every minute, strictly after t.
+		{"* * * * *", date(time.UTC, 2019, 3, 4, 10, 30), date(time.UTC, 2019, 3, 4, 10, 31)},
+		{"* * * * *", time.Date(2019, 3, 4, 10, 30, 59, 0, time.UTC), date(time.UTC, 2019, 3, 4, 10, 31)},
+		// Later the same day and on the next day.
+		{"0 22 * * *", date(time.UTC, 2019, 3, 4, 10, 30), date(time.UTC, 2019, 3, 4, 22, 0)},
+		{"0 22 * * *", date(time.UTC, 2019, 3, 4, 22, 0), date(time.UTC, 2019, 3, 5, 22, 0)},
+		// Steps and lists.
+		{"*/15 * * * *", date(time.UTC, 2019, 3, 4, 10, 31), date(time.UTC, 2019, 3, 4, 10, 45)},
+		{"5,50 * * * *", date(time.UTC, 2019, 3, 4, 10, 6), date(time.UTC, 2019, 3, 4, 10, 50)},
+		// 2019-03-08 is a Friday, so the next weekday start is on Monday.
+		{"0 22 * * 1-5", date(time.UTC, 2019, 3, 8, 23, 0), date(time.UTC, 2019, 3, 11, 22, 0)},
+		// 7 is Sunday like 0.
+		{"0 0 * * 7", date(time.UTC, 2019, 3, 4, 0, 0), date(time.UTC, 2019, 3, 10, 0, 0)},
+		// The day of month or the day of week matches if both are restricted.
+		{"0 0 15 * 0", date(time.UTC, 2019, 3, 4, 0, 0), date(time.UTC, 2019, 3, 10, 0, 0)},
+		{"0 0 5 * 0", date(time.UTC, 2019, 3, 4, 0, 0), date(time.UTC, 2019, 3, 5, 0, 0)},
+		// Over the end of the year.
+		{"0 0 1 1 *", date(time.UTC, 2019, 3, 4, 0, 0), date(time.UTC, 2020, 1, 1, 0, 0)},
+		// A leap day.
+		{"0 0 29 2 *", date(time.UTC, 2019, 3, 4, 0, 0), date(time.UTC, 2020, 2, 29, 0, 0)},
+		// Never.
+		{"0 0 30 2 *", date(time.UTC, 2019, 3, 4, 0, 0), time.Time{}},
+		// In the location of t, also over the start of daylight saving time on 2019-03-31.
+		{"0 22 * * *", date(berlin, 2019, 3, 30, 23, 0), date(berlin, 2019, 3, 31, 22, 0)},
+		{"30 2 * * *", date(berlin, 2019, 3, 30, 3, 0), date(berlin, 2019, 4, 1, 2, 30)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if got := s.Next(tt.t); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v): expect %v, got %v", tt.spec, tt.t, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	etcdCRAPI "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpgradeBackupName returns the name of the EtcdBackup taken before an upgrade of the given vault.
+func UpgradeBackupName(name string) string {
+	return name + "-upgrade-backup"
+}
+
+// UpgradeBackupPath returns the location of the backup before the upgrade of the given vault
+// from the given version, which is started at time t.
+func UpgradeBackupPath(v *api.VaultService, fromVersion string, t time.Time) string {
+	prefix := strings.TrimSuffix(v.Spec.UpgradeStrategy.Backup.S3.Prefix, "/")
+	return fmt.Sprintf("%s/%s_v%s_%s", prefix, v.Name, fromVersion, t.UTC().Format("2006-01-02-150405"))
+}
+
+// NewUpgradeEtcdBackup returns the EtcdBackup of the etcd storage of the given vault to the given path.
+// The etcd client service is addressed with its namespace, since the etcd backup operator
+// may run in another namespace.
+func NewUpgradeEtcdBackup(v *api.VaultService, path string) *etcdCRAPI.EtcdBackup {
+	s3 := v.Spec.UpgradeStrategy.Backup.S3
+	eb := &etcdCRAPI.EtcdBackup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       etcdCRAPI.EtcdBackupResourceKind,
+			APIVersion: etcdCRAPI.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      UpgradeBackupName(v.Name),
+			Namespace: v.Namespace,
+			Labels:    LabelsForVault(v.Name),
+		},
+		Spec: etcdCRAPI.BackupSpec{
+			EtcdEndpoints: []string{fmt.Sprintf("https://%s-client.%s.svc:%d", EtcdNameForVault(v.Name), v.Namespace, etcdClientPort)},
+			StorageType:   etcdCRAPI.BackupStorageTypeS3,
+			BackupSource: etcdCRAPI.BackupSource{
+				S3: &etcdCRAPI.S3BackupSource{
+					Path:           path,
+					AWSSecret:      s3.AWSSecret,
+					Endpoint:       s3.Endpoint,
+					ForcePathStyle: s3.ForcePathStyle,
+				},
+			},
+			ClientTLSSecret: EtcdClientTLSSecretName(v.Name),
+		},
+	}
+	AddOwnerRefToObject(eb, AsOwner(v))
+	return eb
+}
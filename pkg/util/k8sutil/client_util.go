@@ -19,7 +19,9 @@ import (
 	"os"
 
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 )
 
@@ -39,6 +41,24 @@ func MustNewKubeClient() kubernetes.Interface {
 	return kubernetes.NewForConfigOrDie(cfg)
 }
 
+// MustNewDynamicClient returns a client for resources without a typed client, e.g. of third party CRDs.
+func MustNewDynamicClient() dynamic.Interface {
+	cfg, err := InClusterConfig()
+	if err != nil {
+		panic(err)
+	}
+	return dynamic.NewForConfigOrDie(cfg)
+}
+
+// MustNewMetadataClient returns a client for the metadata of resources, e.g. to cache the secrets without their data.
+func MustNewMetadataClient() metadata.Interface {
+	cfg, err := InClusterConfig()
+	if err != nil {
+		panic(err)
+	}
+	return metadata.NewForConfigOrDie(cfg)
+}
+
 func InClusterConfig() (*rest.Config, error) {
 	// Work around https://github.com/kubernetes/kubernetes/issues/40973
 	// See https://github.com/coreos/etcd-operator/issues/731#issuecomment-283804819
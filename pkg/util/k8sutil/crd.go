@@ -0,0 +1,152 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// NewVaultServiceCRD returns the VaultService CRD as in example/vault_crd.yaml,
+// with an OpenAPI v3 validation schema for each version.
+// The conversion webhook is required, since the API server would otherwise prune
+// the fields that differ between the versions, such as the TLS spec of v1alpha1.
+func NewVaultServiceCRD(conversion *apiextensionsv1.CustomResourceConversion) *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: api.CRDName,
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: api.SchemeGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:     api.VaultServicePlural,
+				Singular:   "vaultservice",
+				Kind:       api.VaultServiceKind,
+				ListKind:   api.VaultServiceKind + "List",
+				ShortNames: api.VaultServiceShortNames,
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    api.SchemeGroupVersion.Version,
+				Served:  true,
+				Storage: true,
+				Schema:  CRValidation(api.VaultServiceSpec{}),
+				Subresources: &apiextensionsv1.CustomResourceSubresources{
+					Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+					Scale: &apiextensionsv1.CustomResourceSubresourceScale{
+						SpecReplicasPath:   ".spec.nodes",
+						StatusReplicasPath: ".status.nodes",
+						LabelSelectorPath:  strPtr(".status.selector"),
+					},
+				},
+				AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+					{Name: "Phase", Type: "string", JSONPath: ".status.phase"},
+					{Name: "Active", Type: "string", Description: "The active Vault node", JSONPath: ".status.vaultStatus.active"},
+					{Name: "Sealed", Type: "integer", Description: "The number of sealed Vault nodes", JSONPath: ".status.sealedNodes"},
+					{Name: "Version", Type: "string", JSONPath: ".spec.version"},
+					{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+				},
+			}, {
+				Name:    v1alpha1.SchemeGroupVersion.Version,
+				Served:  true,
+				Storage: false,
+				Schema:  CRValidation(v1alpha1.VaultServiceSpec{}),
+				Subresources: &apiextensionsv1.CustomResourceSubresources{
+					Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+				},
+				AdditionalPrinterColumns: []apiextensionsv1.CustomResourceColumnDefinition{
+					{Name: "Phase", Type: "string", JSONPath: ".status.phase"},
+					{Name: "Active", Type: "string", Description: "The active Vault node", JSONPath: ".status.vaultStatus.active"},
+					{Name: "Version", Type: "string", JSONPath: ".spec.version"},
+					{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+				},
+			}},
+			Conversion: conversion,
+		},
+	}
+}
+
+// CreateOrUpdateCRD creates the CRD, or updates it if it already exists.
+// The conversion settings of an existing CRD are kept if crd has none,
+// so that a conversion webhook configured out-of-band is not removed.
+func CreateOrUpdateCRD(ctx context.Context, clientset apiextensionsclient.Interface, crd *apiextensionsv1.CustomResourceDefinition) error {
+	_, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Create(ctx, crd, metav1.CreateOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create CRD (%s) failed: %v", crd.Name, err)
+	}
+
+	old, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crd.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("get CRD (%s) failed: %v", crd.Name, err)
+	}
+	updated := old.DeepCopy()
+	updated.Spec = *crd.Spec.DeepCopy()
+	if updated.Spec.Conversion == nil {
+		updated.Spec.Conversion = old.Spec.Conversion
+	}
+	_, err = clientset.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("update CRD (%s) failed: %v", crd.Name, err)
+	}
+	return nil
+}
+
+// WaitCRDReady waits until the CRD is established and its names are accepted.
+func WaitCRDReady(ctx context.Context, clientset apiextensionsclient.Interface, crdName string) error {
+	err := wait.PollWithContext(ctx, 2*time.Second, 60*time.Second, func(ctx context.Context) (bool, error) {
+		crd, err := clientset.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range crd.Status.Conditions {
+			switch cond.Type {
+			case apiextensionsv1.Established:
+				if cond.Status == apiextensionsv1.ConditionTrue {
+					return true, nil
+				}
+			case apiextensionsv1.NamesAccepted:
+				if cond.Status == apiextensionsv1.ConditionFalse {
+					return false, fmt.Errorf("name conflict: %v", cond.Reason)
+				}
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait CRD (%s) ready failed: %v", crdName, err)
+	}
+	return nil
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
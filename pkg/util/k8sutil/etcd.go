@@ -0,0 +1,80 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"context"
+
+	etcdCRAPI "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// The etcd operator objects are handled with the dynamic client and converted from and to
+// the etcd operator types, since the generated clientset of the etcd operator
+// does not support the context-aware client calls.
+var (
+	// EtcdClusterResource is the resource of the etcd operator EtcdClusters.
+	EtcdClusterResource = etcdCRAPI.SchemeGroupVersion.WithResource(etcdCRAPI.EtcdClusterResourcePlural)
+	// EtcdBackupResource is the resource of the etcd backup operator EtcdBackups.
+	EtcdBackupResource = etcdCRAPI.SchemeGroupVersion.WithResource(etcdCRAPI.EtcdBackupResourcePlural)
+)
+
+// GetEtcdCluster returns the EtcdCluster with the given namespace and name.
+func GetEtcdCluster(ctx context.Context, dynamicCli dynamic.Interface, namespace, name string) (*etcdCRAPI.EtcdCluster, error) {
+	ec := &etcdCRAPI.EtcdCluster{}
+	err := getEtcdObject(ctx, dynamicCli, EtcdClusterResource, namespace, name, ec)
+	return ec, err
+}
+
+// GetEtcdBackup returns the EtcdBackup with the given namespace and name.
+func GetEtcdBackup(ctx context.Context, dynamicCli dynamic.Interface, namespace, name string) (*etcdCRAPI.EtcdBackup, error) {
+	eb := &etcdCRAPI.EtcdBackup{}
+	err := getEtcdObject(ctx, dynamicCli, EtcdBackupResource, namespace, name, eb)
+	return eb, err
+}
+
+// CreateEtcdBackup creates the EtcdBackup.
+func CreateEtcdBackup(ctx context.Context, dynamicCli dynamic.Interface, eb *etcdCRAPI.EtcdBackup) error {
+	return createEtcdObject(ctx, dynamicCli, EtcdBackupResource, eb.Namespace, eb)
+}
+
+// DeleteEtcdBackup deletes the EtcdBackup with the given namespace and name.
+func DeleteEtcdBackup(ctx context.Context, dynamicCli dynamic.Interface, namespace, name string) error {
+	return dynamicCli.Resource(EtcdBackupResource).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// getEtcdObject gets the object of the resource and converts it into obj.
+func getEtcdObject(ctx context.Context, dynamicCli dynamic.Interface, res schema.GroupVersionResource, namespace, name string, obj interface{}) error {
+	u, err := dynamicCli.Resource(res).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj)
+}
+
+// createEtcdObject converts obj and creates it as an object of the resource.
+// The API errors are returned as they are, so that IsAlreadyExists can be checked by the callers.
+func createEtcdObject(ctx context.Context, dynamicCli dynamic.Interface, res schema.GroupVersionResource, namespace string, obj interface{}) error {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	_, err = dynamicCli.Resource(res).Namespace(namespace).Create(ctx, &unstructured.Unstructured{Object: u}, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// The TLS modes are set up through the annotations of the NGINX ingress controller.
+	// Other ingress controllers are configured through spec.ingress.annotations.
+	nginxSSLPassthroughAnnotation  = "nginx.ingress.kubernetes.io/ssl-passthrough"
+	nginxBackendProtocolAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+)
+
+var (
+	gatewayGroupVersion = schema.GroupVersion{Group: "gateway.networking.k8s.io", Version: "v1alpha2"}
+
+	// TLSRouteResource is the resource of the Gateway API TLSRoutes.
+	TLSRouteResource = gatewayGroupVersion.WithResource("tlsroutes")
+)
+
+// GatewayResources returns the names of the Gateway API resources served by the API server.
+// It is empty if the Gateway API CRDs are not installed.
+func GatewayResources(kubecli kubernetes.Interface) (map[string]bool, error) {
+	return serverResources(kubecli, gatewayGroupVersion)
+}
+
+// VaultExternalURL returns the URL of the vault cluster for off-cluster clients,
+// or an empty string if the vault cluster is not exposed through spec.ingress.
+func VaultExternalURL(v *api.VaultService) string {
+	if v.Spec.Ingress == nil || len(v.Spec.Ingress.Host) == 0 {
+		return ""
+	}
+	return "https://" + v.Spec.Ingress.Host
+}
+
+// NewVaultIngress returns the Ingress routing the external host of the vault cluster
+// to the client port of its active node.
+func NewVaultIngress(v *api.VaultService) *networkingv1.Ingress {
+	spec := v.Spec.Ingress
+	annotations := map[string]string{}
+	switch spec.TLSMode {
+	case api.IngressTLSPassthrough:
+		annotations[nginxSSLPassthroughAnnotation] = "true"
+	case api.IngressTLSReencrypt:
+		annotations[nginxBackendProtocolAnnotation] = "HTTPS"
+	}
+	for k, val := range spec.Annotations {
+		annotations[k] = val
+	}
+
+	pathType := networkingv1.PathTypePrefix
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        v.Name,
+			Namespace:   v.Namespace,
+			Labels:      LabelsForVault(v.Name),
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: spec.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: ActiveServiceName(v.Name),
+									Port: networkingv1.ServiceBackendPort{Number: VaultClientPort},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+	if len(spec.ClassName) != 0 {
+		ing.Spec.IngressClassName = &spec.ClassName
+	}
+	if spec.TLSMode == api.IngressTLSReencrypt {
+		ing.Spec.TLS = []networkingv1.IngressTLS{{
+			Hosts:      []string{spec.Host},
+			SecretName: spec.TLSSecret,
+		}}
+	}
+	AddOwnerRefToObject(ing, AsOwner(v))
+	return ing
+}
+
+// NewVaultTLSRoute returns the TLSRoute passing the TLS connections to the external host
+// of the vault cluster through to the client port of its active node.
+func NewVaultTLSRoute(v *api.VaultService) *unstructured.Unstructured {
+	spec := v.Spec.Ingress
+	parent := map[string]interface{}{}
+	if gw := spec.Gateway; gw != nil {
+		parent["name"] = gw.Name
+		if len(gw.Namespace) != 0 {
+			parent["namespace"] = gw.Namespace
+		}
+		if len(gw.SectionName) != 0 {
+			parent["sectionName"] = gw.SectionName
+		}
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(gatewayGroupVersion.String())
+	obj.SetKind("TLSRoute")
+	obj.SetName(v.Name)
+	obj.SetNamespace(v.Namespace)
+	obj.SetLabels(LabelsForVault(v.Name))
+	if len(spec.Annotations) != 0 {
+		obj.SetAnnotations(spec.Annotations)
+	}
+	obj.SetOwnerReferences([]metav1.OwnerReference{AsOwner(v)})
+	obj.Object["spec"] = map[string]interface{}{
+		"parentRefs": []interface{}{parent},
+		"hostnames":  []interface{}{spec.Host},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"backendRefs": []interface{}{
+					map[string]interface{}{
+						"name": ActiveServiceName(v.Name),
+						"port": int64(VaultClientPort),
+					},
+				},
+			},
+		},
+	}
+	return obj
+}
@@ -18,15 +18,15 @@ import (
 	"fmt"
 	"strings"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // CascadeDeleteBackground returns a background delete policy option which causes the garbage collector to delete the dependents in the background.
-func CascadeDeleteBackground() *metav1.DeleteOptions {
-	return &metav1.DeleteOptions{
+func CascadeDeleteBackground() metav1.DeleteOptions {
+	return metav1.DeleteOptions{
 		PropagationPolicy: func() *metav1.DeletionPropagation {
 			background := metav1.DeletePropagationBackground
 			return &background
@@ -34,8 +34,13 @@ func CascadeDeleteBackground() *metav1.DeleteOptions {
 	}
 }
 
-// PodDNSName constructs the dns name on which a pod can be addressed
+// PodDNSName constructs the dns name on which a pod can be addressed.
+// The pods of a statefulset have a stable name in its headless service,
+// other pods are addressed by their IP.
 func PodDNSName(p v1.Pod) string {
+	if len(p.Spec.Hostname) != 0 && len(p.Spec.Subdomain) != 0 {
+		return fmt.Sprintf("%s.%s.%s.svc", p.Spec.Hostname, p.Spec.Subdomain, p.Namespace)
+	}
 	podIP := strings.Replace(p.Status.PodIP, ".", "-", -1)
 	return fmt.Sprintf("%s.%s.pod", podIP, p.Namespace)
 }
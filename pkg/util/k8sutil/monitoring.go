@@ -0,0 +1,200 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"fmt"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The Prometheus Operator objects are handled as unstructured objects,
+// so that the Prometheus Operator is not a dependency of the vault operator.
+var (
+	monitoringGroupVersion = schema.GroupVersion{Group: "monitoring.coreos.com", Version: "v1"}
+
+	// ServiceMonitorResource is the resource of the Prometheus Operator ServiceMonitors.
+	ServiceMonitorResource = monitoringGroupVersion.WithResource("servicemonitors")
+	// PrometheusRuleResource is the resource of the Prometheus Operator PrometheusRules.
+	PrometheusRuleResource = monitoringGroupVersion.WithResource("prometheusrules")
+)
+
+// MonitoringResources returns the names of the Prometheus Operator resources served by the API server.
+// It is empty if the Prometheus Operator CRDs are not installed.
+func MonitoringResources(kubecli kubernetes.Interface) (map[string]bool, error) {
+	return serverResources(kubecli, monitoringGroupVersion)
+}
+
+// serverResources returns the names of the resources of the group version served by the API server.
+// It is empty if the group version is not served, e.g. since its CRDs are not installed.
+func serverResources(kubecli kubernetes.Interface, gv schema.GroupVersion) (map[string]bool, error) {
+	list, err := kubecli.Discovery().ServerResourcesForGroupVersion(gv.String())
+	if apierrors.IsNotFound(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("discover %s resources failed: %v", gv, err)
+	}
+	resources := map[string]bool{}
+	for _, r := range list.APIResources {
+		resources[r.Name] = true
+	}
+	return resources, nil
+}
+
+// NewServiceMonitor returns the ServiceMonitor scraping the vault nodes through the vault service.
+// It scrapes the statsd-exporter sidecars, or the vault nodes themselves in case of the native
+// Prometheus telemetry.
+func NewServiceMonitor(vr *api.VaultService) *unstructured.Unstructured {
+	sm := vr.Spec.Monitoring.ServiceMonitor
+
+	var endpoint map[string]interface{}
+	if api.TelemetryTypeOf(&vr.Spec) == api.TelemetryPrometheus {
+		endpoint = map[string]interface{}{
+			"port":   vaultClientPortName,
+			"path":   "/v1/sys/metrics",
+			"params": map[string]interface{}{"format": []interface{}{"prometheus"}},
+			"scheme": "https",
+			"tlsConfig": map[string]interface{}{
+				"ca": map[string]interface{}{
+					"secret": map[string]interface{}{
+						"name": vr.Spec.TLS.Static.ClientSecret,
+						"key":  api.CATLSCertName,
+					},
+				},
+				"serverName": fmt.Sprintf("%s.%s.svc", vr.Name, vr.Namespace),
+			},
+		}
+		if p := vr.Spec.Telemetry.Prometheus; p != nil && len(p.TokenSecret) != 0 {
+			endpoint["bearerTokenSecret"] = map[string]interface{}{
+				"name": p.TokenSecret,
+				"key":  api.TelemetryTokenSecretKey,
+			}
+		}
+	} else {
+		endpoint = map[string]interface{}{
+			"port": "prometheus",
+			"path": "/metrics",
+		}
+	}
+	if len(sm.Interval) != 0 {
+		endpoint["interval"] = sm.Interval
+	}
+
+	obj := newMonitoringObject(vr, "ServiceMonitor")
+	obj.Object["spec"] = map[string]interface{}{
+		// The "-active" and "-standby" services are left out, so that every vault node is scraped once.
+		"selector": map[string]interface{}{
+			"matchLabels": toInterfaceMap(LabelsForVault(vr.Name)),
+			"matchExpressions": []interface{}{
+				map[string]interface{}{"key": VaultRoleLabel, "operator": "DoesNotExist"},
+			},
+		},
+		"endpoints": []interface{}{endpoint},
+	}
+	return obj
+}
+
+// NewPrometheusRule returns the PrometheusRule with the default alerts of the vault cluster.
+// Except for the request latency, the alerts are based on the metrics of the vault operator,
+// which must be scraped with honorLabels to keep their namespace label.
+func NewPrometheusRule(vr *api.VaultService) *unstructured.Unstructured {
+	sel := fmt.Sprintf(`namespace=%q,name=%q`, vr.Namespace, vr.Name)
+	rules := []interface{}{
+		newAlert("VaultSealed",
+			fmt.Sprintf(`vault_operator_cluster_sealed_nodes{%s} > 0 and on(namespace, name) vault_operator_cluster_initialized{%s} == 1`, sel, sel),
+			"5m", "critical", "Vault cluster has sealed nodes",
+			"Vault cluster {{ $labels.namespace }}/{{ $labels.name }} has {{ $value }} sealed nodes."),
+		newAlert("VaultNoActiveNode",
+			fmt.Sprintf(`vault_operator_cluster_active_nodes{%s} == 0 and on(namespace, name) vault_operator_cluster_initialized{%s} == 1`, sel, sel),
+			"5m", "critical", "Vault cluster has no active node",
+			"Vault cluster {{ $labels.namespace }}/{{ $labels.name }} has no active node."),
+		newAlert("VaultTLSCertExpiry",
+			fmt.Sprintf(`vault_operator_tls_cert_expiry_timestamp_seconds{%s} - time() < 7 * 24 * 3600`, sel),
+			"1h", "warning", "Vault TLS certificate expires soon",
+			"The {{ $labels.cert }} certificate of Vault cluster {{ $labels.namespace }}/{{ $labels.name }} expires in less than 7 days."),
+	}
+
+	// vault_core_handle_request is reported in seconds by the statsd-exporter,
+	// and in milliseconds by the native Prometheus telemetry.
+	latencySel := fmt.Sprintf(`namespace=%q,job=%q,quantile="0.99"`, vr.Namespace, vr.Name)
+	switch api.TelemetryTypeOf(&vr.Spec) {
+	case api.TelemetryStatsd:
+		rules = append(rules, newLatencyAlert(fmt.Sprintf(`vault_core_handle_request{%s} > 0.5`, latencySel)))
+	case api.TelemetryPrometheus:
+		rules = append(rules, newLatencyAlert(fmt.Sprintf(`vault_core_handle_request{%s} > 500`, latencySel)))
+	}
+
+	obj := newMonitoringObject(vr, "PrometheusRule")
+	obj.Object["spec"] = map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  fmt.Sprintf("vault-%s-%s", vr.Namespace, vr.Name),
+				"rules": rules,
+			},
+		},
+	}
+	return obj
+}
+
+func newMonitoringObject(vr *api.VaultService, kind string) *unstructured.Unstructured {
+	labels := LabelsForVault(vr.Name)
+	for k, v := range vr.Spec.Monitoring.ServiceMonitor.Labels {
+		labels[k] = v
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(monitoringGroupVersion.String())
+	obj.SetKind(kind)
+	obj.SetName(vr.Name)
+	obj.SetNamespace(vr.Namespace)
+	obj.SetLabels(labels)
+	obj.SetOwnerReferences([]metav1.OwnerReference{AsOwner(vr)})
+	return obj
+}
+
+func newAlert(name, expr, forDuration, severity, summary, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"alert": name,
+		"expr":  expr,
+		"for":   forDuration,
+		"labels": map[string]interface{}{
+			"severity": severity,
+		},
+		"annotations": map[string]interface{}{
+			"summary":     summary,
+			"description": description,
+		},
+	}
+}
+
+func newLatencyAlert(expr string) map[string]interface{} {
+	return newAlert("VaultHighRequestLatency", expr, "10m", "warning", "Vault requests are slow",
+		"99th percentile of the request latency of Vault pod {{ $labels.pod }} in {{ $labels.namespace }} is above 500ms.")
+}
+
+// toInterfaceMap converts m to the map type of the unstructured objects.
+func toInterfaceMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	etcdClientPort = 2379
+	etcdPeerPort   = 2380
+)
+
+// VaultNetworkPolicyName returns the name of the NetworkPolicy of the vault pods of the given vault.
+func VaultNetworkPolicyName(name string) string {
+	return name + "-vault"
+}
+
+// EtcdNetworkPolicyName returns the name of the NetworkPolicy of the etcd pods of the given vault.
+func EtcdNetworkPolicyName(name string) string {
+	return name + "-etcd"
+}
+
+// OperatorPeer returns the peer selecting the pods of an operator with the given pod labels.
+// If the operator runs in another namespace than the vault cluster, or in an unknown namespace,
+// its pods are selected in all namespaces, since namespaces cannot be selected by name.
+func OperatorPeer(podLabels map[string]string, operatorNamespace, namespace string) networkingv1.NetworkPolicyPeer {
+	peer := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: podLabels},
+	}
+	if operatorNamespace != namespace {
+		peer.NamespaceSelector = &metav1.LabelSelector{}
+	}
+	return peer
+}
+
+// NewVaultNetworkPolicies returns the NetworkPolicies of the vault and etcd pods of the vault cluster.
+// The vault pods accept:
+// - the clients, the vault nodes and the vault operator on the client port
+// - the vault nodes on the cluster port
+// - Prometheus on the metrics port
+// The etcd pods accept:
+// - the vault nodes, the etcd members and the etcd operators on the client port
+// - the etcd members on the peer port
+func NewVaultNetworkPolicies(v *api.VaultService, vaultOperator networkingv1.NetworkPolicyPeer, etcdOperators []networkingv1.NetworkPolicyPeer) []*networkingv1.NetworkPolicy {
+	spec := v.Spec.NetworkPolicy
+	vaultPods := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: LabelsForVault(v.Name)},
+	}
+	etcdPods := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: LabelsForEtcd(v.Name)},
+	}
+
+	clientPeers := append([]networkingv1.NetworkPolicyPeer{vaultPods, vaultOperator}, spec.Clients...)
+	vaultRules := []networkingv1.NetworkPolicyIngressRule{
+		ingressRule(VaultClientPort, clientPeers),
+		ingressRule(vaultClusterPort, []networkingv1.NetworkPolicyPeer{vaultPods}),
+	}
+	if len(spec.Prometheus) != 0 {
+		switch api.TelemetryTypeOf(&v.Spec) {
+		case api.TelemetryStatsd:
+			vaultRules = append(vaultRules, ingressRule(exporterPromPort, spec.Prometheus))
+		case api.TelemetryPrometheus:
+			vaultRules = append(vaultRules, ingressRule(VaultClientPort, spec.Prometheus))
+		}
+	}
+
+	etcdClientPeers := append([]networkingv1.NetworkPolicyPeer{vaultPods, etcdPods}, etcdOperators...)
+	etcdRules := []networkingv1.NetworkPolicyIngressRule{
+		ingressRule(etcdClientPort, etcdClientPeers),
+		ingressRule(etcdPeerPort, []networkingv1.NetworkPolicyPeer{etcdPods}),
+	}
+
+	return []*networkingv1.NetworkPolicy{
+		newNetworkPolicy(v, VaultNetworkPolicyName(v.Name), LabelsForVault(v.Name), vaultRules),
+		newNetworkPolicy(v, EtcdNetworkPolicyName(v.Name), LabelsForEtcd(v.Name), etcdRules),
+	}
+}
+
+// LabelsForEtcd returns the labels the etcd operator sets on the etcd pods of the given vault.
+func LabelsForEtcd(vaultName string) map[string]string {
+	return map[string]string{"app": "etcd", "etcd_cluster": EtcdNameForVault(vaultName)}
+}
+
+func newNetworkPolicy(v *api.VaultService, name string, podLabels map[string]string, rules []networkingv1.NetworkPolicyIngressRule) *networkingv1.NetworkPolicy {
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: v.Namespace,
+			Labels:    LabelsForVault(v.Name),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: podLabels},
+			Ingress:     rules,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+		},
+	}
+	AddOwnerRefToObject(np, AsOwner(v))
+	return np
+}
+
+func ingressRule(port int, from []networkingv1.NetworkPolicyPeer) networkingv1.NetworkPolicyIngressRule {
+	tcp := v1.ProtocolTCP
+	p := intstr.FromInt(port)
+	return networkingv1.NetworkPolicyIngressRule{
+		Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &p}},
+		From:  from,
+	}
+}
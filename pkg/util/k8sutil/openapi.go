@@ -0,0 +1,127 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"reflect"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var (
+	quantityType    = reflect.TypeOf(resource.Quantity{})
+	intOrStringType = reflect.TypeOf(intstr.IntOrString{})
+	timeType        = reflect.TypeOf(metav1.Time{})
+)
+
+// CRValidation returns the structural OpenAPI v3 schema of a custom resource whose spec has the type of spec.
+// The status is written by the operator only and is not validated,
+// but its fields are preserved instead of pruned.
+func CRValidation(spec interface{}) *apiextensionsv1.CustomResourceValidation {
+	specSchema := OpenAPISchema(reflect.TypeOf(spec))
+	return &apiextensionsv1.CustomResourceValidation{
+		OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+			Type: "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"spec":   specSchema,
+				"status": {Type: "object", XPreserveUnknownFields: boolPtr(true)},
+			},
+		},
+	}
+}
+
+// OpenAPISchema returns the OpenAPI v3 schema of the JSON encoding of a value of type t.
+// Fields are named after their json tags. Types that encode to either
+// a string or a number, like resource.Quantity, are marked with x-kubernetes-int-or-string.
+func OpenAPISchema(t reflect.Type) apiextensionsv1.JSONSchemaProps {
+	switch t {
+	case quantityType, intOrStringType:
+		return apiextensionsv1.JSONSchemaProps{XIntOrString: true}
+	case timeType:
+		return apiextensionsv1.JSONSchemaProps{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return OpenAPISchema(t.Elem())
+	case reflect.String:
+		return apiextensionsv1.JSONSchemaProps{Type: "string"}
+	case reflect.Bool:
+		return apiextensionsv1.JSONSchemaProps{Type: "boolean"}
+	case reflect.Int32, reflect.Uint32:
+		return apiextensionsv1.JSONSchemaProps{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return apiextensionsv1.JSONSchemaProps{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Uint8, reflect.Uint16:
+		return apiextensionsv1.JSONSchemaProps{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return apiextensionsv1.JSONSchemaProps{Type: "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as a base64 string.
+			return apiextensionsv1.JSONSchemaProps{Type: "string", Format: "byte"}
+		}
+		items := OpenAPISchema(t.Elem())
+		return apiextensionsv1.JSONSchemaProps{
+			Type:  "array",
+			Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &items},
+		}
+	case reflect.Map:
+		values := OpenAPISchema(t.Elem())
+		return apiextensionsv1.JSONSchemaProps{
+			Type:                 "object",
+			AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &values},
+		}
+	case reflect.Struct:
+		s := apiextensionsv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{},
+		}
+		addStructProperties(t, s.Properties)
+		return s
+	}
+	// Structural schemas must be typed, so values of any other kind are kept as they are.
+	return apiextensionsv1.JSONSchemaProps{XPreserveUnknownFields: boolPtr(true)}
+}
+
+// addStructProperties adds the schemas of the JSON encoded fields of the struct type t to props.
+func addStructProperties(t reflect.Type, props map[string]apiextensionsv1.JSONSchemaProps) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || (len(f.PkgPath) != 0 && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && len(name) == 0 {
+			// Fields of embedded structs are inlined.
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructProperties(ft, props)
+				continue
+			}
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		props[name] = OpenAPISchema(f.Type)
+	}
+}
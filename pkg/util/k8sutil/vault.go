@@ -15,23 +15,29 @@
 package k8sutil
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"time"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
 
 	etcdCRAPI "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
-	etcdCRClient "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
 	vaultapi "github.com/hashicorp/vault/api"
-	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -43,6 +49,14 @@ var (
 	vaultConfigVolName   = "vault-config"
 	evnVaultRedirectAddr = "VAULT_API_ADDR"
 	evnVaultClusterAddr  = "VAULT_CLUSTER_ADDR"
+	envPodName           = "POD_NAME"
+
+	// StatsdExporterAddr is the address vault sends the statsd metrics to.
+	StatsdExporterAddr = fmt.Sprintf("localhost:%d", exporterStatsdPort)
+
+	statsdMappingVolName    = "statsd-mapping"
+	statsdMappingConfigDir  = "/etc/statsd-exporter"
+	statsdMappingConfigFile = "statsd-mapping.conf"
 )
 
 const (
@@ -54,6 +68,19 @@ const (
 	exporterStatsdPort = 9125
 	exporterPromPort   = 9102
 	exporterImage      = "prom/statsd-exporter:v0.5.0"
+
+	// etcdScopeAnnotation selects the etcd operator that manages an etcd cluster,
+	// see etcd-operator/doc/user/clusterwide.md
+	etcdScopeAnnotation  = "etcd.database.coreos.com/scope"
+	etcdScopeClusterWide = "clusterwide"
+
+	// VaultConfigHashAnnotation holds the hash of the vault config in the pod template
+	// of the vault nodes, so that the nodes are rolled out when the config changes.
+	// The operator folds the server certificate it manages into the hash, since the nodes load it at start.
+	VaultConfigHashAnnotation = "vault.security.coreos.com/config-hash"
+	// VaultPodTemplateHashAnnotation holds the hash of the pod template of the vault nodes,
+	// including the config hash, so that the nodes are rolled out when the pod template changes.
+	VaultPodTemplateHashAnnotation = "vault.security.coreos.com/pod-template-hash"
 )
 
 // EtcdClientTLSSecretName returns the name of etcd client TLS secret for the given vault name
@@ -71,10 +98,16 @@ func EtcdPeerTLSSecretName(vaultName string) string {
 	return vaultName + "-etcd-peer-tls"
 }
 
+// VaultCATLSSecretName returns the name of the secret holding the CA of the default vault TLS secrets for the given vault name
+func VaultCATLSSecretName(vaultName string) string {
+	return vaultName + "-default-vault-ca-tls"
+}
+
 // DeployEtcdCluster creates an etcd cluster for the given vault's name via etcd operator and
 // waits for all of its members to be ready.
-func DeployEtcdCluster(etcdCRCli etcdCRClient.Interface, v *api.VaultService) error {
-	size := 3
+// If clusterWide is set, the etcd cluster is left to an etcd operator running in the cluster-wide mode.
+func DeployEtcdCluster(ctx context.Context, dynamicCli dynamic.Interface, v *api.VaultService, clusterWide bool) error {
+	size := v.Spec.Storage.Etcd.Size
 	etcdCluster := &etcdCRAPI.EtcdCluster{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       etcdCRAPI.EtcdClusterResourceKind,
@@ -104,11 +137,16 @@ func DeployEtcdCluster(etcdCRCli etcdCRClient.Interface, v *api.VaultService) er
 			},
 		},
 	}
-	if v.Spec.Pod != nil {
-		etcdCluster.Spec.Pod.Resources = v.Spec.Pod.Resources
+	if p := v.Spec.Pod; p != nil {
+		etcdCluster.Spec.Pod.Resources = p.Resources
+		etcdCluster.Spec.Pod.NodeSelector = p.NodeSelector
+		etcdCluster.Spec.Pod.Tolerations = p.Tolerations
+	}
+	if clusterWide {
+		etcdCluster.Annotations = map[string]string{etcdScopeAnnotation: etcdScopeClusterWide}
 	}
 	AddOwnerRefToObject(etcdCluster, AsOwner(v))
-	_, err := etcdCRCli.EtcdV1beta2().EtcdClusters(v.Namespace).Create(etcdCluster)
+	err := createEtcdObject(ctx, dynamicCli, EtcdClusterResource, v.Namespace, etcdCluster)
 	if err != nil {
 		if apierrors.IsAlreadyExists(err) {
 			return nil
@@ -117,7 +155,7 @@ func DeployEtcdCluster(etcdCRCli etcdCRClient.Interface, v *api.VaultService) er
 	}
 
 	err = retryutil.Retry(10*time.Second, 10, func() (bool, error) {
-		er, err := etcdCRCli.EtcdV1beta2().EtcdClusters(v.Namespace).Get(EtcdNameForVault(v.Name), metav1.GetOptions{})
+		er, err := GetEtcdCluster(ctx, dynamicCli, v.Namespace, EtcdNameForVault(v.Name))
 		if err != nil {
 			return false, err
 		}
@@ -133,8 +171,8 @@ func DeployEtcdCluster(etcdCRCli etcdCRClient.Interface, v *api.VaultService) er
 }
 
 // DeleteEtcdCluster deletes the etcd cluster for the given vault
-func DeleteEtcdCluster(etcdCRCli etcdCRClient.Interface, v *api.VaultService) error {
-	err := etcdCRCli.EtcdV1beta2().EtcdClusters(v.Namespace).Delete(EtcdNameForVault(v.Name), nil)
+func DeleteEtcdCluster(ctx context.Context, dynamicCli dynamic.Interface, v *api.VaultService) error {
+	err := dynamicCli.Resource(EtcdClusterResource).Namespace(v.Namespace).Delete(ctx, EtcdNameForVault(v.Name), metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
@@ -142,6 +180,36 @@ func DeleteEtcdCluster(etcdCRCli etcdCRClient.Interface, v *api.VaultService) er
 }
 
 func vaultContainer(v *api.VaultService) v1.Container {
+	// Standby nodes redirect the clients to the api_addr of the active node,
+	// which has to be reachable by off-cluster clients if the vault cluster is exposed.
+	apiAddr := VaultExternalURL(v)
+	clusterAddr := VaultServiceURL(v.GetName(), v.GetNamespace(), vaultClusterPort)
+	var env []v1.EnvVar
+	if api.WorkloadKindOf(&v.Spec) == api.WorkloadKindStatefulSet {
+		// Every node advertises its own DNS name in the headless service.
+		env = append(env, v1.EnvVar{
+			Name: envPodName,
+			ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		})
+		podURL := fmt.Sprintf("https://$(%s).%s.%s.svc", envPodName, HeadlessServiceName(v.GetName()), v.GetNamespace())
+		clusterAddr = fmt.Sprintf("%s:%d", podURL, vaultClusterPort)
+		if len(apiAddr) == 0 {
+			apiAddr = fmt.Sprintf("%s:%d", podURL, VaultClientPort)
+		}
+	}
+	if len(apiAddr) == 0 {
+		apiAddr = VaultServiceURL(v.GetName(), v.GetNamespace(), VaultClientPort)
+	}
+	env = append(env, v1.EnvVar{
+		Name:  evnVaultRedirectAddr,
+		Value: apiAddr,
+	}, v1.EnvVar{
+		Name:  evnVaultClusterAddr,
+		Value: clusterAddr,
+	})
+
 	return v1.Container{
 		Name:  "vault",
 		Image: fmt.Sprintf("%s:%s", v.Spec.BaseImage, v.Spec.Version),
@@ -150,16 +218,7 @@ func vaultContainer(v *api.VaultService) v1.Container {
 			"server",
 			"-config=" + VaultConfigPath,
 		},
-		Env: []v1.EnvVar{
-			{
-				Name:  evnVaultRedirectAddr,
-				Value: VaultServiceURL(v.GetName(), v.GetNamespace(), VaultClientPort),
-			},
-			{
-				Name:  evnVaultClusterAddr,
-				Value: VaultServiceURL(v.GetName(), v.GetNamespace(), vaultClusterPort),
-			},
-		},
+		Env: env,
 		VolumeMounts: []v1.VolumeMount{{
 			Name:      vaultConfigVolName,
 			MountPath: filepath.Dir(VaultConfigPath),
@@ -179,7 +238,7 @@ func vaultContainer(v *api.VaultService) v1.Container {
 			ContainerPort: int32(vaultClusterPort),
 		}},
 		LivenessProbe: &v1.Probe{
-			Handler: v1.Handler{
+			ProbeHandler: v1.ProbeHandler{
 				Exec: &v1.ExecAction{
 					Command: []string{
 						"curl",
@@ -195,8 +254,10 @@ func vaultContainer(v *api.VaultService) v1.Container {
 			PeriodSeconds:       60,
 			FailureThreshold:    3,
 		},
+		// Only the active node is ready, so that the services route the clients to it
+		// and the deployment cannot finish an upgrade by replacing the active node itself.
 		ReadinessProbe: &v1.Probe{
-			Handler: v1.Handler{
+			ProbeHandler: v1.ProbeHandler{
 				HTTPGet: &v1.HTTPGetAction{
 					Path:   "/v1/sys/health",
 					Port:   intstr.FromInt(VaultClientPort),
@@ -211,8 +272,8 @@ func vaultContainer(v *api.VaultService) v1.Container {
 	}
 }
 
-func statsdExporterContainer() v1.Container {
-	return v1.Container{
+func statsdExporterContainer(s *api.StatsdTelemetrySpec) v1.Container {
+	c := v1.Container{
 		Name:  "statsd-exporter",
 		Image: exporterImage,
 		Ports: []v1.ContainerPort{{
@@ -225,15 +286,79 @@ func statsdExporterContainer() v1.Container {
 			Protocol:      "TCP",
 		}},
 	}
+	if s == nil {
+		return c
+	}
+	if len(s.Image) != 0 {
+		c.Image = s.Image
+	}
+	if len(s.MappingConfigMapName) != 0 {
+		c.Args = []string{"--statsd.mapping-config=" + filepath.Join(statsdMappingConfigDir, statsdMappingConfigFile)}
+		c.VolumeMounts = []v1.VolumeMount{{
+			Name:      statsdMappingVolName,
+			MountPath: statsdMappingConfigDir,
+		}}
+	}
+	return c
+}
+
+// configTelemetry adds the statsd-exporter sidecar to the pod template if vault sends its metrics to statsd.
+func configTelemetry(podTempl *v1.PodTemplateSpec, v *api.VaultService) {
+	if api.TelemetryTypeOf(&v.Spec) != api.TelemetryStatsd {
+		return
+	}
+	var s *api.StatsdTelemetrySpec
+	if v.Spec.Telemetry != nil {
+		s = v.Spec.Telemetry.Statsd
+	}
+	podTempl.Spec.Containers = append(podTempl.Spec.Containers, statsdExporterContainer(s))
+	if s == nil || len(s.MappingConfigMapName) == 0 {
+		return
+	}
+	podTempl.Spec.Volumes = append(podTempl.Spec.Volumes, v1.Volume{
+		Name: statsdMappingVolName,
+		VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{
+					Name: s.MappingConfigMapName,
+				},
+			},
+		},
+	})
 }
 
 // DeployVault deploys a vault service.
-// DeployVault is a multi-steps process. It creates the deployment, the service and
+// DeployVault is a multi-steps process. It creates the deployment or statefulset, the services and
 // other related Kubernetes objects for Vault. Any intermediate step can fail.
 //
 // DeployVault is idempotent. If an object already exists, this function will ignore creating
 // it and return no error. It is safe to retry on this function.
-func DeployVault(kubecli kubernetes.Interface, v *api.VaultService) error {
+//
+// configHash is the hash of the vault config the vault nodes start with, see VaultConfigHash.
+func DeployVault(ctx context.Context, kubecli kubernetes.Interface, v *api.VaultService, configHash string) error {
+	var err error
+	if api.WorkloadKindOf(&v.Spec) == api.WorkloadKindStatefulSet {
+		ss := NewVaultStatefulSet(v, VaultImage(v.Spec), configHash)
+		_, err = kubecli.AppsV1().StatefulSets(v.Namespace).Create(ctx, ss, metav1.CreateOptions{})
+	} else {
+		_, err = kubecli.AppsV1().Deployments(v.Namespace).Create(ctx, newVaultDeployment(v, configHash), metav1.CreateOptions{})
+	}
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	for _, svc := range NewVaultServices(v) {
+		_, err = kubecli.CoreV1().Services(v.Namespace).Create(ctx, svc, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create vault service (%s): %v", svc.Name, err)
+		}
+	}
+	return nil
+}
+
+// NewVaultPodTemplate returns the pod template of the vault nodes running the vault config with the given hash.
+// It records its own hash, see PodTemplateHash. The vault image is set by the workloads.
+func NewVaultPodTemplate(v *api.VaultService, configHash string) v1.PodTemplateSpec {
 	selector := LabelsForVault(v.GetName())
 
 	podTempl := v1.PodTemplateSpec{
@@ -242,7 +367,7 @@ func DeployVault(kubecli kubernetes.Interface, v *api.VaultService) error {
 			Labels: selector,
 		},
 		Spec: v1.PodSpec{
-			Containers: []v1.Container{vaultContainer(v), statsdExporterContainer()},
+			Containers: []v1.Container{vaultContainer(v)},
 			Volumes: []v1.Volume{{
 				Name: vaultConfigVolName,
 				VolumeSource: v1.VolumeSource{
@@ -255,25 +380,39 @@ func DeployVault(kubecli kubernetes.Interface, v *api.VaultService) error {
 			}},
 		},
 	}
+	configTelemetry(&podTempl, v)
 	if v.Spec.Pod != nil {
-		applyPodPolicy(&podTempl.Spec, v.Spec.Pod)
+		applyPodPolicy(&podTempl, v.Spec.Pod)
+	}
+	if podTempl.Spec.Affinity == nil {
+		podTempl.Spec.Affinity = &v1.Affinity{}
+	}
+	if podTempl.Spec.Affinity.PodAntiAffinity == nil {
+		podTempl.Spec.Affinity.PodAntiAffinity = vaultPodAntiAffinity(selector)
 	}
 
 	configEtcdBackendTLS(&podTempl, v)
 	configVaultServerTLS(&podTempl, v)
+	setPodTemplateAnnotation(&podTempl, VaultConfigHashAnnotation, configHash)
+	setPodTemplateHash(&podTempl)
+	return podTempl
+}
 
-	d := &appsv1beta1.Deployment{
+// newVaultDeployment returns the deployment of the vault nodes.
+func newVaultDeployment(v *api.VaultService, configHash string) *appsv1.Deployment {
+	selector := LabelsForVault(v.GetName())
+	d := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   v.GetName(),
 			Labels: selector,
 		},
-		Spec: appsv1beta1.DeploymentSpec{
+		Spec: appsv1.DeploymentSpec{
 			Replicas: &v.Spec.Nodes,
 			Selector: &metav1.LabelSelector{MatchLabels: selector},
-			Template: podTempl,
-			Strategy: appsv1beta1.DeploymentStrategy{
-				Type: appsv1beta1.RollingUpdateDeploymentStrategyType,
-				RollingUpdate: &appsv1beta1.RollingUpdateDeployment{
+			Template: NewVaultPodTemplate(v, configHash),
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
 					MaxUnavailable: func(a intstr.IntOrString) *intstr.IntOrString { return &a }(intstr.FromInt(1)),
 					MaxSurge:       func(a intstr.IntOrString) *intstr.IntOrString { return &a }(intstr.FromInt(1)),
 				},
@@ -281,18 +420,172 @@ func DeployVault(kubecli kubernetes.Interface, v *api.VaultService) error {
 		},
 	}
 	AddOwnerRefToObject(d, AsOwner(v))
-	_, err := kubecli.AppsV1beta1().Deployments(v.Namespace).Create(d)
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return err
+	return d
+}
+
+// NewVaultStatefulSet returns the statefulset of the vault nodes running the given vault image and config.
+// Its pods are named <name>-<ordinal> and are addressed through the headless service.
+// It leaves replacing its pods to the operator (OnDelete), see UpdateStatefulSetImage.
+func NewVaultStatefulSet(v *api.VaultService, image, configHash string) *appsv1.StatefulSet {
+	selector := LabelsForVault(v.GetName())
+	podTempl := NewVaultPodTemplate(v, configHash)
+	podTempl.Spec.Containers[0].Image = image
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   v.GetName(),
+			Labels: selector,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &v.Spec.Nodes,
+			Selector:    &metav1.LabelSelector{MatchLabels: selector},
+			Template:    podTempl,
+			ServiceName: HeadlessServiceName(v.GetName()),
+			// Sealed nodes are not ready, so they must not block starting the other nodes.
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			UpdateStrategy:      appsv1.StatefulSetUpdateStrategy{Type: appsv1.OnDeleteStatefulSetStrategyType},
+		},
+	}
+	AddOwnerRefToObject(ss, AsOwner(v))
+	return ss
+}
+
+// UpgradeDeployment sets deployment spec to:
+// - roll forward to the given vault image
+// - keep active Vault node available by setting `maxUnavailable=N-1` and `maxSurge=1`
+func UpgradeDeployment(ctx context.Context, kubecli kubernetes.Interface, vr *api.VaultService, d *appsv1.Deployment, image string) error {
+	mu := intstr.FromInt(int(vr.Spec.Nodes - 1))
+	d.Spec.Strategy.RollingUpdate.MaxUnavailable = &mu
+	d.Spec.Template.Spec.Containers[0].Image = image
+	_, err := kubecli.AppsV1().Deployments(d.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to upgrade deployment to (%s): %v", image, err)
+	}
+	return nil
+}
+
+// RollbackDeployment rolls the deployment back to the given vault image.
+// The nodes of the new version are not ready, so they are replaced one at a time
+// by setting `maxUnavailable=1` and `maxSurge=1`.
+func RollbackDeployment(ctx context.Context, kubecli kubernetes.Interface, d *appsv1.Deployment, image string) error {
+	mu := intstr.FromInt(1)
+	d.Spec.Strategy.RollingUpdate.MaxUnavailable = &mu
+	d.Spec.Template.Spec.Containers[0].Image = image
+	_, err := kubecli.AppsV1().Deployments(d.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to roll back deployment to (%s): %v", image, err)
+	}
+	return nil
+}
+
+// UpdateStatefulSetImage sets the vault image of the pod template of the statefulset.
+// The statefulset leaves replacing its pods to the operator (OnDelete), which replaces the
+// standby nodes first and the active node last.
+func UpdateStatefulSetImage(ctx context.Context, kubecli kubernetes.Interface, ss *appsv1.StatefulSet, image string) error {
+	ss.Spec.Template.Spec.Containers[0].Image = image
+	_, err := kubecli.AppsV1().StatefulSets(ss.Namespace).Update(ctx, ss, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update the image of statefulset (%s) to (%s): %v", ss.Name, image, err)
+	}
+	return nil
+}
+
+// VaultConfigHash returns the hash of the rendered vault config data.
+func VaultConfigHash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// PodVaultConfigHash returns the hash of the vault config the pods of the pod template run with,
+// or an empty string for pod templates created before the hash was recorded.
+func PodVaultConfigHash(pt *v1.PodTemplateSpec) string {
+	return pt.Annotations[VaultConfigHashAnnotation]
+}
+
+// PodTemplateHash returns the hash of the pod template of the vault nodes, see NewVaultPodTemplate,
+// or an empty string for pod templates created before the hash was recorded.
+func PodTemplateHash(pt *v1.PodTemplateSpec) string {
+	return pt.Annotations[VaultPodTemplateHashAnnotation]
+}
+
+// setPodTemplateHash records the hash of the pod template in its annotations.
+// The vault image is left out, since it is changed by the upgrades only.
+func setPodTemplateHash(pt *v1.PodTemplateSpec) {
+	c := pt.DeepCopy()
+	c.Spec.Containers[0].Image = ""
+	// A pod template always marshals.
+	data, _ := json.Marshal(c)
+	sum := sha256.Sum256(data)
+	setPodTemplateAnnotation(pt, VaultPodTemplateHashAnnotation, hex.EncodeToString(sum[:]))
+}
+
+// setPodTemplateAnnotation sets an annotation of the pod template.
+// The annotations are copied, since they may be shared with spec.pod.annotations.
+func setPodTemplateAnnotation(pt *v1.PodTemplateSpec, key, value string) {
+	annotations := make(map[string]string, len(pt.Annotations)+1)
+	for k, val := range pt.Annotations {
+		annotations[k] = val
 	}
+	annotations[key] = value
+	pt.Annotations = annotations
+}
+
+// CanaryPodName returns the name of the canary pod of an upgrade of the given vault.
+func CanaryPodName(name string) string {
+	return name + "-canary"
+}
 
+// NewCanaryPod returns the canary pod of an upgrade, which runs the given vault image
+// with the pod template of the deployment or statefulset. It joins the vault cluster as an additional node.
+// The pod is controlled by the vault CR, so that the replica set or statefulset does not adopt it.
+func NewCanaryPod(vr *api.VaultService, podTempl *v1.PodTemplateSpec, image string) *v1.Pod {
+	pt := podTempl.DeepCopy()
+	pt.Spec.Containers[0].Image = image
+	p := &v1.Pod{
+		ObjectMeta: pt.ObjectMeta,
+		Spec:       pt.Spec,
+	}
+	p.Name = CanaryPodName(vr.Name)
+	p.Namespace = vr.Namespace
+	if api.WorkloadKindOf(&vr.Spec) == api.WorkloadKindStatefulSet {
+		// Like the statefulset pods, the canary pod gets a DNS name in the headless service.
+		p.Spec.Hostname = p.Name
+		p.Spec.Subdomain = HeadlessServiceName(vr.Name)
+	}
+	AddOwnerRefToObject(p, AsOwner(vr))
+	return p
+}
+
+// NewVaultServices returns the services of the vault cluster:
+// - the service of all unsealed vault nodes, named after the vault cluster
+// - the "-active" service of the active vault node
+// - the "-standby" service of the standby vault nodes, e.g. for performance standby reads
+// - the "-headless" service giving every vault node a DNS name, if the nodes run in a statefulset
+func NewVaultServices(v *api.VaultService) []*v1.Service {
+	svcs := []*v1.Service{
+		newVaultService(v, v.Name, ""),
+		newVaultService(v, ActiveServiceName(v.Name), VaultRoleActive),
+		newVaultService(v, StandbyServiceName(v.Name), VaultRoleStandby),
+	}
+	if api.WorkloadKindOf(&v.Spec) == api.WorkloadKindStatefulSet {
+		svcs = append(svcs, newVaultHeadlessService(v))
+	}
+	return svcs
+}
+
+// newVaultHeadlessService returns the headless service of the vault nodes, which gives
+// every node the DNS name <pod>.<name>-headless.<namespace>.svc.
+// Sealed nodes are not ready, and still need their DNS name to join the cluster.
+func newVaultHeadlessService(v *api.VaultService) *v1.Service {
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   v.Name,
-			Labels: selector,
+			Name:   HeadlessServiceName(v.Name),
+			Labels: LabelsForVault(v.Name),
 		},
 		Spec: v1.ServiceSpec{
-			Selector: selector,
+			Type:                     v1.ServiceTypeClusterIP,
+			ClusterIP:                v1.ClusterIPNone,
+			Selector:                 LabelsForVault(v.Name),
+			PublishNotReadyAddresses: true,
 			Ports: []v1.ServicePort{
 				{
 					Name:     vaultClientPortName,
@@ -304,37 +597,114 @@ func DeployVault(kubecli kubernetes.Interface, v *api.VaultService) error {
 					Protocol: v1.ProtocolTCP,
 					Port:     vaultClusterPort,
 				},
+			},
+		},
+	}
+	AddOwnerRefToObject(svc, AsOwner(v))
+	return svc
+}
+
+// newVaultService returns the service of the vault nodes with the given role,
+// or of all vault nodes if role is empty.
+func newVaultService(v *api.VaultService, name, role string) *v1.Service {
+	labels := LabelsForVault(v.Name)
+	selector := LabelsForVault(v.Name)
+	if len(role) != 0 {
+		labels[VaultRoleLabel] = role
+		selector[VaultRoleLabel] = role
+	}
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: v1.ServiceSpec{
+			Type:     v1.ServiceTypeClusterIP,
+			Selector: selector,
+			Ports: []v1.ServicePort{
+				{
+					Name:     vaultClientPortName,
+					Protocol: v1.ProtocolTCP,
+					Port:     VaultClientPort,
+				},
 				{
-					Name:     "prometheus",
+					Name:     vaultClusterPortName,
 					Protocol: v1.ProtocolTCP,
-					Port:     exporterPromPort,
+					Port:     vaultClusterPort,
 				},
 			},
 		},
 	}
+	// The statsd-exporters are scraped through the service of all vault nodes only.
+	if len(role) == 0 && api.TelemetryTypeOf(&v.Spec) == api.TelemetryStatsd {
+		svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{
+			Name:     "prometheus",
+			Protocol: v1.ProtocolTCP,
+			Port:     exporterPromPort,
+		})
+	}
+	if s := v.Spec.Service; s != nil {
+		svc.Annotations = s.Annotations
+		if len(s.Type) != 0 {
+			svc.Spec.Type = s.Type
+		}
+		svc.Spec.LoadBalancerSourceRanges = s.LoadBalancerSourceRanges
+		svc.Spec.ExternalTrafficPolicy = s.ExternalTrafficPolicy
+	}
+	// Set the default of the API server, so that the service can be compared with the existing one.
+	if svc.Spec.Type == v1.ServiceTypeNodePort || svc.Spec.Type == v1.ServiceTypeLoadBalancer {
+		if len(svc.Spec.ExternalTrafficPolicy) == 0 {
+			svc.Spec.ExternalTrafficPolicy = v1.ServiceExternalTrafficPolicyTypeCluster
+		}
+	}
 	AddOwnerRefToObject(svc, AsOwner(v))
-	_, err = kubecli.CoreV1().Services(v.Namespace).Create(svc)
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return fmt.Errorf("failed to create vault service: %v", err)
+	return svc
+}
+
+// vaultPodAntiAffinity returns the default pod anti-affinity of the vault pods,
+// which prefers spreading them over hosts first and zones second.
+func vaultPodAntiAffinity(selector map[string]string) *v1.PodAntiAffinity {
+	term := func(weight int32, topologyKey string) v1.WeightedPodAffinityTerm {
+		return v1.WeightedPodAffinityTerm{
+			Weight: weight,
+			PodAffinityTerm: v1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: selector},
+				TopologyKey:   topologyKey,
+			},
+		}
+	}
+	return &v1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+			term(100, v1.LabelHostname),
+			term(50, v1.LabelTopologyZone),
+		},
 	}
-	return nil
 }
 
-// UpgradeDeployment sets deployment spec to:
-// - roll forward version
-// - keep active Vault node available by setting `maxUnavailable=N-1` and `maxSurge=1`
-func UpgradeDeployment(kubecli kubernetes.Interface, vr *api.VaultService, d *appsv1beta1.Deployment) error {
-	mu := intstr.FromInt(int(vr.Spec.Nodes - 1))
-	d.Spec.Strategy.RollingUpdate.MaxUnavailable = &mu
-	d.Spec.Template.Spec.Containers[0].Image = vaultImage(vr.Spec)
-	_, err := kubecli.AppsV1beta1().Deployments(d.Namespace).Update(d)
-	if err != nil {
-		return fmt.Errorf("failed to upgrade deployment to (%s): %v", vaultImage(vr.Spec), err)
+// NewVaultPodDisruptionBudget returns the PodDisruptionBudget of the vault cluster,
+// which keeps the active vault node, the only ready one, available during voluntary disruptions.
+// The standby nodes are not ready, so they can be evicted while the active node is available.
+func NewVaultPodDisruptionBudget(v *api.VaultService) *policyv1.PodDisruptionBudget {
+	selector := LabelsForVault(v.GetName())
+	minAvailable := intstr.FromInt(1)
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v.GetName(),
+			Namespace: v.GetNamespace(),
+			Labels:    selector,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: selector},
+		},
 	}
-	return nil
+	AddOwnerRefToObject(pdb, AsOwner(v))
+	return pdb
 }
 
-func applyPodPolicy(s *v1.PodSpec, p *api.PodPolicy) {
+func applyPodPolicy(pt *v1.PodTemplateSpec, p *api.PodPolicy) {
+	s := &pt.Spec
 	for i := range s.Containers {
 		s.Containers[i].Resources = p.Resources
 	}
@@ -342,25 +712,71 @@ func applyPodPolicy(s *v1.PodSpec, p *api.PodPolicy) {
 	for i := range s.InitContainers {
 		s.InitContainers[i].Resources = p.Resources
 	}
+
+	// The selector labels of the pod template must not be overridden.
+	labels := map[string]string{}
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+	for k, v := range pt.Labels {
+		labels[k] = v
+	}
+	pt.Labels = labels
+	if len(p.Annotations) != 0 {
+		pt.Annotations = p.Annotations
+	}
+
+	s.NodeSelector = p.NodeSelector
+	// The affinity is copied, since the default pod anti-affinity may be added to it.
+	s.Affinity = p.Affinity.DeepCopy()
+	s.Tolerations = p.Tolerations
+	s.TopologySpreadConstraints = p.TopologySpreadConstraints
+	s.PriorityClassName = p.PriorityClassName
+	s.ServiceAccountName = p.ServiceAccountName
+	s.ImagePullSecrets = p.ImagePullSecrets
+	s.SecurityContext = p.SecurityContext
+}
+
+// VaultImage returns the vault image of the given vault spec.
+func VaultImage(vs api.VaultServiceSpec) string {
+	return VaultVersionImage(vs, vs.Version)
 }
 
-func vaultImage(vs api.VaultServiceSpec) string {
-	return fmt.Sprintf("%s:%s", vs.BaseImage, vs.Version)
+// VaultVersionImage returns the image of the given vault version from the base image of the vault spec.
+func VaultVersionImage(vs api.VaultServiceSpec, version string) string {
+	return fmt.Sprintf("%s:%s", vs.BaseImage, version)
 }
 
 func IsVaultVersionMatch(ps v1.PodSpec, vs api.VaultServiceSpec) bool {
-	return ps.Containers[0].Image == vaultImage(vs)
+	return ps.Containers[0].Image == VaultImage(vs)
+}
+
+// PodVaultImage returns the vault image of the given pod spec.
+func PodVaultImage(ps v1.PodSpec) string {
+	return ps.Containers[0].Image
+}
+
+// ImageVersion returns the tag of the given vault image, which is the vault version.
+func ImageVersion(image string) string {
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+		return image[i+1:]
+	}
+	return ""
 }
 
 // VaultTLSFromSecret reads Vault CR's TLS secret and converts it into a vault client's TLS config struct.
-func VaultTLSFromSecret(kubecli kubernetes.Interface, vr *api.VaultService) (*vaultapi.TLSConfig, error) {
+func VaultTLSFromSecret(ctx context.Context, kubecli kubernetes.Interface, vr *api.VaultService) (*vaultapi.TLSConfig, error) {
 	secretName := vr.Spec.TLS.Static.ClientSecret
 
-	secret, err := kubecli.CoreV1().Secrets(vr.GetNamespace()).Get(secretName, metav1.GetOptions{})
+	secret, err := kubecli.CoreV1().Secrets(vr.GetNamespace()).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("read client tls failed: failed to get secret (%s): %v", secretName, err)
 	}
+	return VaultTLSFromSecretData(secret)
+}
 
+// VaultTLSFromSecretData converts the given Vault client TLS secret into a vault client's TLS config struct.
+func VaultTLSFromSecretData(secret *v1.Secret) (*vaultapi.TLSConfig, error) {
 	// Read the secret and write ca.crt to a temporary file
 	caCertData := secret.Data[api.CATLSCertName]
 	f, err := ioutil.TempFile("", api.CATLSCertName)
@@ -389,6 +805,13 @@ func IsPodReady(p v1.Pod) bool {
 	return false
 }
 
+// IsPodUnsealed returns whether the last health check found the vault node of the pod unsealed,
+// active or standby, see VaultRoleLabel. Only the active node is ready, see NewVaultPodTemplate.
+func IsPodUnsealed(p v1.Pod) bool {
+	role := p.Labels[VaultRoleLabel]
+	return role == VaultRoleActive || role == VaultRoleStandby
+}
+
 // ConfigMapNameForVault is the configmap name for the given vault.
 // If ConfigMapName is given is spec, it will make a new name based on that.
 // Otherwise, we will create a default configmap using the Vault's name.
@@ -407,23 +830,30 @@ func VaultServiceURL(name, namespace string, port int) string {
 
 // DestroyVault destroys a vault service.
 // TODO: remove this function when CRD GC is enabled.
-func DestroyVault(kubecli kubernetes.Interface, v *api.VaultService) error {
-	bg := metav1.DeletePropagationBackground
-	do := &metav1.DeleteOptions{PropagationPolicy: &bg}
+func DestroyVault(ctx context.Context, kubecli kubernetes.Interface, v *api.VaultService) error {
+	do := CascadeDeleteBackground()
 
 	ns, n := v.GetNamespace(), v.GetName()
-	err := kubecli.AppsV1beta1().
+	err := kubecli.AppsV1().
 		Deployments(ns).
-		Delete(n, do)
+		Delete(ctx, n, do)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
-
-	err = kubecli.CoreV1().Services(ns).Delete(n, do)
+	err = kubecli.AppsV1().
+		StatefulSets(ns).
+		Delete(ctx, n, do)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
 
+	for _, name := range []string{n, ActiveServiceName(n), StandbyServiceName(n), HeadlessServiceName(n)} {
+		err = kubecli.CoreV1().Services(ns).Delete(ctx, name, do)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -437,10 +867,46 @@ func EtcdURLForVault(name string) string {
 	return fmt.Sprintf("https://%s-client:2379", EtcdNameForVault(name))
 }
 
+// VaultClusterLabel is the label key holding the name of the vault cluster a resource belongs to.
+const VaultClusterLabel = "vault_cluster"
+
+// VaultRoleLabel is the label key holding the role of a vault pod, as seen by the last health check.
+// Sealed vault pods have no role.
+const VaultRoleLabel = "vault-role"
+
+const (
+	// VaultRoleActive is the role of the active vault pod.
+	VaultRoleActive = "active"
+	// VaultRoleStandby is the role of the unsealed standby vault pods.
+	VaultRoleStandby = "standby"
+)
+
+// ActiveServiceName returns the name of the service of the active node of the given vault.
+func ActiveServiceName(name string) string {
+	return name + "-active"
+}
+
+// StandbyServiceName returns the name of the service of the standby nodes of the given vault.
+func StandbyServiceName(name string) string {
+	return name + "-standby"
+}
+
+// HeadlessServiceName returns the name of the headless service of the nodes of the given vault,
+// which run in a statefulset.
+func HeadlessServiceName(name string) string {
+	return name + "-headless"
+}
+
+// VaultPodsSelector selects the pods of all vault clusters.
+var VaultPodsSelector = "app=vault," + VaultClusterLabel
+
+// VaultObjectsSelector selects the secrets and configmaps the operator creates for all vault clusters.
+var VaultObjectsSelector = "app=vault," + VaultClusterLabel
+
 // LabelsForVault returns the labels for selecting the resources
 // belonging to the given vault name.
 func LabelsForVault(name string) map[string]string {
-	return map[string]string{"app": "vault", "vault_cluster": name}
+	return map[string]string{"app": "vault", VaultClusterLabel: name}
 }
 
 // configEtcdBackendTLS configures the volume and mounts in vault pod to
@@ -479,5 +945,11 @@ func configVaultServerTLS(pt *v1.PodTemplateSpec, v *api.VaultService) {
 			},
 		},
 	}
-	pt.Spec.Volumes[1].VolumeSource.Projected.Sources = append(pt.Spec.Volumes[1].VolumeSource.Projected.Sources, serverTLSVolume)
+	// The TLS asset volume is added by configEtcdBackendTLS, after the volumes of the sidecars.
+	for i := range pt.Spec.Volumes {
+		if vol := &pt.Spec.Volumes[i]; vol.Name == vaultTLSAssetVolume {
+			vol.Projected.Sources = append(vol.Projected.Sources, serverTLSVolume)
+			return
+		}
+	}
 }
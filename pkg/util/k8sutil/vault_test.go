@@ -0,0 +1,99 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8sutil
+
+import (
+	"reflect"
+	"testing"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestVault() *api.VaultService {
+	vr := &api.VaultService{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+		Spec:       api.VaultServiceSpec{Nodes: 2, Version: "1.2.3"},
+	}
+	vr.SetDefaults()
+	return vr
+}
+
+func findVolume(pt *v1.PodTemplateSpec, name string) *v1.Volume {
+	for i := range pt.Spec.Volumes {
+		if pt.Spec.Volumes[i].Name == name {
+			return &pt.Spec.Volumes[i]
+		}
+	}
+	return nil
+}
+
+func TestNewVaultPodTemplateStatsdMapping(t *testing.T) {
+	vr := newTestVault()
+	vr.Spec.Telemetry = &api.TelemetrySpec{
+		Type:   api.TelemetryStatsd,
+		Statsd: &api.StatsdTelemetrySpec{MappingConfigMapName: "statsd-mapping"},
+	}
+	pt := NewVaultPodTemplate(vr, "hash")
+
+	mapping := findVolume(&pt, statsdMappingVolName)
+	if mapping == nil || mapping.ConfigMap == nil || mapping.ConfigMap.Name != "statsd-mapping" {
+		t.Errorf("expect the statsd mapping volume of configmap statsd-mapping, got %+v", mapping)
+	}
+	tls := findVolume(&pt, vaultTLSAssetVolume)
+	if tls == nil || tls.Projected == nil {
+		t.Fatalf("expect the projected TLS asset volume, got %+v", tls)
+	}
+	var secrets []string
+	for _, src := range tls.Projected.Sources {
+		secrets = append(secrets, src.Secret.Name)
+	}
+	want := []string{EtcdClientTLSSecretName(vr.Name), vr.Spec.TLS.Static.ServerSecret}
+	if !reflect.DeepEqual(secrets, want) {
+		t.Errorf("expect the TLS secrets %v, got %v", want, secrets)
+	}
+}
+
+func TestNewVaultPodTemplateAffinity(t *testing.T) {
+	vr := newTestVault()
+	nodeAffinity := &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{
+				MatchExpressions: []v1.NodeSelectorRequirement{{Key: "pool", Operator: v1.NodeSelectorOpIn, Values: []string{"vault"}}},
+			}},
+		},
+	}
+	vr.Spec.Pod = &api.PodPolicy{Affinity: &v1.Affinity{NodeAffinity: nodeAffinity}}
+	pt := NewVaultPodTemplate(vr, "hash")
+
+	a := pt.Spec.Affinity
+	if a == nil || !reflect.DeepEqual(a.NodeAffinity, nodeAffinity) {
+		t.Errorf("expect the given node affinity to be kept, got %+v", a)
+	}
+	if a == nil || !reflect.DeepEqual(a.PodAntiAffinity, vaultPodAntiAffinity(LabelsForVault(vr.Name))) {
+		t.Errorf("expect the default pod anti-affinity, got %+v", a)
+	}
+	if vr.Spec.Pod.Affinity.PodAntiAffinity != nil {
+		t.Errorf("expect the pod policy to be left unchanged, got %+v", vr.Spec.Pod.Affinity)
+	}
+
+	vr.Spec.Pod.Affinity.PodAntiAffinity = &v1.PodAntiAffinity{}
+	pt = NewVaultPodTemplate(vr, "hash")
+	if !reflect.DeepEqual(pt.Spec.Affinity.PodAntiAffinity, &v1.PodAntiAffinity{}) {
+		t.Errorf("expect the given pod anti-affinity to replace the default, got %+v", pt.Spec.Affinity.PodAntiAffinity)
+	}
+}
@@ -17,9 +17,18 @@ package vaultutil
 import (
 	"bytes"
 	"fmt"
-	"github.com/sirupsen/logrus"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
 
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/printer"
+	"github.com/hashicorp/hcl/hcl/token"
 	vaultapi "github.com/hashicorp/vault/api"
 )
 
@@ -38,6 +47,24 @@ listener "tcp" {
   cluster_address = "0.0.0.0:8201"
   tls_cert_file = "%s"
   tls_key_file  = "%s"
+%s}
+`
+
+var listenerTelemetry = `  telemetry {
+    unauthenticated_metrics_access = true
+  }
+`
+
+var statsdTelemetryFmt = `
+telemetry {
+  statsd_address = "%s"
+}
+`
+
+var prometheusTelemetryFmt = `
+telemetry {
+  prometheus_retention_time = "%s"
+  disable_hostname = true
 }
 `
 
@@ -53,40 +80,304 @@ storage "etcd" {
 }
 `
 
-// NewConfigWithDefaultParams appends to given config data some default params:
-// - telemetry setting
-// - tcp listener
-func NewConfigWithDefaultParams(data string) string {
-	buf := bytes.NewBufferString(data)
-	buf.WriteString(`ui = true
-telemetry {
-	statsd_address = "localhost:9125"
+// Sections of the vault config that the operator owns. They are replaced by the operator's sections.
+var (
+	listenerKeys = []string{"listener"}
+	storageKeys  = []string{"storage", "backend", "ha_storage", "ha_backend"}
+	sealKeys     = []string{"seal"}
+)
+
+// blockKeys are the keys of the sections that must be blocks, e.g. `telemetry { ... }`.
+var blockKeys = []string{"listener", "storage", "backend", "ha_storage", "ha_backend", "seal", "telemetry"}
+
+// Config is a vault config parsed from HCL or JSON, into which the operator merges its sections.
+// The sections of the user config are kept in order, the operator's sections are appended,
+// so the rendered config is the same for the same user config and spec.
+type Config struct {
+	items []*ast.ObjectItem
+
+	// replaced are the keys of the sections of the user config replaced by the operator.
+	replaced []string
+}
+
+// ParseConfig parses the vault config data, which is HCL or JSON.
+// It fails if the data cannot be parsed, or if a section owned or merged
+// by the operator is not a block.
+func ParseConfig(data string) (*Config, error) {
+	f, err := hcl.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("vault config is not an object")
+	}
+	for _, item := range list.Items {
+		key := itemKey(item)
+		if !containsKey(blockKeys, key) {
+			continue
+		}
+		if _, ok := item.Val.(*ast.ObjectType); !ok {
+			return nil, fmt.Errorf("At %s: %q must be a block", item.Pos(), key)
+		}
+	}
+	return &Config{items: list.Items}, nil
 }
-`)
 
-	logrus.Info("NewConfigWithDefaultParams: ", buf)
+// SetServerConfig sets the settings of spec.config, unless the config sets them already.
+func (c *Config) SetServerConfig(sc *api.ConfigSpec) {
+	if sc == nil {
+		return
+	}
+	if len(sc.LogLevel) != 0 {
+		c.setDefault("log_level", strconv.Quote(sc.LogLevel))
+	}
+	if len(sc.LogFormat) != 0 {
+		c.setDefault("log_format", strconv.Quote(string(sc.LogFormat)))
+	}
+	if len(sc.DefaultLeaseTTL) != 0 {
+		c.setDefault("default_lease_ttl", strconv.Quote(sc.DefaultLeaseTTL))
+	}
+	if len(sc.MaxLeaseTTL) != 0 {
+		c.setDefault("max_lease_ttl", strconv.Quote(sc.MaxLeaseTTL))
+	}
+	if sc.DisableMlock {
+		c.setDefault("disable_mlock", "true")
+	}
+	if sc.CacheSize != nil {
+		c.setDefault("cache_size", strconv.Itoa(int(*sc.CacheSize)))
+	}
+	if sc.UI != nil {
+		c.setDefault("ui", strconv.FormatBool(*sc.UI))
+	}
+	if len(sc.PluginDirectory) != 0 {
+		c.setDefault("plugin_directory", strconv.Quote(sc.PluginDirectory))
+	}
+	if len(sc.ClusterName) != 0 {
+		c.setDefault("cluster_name", strconv.Quote(sc.ClusterName))
+	}
+}
 
+// SetDefaultParams sets ui, unless the config sets it already, and replaces the listeners
+// of the config with the tcp listener, which serves the metrics without a token if
+// unauthenticatedMetrics is set.
+func (c *Config) SetDefaultParams(unauthenticatedMetrics bool) {
+	c.setDefault("ui", "true")
+
+	var telemetry string
+	if unauthenticatedMetrics {
+		telemetry = listenerTelemetry
+	}
 	listenerSection := fmt.Sprintf(listenerFmt,
 		filepath.Join(VaultTLSAssetDir, ServerTLSCertName),
-		filepath.Join(VaultTLSAssetDir, ServerTLSKeyName))
-	buf.WriteString(listenerSection)
+		filepath.Join(VaultTLSAssetDir, ServerTLSKeyName),
+		telemetry)
+	c.replace(listenerKeys, listenerSection)
+}
 
-	return buf.String()
+// SetStatsdTelemetry merges a telemetry section sending the metrics to the given statsd address
+// into the telemetry section of the config.
+func (c *Config) SetStatsdTelemetry(statsdAddr string) {
+	c.merge("telemetry", fmt.Sprintf(statsdTelemetryFmt, statsdAddr))
 }
 
-// NewConfigWithEtcd returns the new config data combining
-// original config and new etcd storage section.
-func NewConfigWithEtcd(data, etcdURL string) string {
+// SetPrometheusTelemetry merges a telemetry section exposing the metrics to Prometheus
+// into the telemetry section of the config.
+func (c *Config) SetPrometheusTelemetry(retentionTime string) {
+	c.merge("telemetry", fmt.Sprintf(prometheusTelemetryFmt, retentionTime))
+}
+
+// SetEtcdStorage replaces the storage sections of the config with the etcd storage section.
+func (c *Config) SetEtcdStorage(etcdURL string) {
 	storageSection := fmt.Sprintf(etcdStorageFmt, etcdURL, filepath.Join(VaultTLSAssetDir, "etcd-client-ca.crt"),
 		filepath.Join(VaultTLSAssetDir, "etcd-client.crt"), filepath.Join(VaultTLSAssetDir, "etcd-client.key"))
-	data = fmt.Sprintf("%s%s", data, storageSection)
-	return data
+	c.replace(storageKeys, storageSection)
+}
+
+// SetSeal replaces the seal sections of the config with a seal section of the given type and parameters.
+func (c *Config) SetSeal(sealType string, params map[string]string) {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	// Sort the parameters so that the config is stable across reconciles.
+	sort.Strings(keys)
+
+	buf := bytes.NewBufferString("")
+	fmt.Fprintf(buf, "\nseal %s {\n", strconv.Quote(sealType))
+	for _, k := range keys {
+		fmt.Fprintf(buf, "  %s = %s\n", k, strconv.Quote(params[k]))
+	}
+	buf.WriteString("}\n")
+	c.replace(sealKeys, buf.String())
+}
+
+// Replaced returns the keys of the sections of the user config that were replaced by the operator.
+func (c *Config) Replaced() []string {
+	return c.replaced
+}
+
+// Render returns the config in HCL.
+// It fails if the result is not a valid config with exactly one listener and storage section.
+func (c *Config) Render() (string, error) {
+	data, err := printer.Format([]byte(printItems(c.items)))
+	if err != nil {
+		return "", fmt.Errorf("invalid vault config: %v", err)
+	}
+	rendered, err := ParseConfig(string(data))
+	if err != nil {
+		return "", fmt.Errorf("invalid vault config: %v", err)
+	}
+	for _, key := range []string{"listener", "storage"} {
+		if n := len(rendered.filter(key)); n != 1 {
+			return "", fmt.Errorf("invalid vault config: expected one %q section, found %d", key, n)
+		}
+	}
+	return string(data), nil
+}
+
+// setDefault appends the item `key = value` unless the config has an item with the key.
+// value is an HCL literal, e.g. a quoted string.
+func (c *Config) setDefault(key, value string) {
+	if len(c.filter(key)) != 0 {
+		return
+	}
+	c.items = append(c.items, mustParseItems(fmt.Sprintf("%s = %s\n", key, value))...)
+}
+
+// replace removes the items with the given keys and appends the section.
+func (c *Config) replace(keys []string, section string) {
+	var items []*ast.ObjectItem
+	for _, item := range c.items {
+		key := itemKey(item)
+		if !containsKey(keys, key) {
+			items = append(items, item)
+			continue
+		}
+		if !containsKey(c.replaced, key) {
+			c.replaced = append(c.replaced, key)
+		}
+	}
+	c.items = append(items, mustParseItems(section)...)
+}
+
+// merge merges the block section into the blocks of the config with the given key.
+// The fields of the section replace the fields of the config with the same keys.
+// The merged block is appended in place of the blocks of the config.
+func (c *Config) merge(key, section string) {
+	own := mustParseItems(section)[0].Val.(*ast.ObjectType).List.Items
+	var fields []*ast.ObjectItem
+	for _, item := range c.filter(key) {
+		for _, f := range item.Val.(*ast.ObjectType).List.Items {
+			if !hasItem(own, itemKey(f)) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	fields = append(fields, own...)
+
+	var items []*ast.ObjectItem
+	for _, item := range c.items {
+		if itemKey(item) != key {
+			items = append(items, item)
+		}
+	}
+	c.items = append(items, mustParseItems(fmt.Sprintf("%s {\n%s}\n", key, printItems(fields)))...)
+}
+
+// filter returns the items of the config with the given key.
+func (c *Config) filter(key string) []*ast.ObjectItem {
+	var items []*ast.ObjectItem
+	for _, item := range c.items {
+		if itemKey(item) == key {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printItems prints the items in HCL, one after the other.
+// The items are printed separately, since they may come from different sources
+// whose positions do not fit together.
+func printItems(items []*ast.ObjectItem) string {
+	var buf bytes.Buffer
+	for _, item := range items {
+		normalizeItem(item)
+		// The printer only fails on unknown node types, which the parser does not return.
+		printer.Fprint(&buf, item)
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// normalizeItem turns the items parsed from JSON into their HCL form:
+// keys are unquoted if possible, and blocks are not assigned.
+func normalizeItem(item *ast.ObjectItem) {
+	ast.Walk(item, func(n ast.Node) (ast.Node, bool) {
+		oi, ok := n.(*ast.ObjectItem)
+		if !ok {
+			return n, true
+		}
+		if _, ok := oi.Val.(*ast.ObjectType); ok && len(oi.Keys) > 1 {
+			oi.Assign = token.Pos{}
+		}
+		k := &oi.Keys[0].Token
+		if key, ok := k.Value().(string); ok && k.Type == token.STRING && identRegexp.MatchString(key) {
+			k.Text = key
+			k.Type = token.IDENT
+		}
+		return n, true
+	})
+}
+
+var identRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// mustParseItems parses the items of a section of the operator.
+func mustParseItems(section string) []*ast.ObjectItem {
+	f, err := hcl.Parse(section)
+	if err != nil {
+		panic(fmt.Sprintf("invalid vault config section %q: %v", section, err))
+	}
+	return f.Node.(*ast.ObjectList).Items
+}
+
+// itemKey returns the first key of the item, e.g. "listener" for `listener "tcp" { ... }`.
+func itemKey(item *ast.ObjectItem) string {
+	key, _ := item.Keys[0].Token.Value().(string)
+	return key
+}
+
+func hasItem(items []*ast.ObjectItem, key string) bool {
+	for _, item := range items {
+		if itemKey(item) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 func NewClient(hostname string, port string, tlsConfig *vaultapi.TLSConfig) (*vaultapi.Client, error) {
+	return NewClientWithTimeout(hostname, port, tlsConfig, 0)
+}
+
+// NewClientWithTimeout is like NewClient, but the requests of the client
+// fail after the given timeout. A zero timeout keeps the default timeout.
+func NewClientWithTimeout(hostname string, port string, tlsConfig *vaultapi.TLSConfig, timeout time.Duration) (*vaultapi.Client, error) {
 	cfg := vaultapi.DefaultConfig()
 	podURL := fmt.Sprintf("https://%s:%s", hostname, port)
 	cfg.Address = podURL
 	cfg.ConfigureTLS(tlsConfig)
+	if timeout != 0 {
+		cfg.HttpClient.Timeout = timeout
+	}
 	return vaultapi.NewClient(cfg)
 }
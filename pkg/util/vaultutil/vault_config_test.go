@@ -0,0 +1,269 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+)
+
+// mergeConfig merges the operator's sections into the user config data as the operator does.
+func mergeConfig(t *testing.T, data string) (*Config, string) {
+	t.Helper()
+	c, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("ParseConfig(%q): unexpected error: %v", data, err)
+	}
+	c.SetDefaultParams(false)
+	c.SetStatsdTelemetry("localhost:9125")
+	c.SetEtcdStorage("https://example-etcd-client:2379")
+	c.SetSeal("transit", map[string]string{"mount_path": "transit/", "address": "https://vault:8200"})
+	out, err := c.Render()
+	if err != nil {
+		t.Fatalf("Render(): unexpected error: %v", err)
+	}
+	return c, out
+}
+
+const mergedConfig = `max_lease_ttl = "768h"
+
+ui = true
+
+listener "tcp" {
+  address         = "0.0.0.0:8200"
+  cluster_address = "0.0.0.0:8201"
+  tls_cert_file   = "/run/vault/tls/server.crt"
+  tls_key_file    = "/run/vault/tls/server.key"
+}
+
+telemetry {
+  usage_gauge_period = "5m"
+  statsd_address     = "localhost:9125"
+}
+
+storage "etcd" {
+  address       = "https://example-etcd-client:2379"
+  etcd_api      = "v3"
+  ha_enabled    = "true"
+  tls_ca_file   = "/run/vault/tls/etcd-client-ca.crt"
+  tls_cert_file = "/run/vault/tls/etcd-client.crt"
+  tls_key_file  = "/run/vault/tls/etcd-client.key"
+  sync          = "false"
+}
+
+seal "transit" {
+  address    = "https://vault:8200"
+  mount_path = "transit/"
+}
+`
+
+func TestMergeConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantReplaced []string
+	}{{
+		name: "hcl",
+		data: `
+max_lease_ttl = "768h"
+listener "tcp" {
+  address = "127.0.0.1:8200"
+}
+backend "consul" {
+  address = "consul:8500"
+}
+telemetry {
+  usage_gauge_period = "5m"
+  statsd_address = "statsd:9125"
+}
+seal "awskms" {
+  region = "us-east-1"
+}
+`,
+		wantReplaced: []string{"listener", "backend", "seal"},
+	}, {
+		name:         "json",
+		data:         `{"max_lease_ttl": "768h", "listener": {"tcp": {"address": "127.0.0.1:8200"}}, "telemetry": {"usage_gauge_period": "5m"}}`,
+		wantReplaced: []string{"listener"},
+	}, {
+		name: "telemetry blocks are merged",
+		data: `
+max_lease_ttl = "768h"
+telemetry {
+  usage_gauge_period = "5m"
+}
+telemetry {
+  statsd_address = "statsd:9125"
+}
+`,
+	}}
+	for _, tt := range tests {
+		c, out := mergeConfig(t, tt.data)
+		if out != mergedConfig {
+			t.Errorf("%s: expect config\n%s\ngot\n%s", tt.name, mergedConfig, out)
+		}
+		if !reflect.DeepEqual(c.Replaced(), tt.wantReplaced) {
+			t.Errorf("%s: expect replaced sections %v, got %v", tt.name, tt.wantReplaced, c.Replaced())
+		}
+	}
+}
+
+func TestMergeConfigStable(t *testing.T) {
+	_, out := mergeConfig(t, mergedConfig)
+	if out != mergedConfig {
+		t.Errorf("expect the merged config to be rendered as it is, got\n%s", out)
+	}
+}
+
+func TestMergeConfigDefaults(t *testing.T) {
+	c, err := ParseConfig(`ui = false`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.SetDefaultParams(true)
+	c.SetPrometheusTelemetry("24h")
+	c.SetEtcdStorage("https://example-etcd-client:2379")
+	out, err := c.Render()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"ui = false\n",
+		"unauthenticated_metrics_access = true",
+		`prometheus_retention_time = "24h"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expect the config to contain %q, got\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "ui = true") {
+		t.Errorf("expect ui of the user config to be kept, got\n%s", out)
+	}
+	if strings.Contains(out, "seal") {
+		t.Errorf("expect no seal section, got\n%s", out)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		data    string
+		wantErr string
+	}{
+		{data: `listener "tcp" {`, wantErr: ""},
+		{data: `telemetry = "statsd"`, wantErr: `"telemetry" must be a block`},
+		{data: `storage = ["etcd"]`, wantErr: `"storage" must be a block`},
+		{data: `{"seal": "awskms"}`, wantErr: `"seal" must be a block`},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig(tt.data)
+		if err == nil {
+			t.Errorf("ParseConfig(%q): expect an error", tt.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseConfig(%q): expect an error containing %q, got %v", tt.data, tt.wantErr, err)
+		}
+	}
+}
+
+func TestRenderMissingSections(t *testing.T) {
+	c, err := ParseConfig(``)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.SetDefaultParams(false)
+	_, err = c.Render()
+	if err == nil || !strings.Contains(err.Error(), `expected one "storage" section, found 0`) {
+		t.Errorf("expect a missing storage section error, got %v", err)
+	}
+}
+
+func TestSetServerConfig(t *testing.T) {
+	cacheSize := int32(131072)
+	ui := false
+	sc := &api.ConfigSpec{
+		LogLevel:        "debug",
+		LogFormat:       api.LogFormatJSON,
+		DefaultLeaseTTL: "1h",
+		MaxLeaseTTL:     "768h",
+		DisableMlock:    true,
+		CacheSize:       &cacheSize,
+		UI:              &ui,
+		PluginDirectory: "/vault/plugins",
+		ClusterName:     "example",
+	}
+	tests := []struct {
+		name string
+		data string
+		sc   *api.ConfigSpec
+		want string
+	}{{
+		name: "no settings",
+		data: `max_lease_ttl = "24h"`,
+		want: `max_lease_ttl = "24h"
+`,
+	}, {
+		name: "all settings",
+		sc:   sc,
+		want: `log_level = "debug"
+log_format = "json"
+default_lease_ttl = "1h"
+max_lease_ttl = "768h"
+disable_mlock = true
+cache_size = 131072
+ui = false
+plugin_directory = "/vault/plugins"
+cluster_name = "example"
+`,
+	}, {
+		name: "the user config takes precedence",
+		data: `
+log_level = "warn"
+max_lease_ttl = "24h"
+ui = true
+`,
+		sc: sc,
+		want: `log_level = "warn"
+max_lease_ttl = "24h"
+ui = true
+log_format = "json"
+default_lease_ttl = "1h"
+disable_mlock = true
+cache_size = 131072
+plugin_directory = "/vault/plugins"
+cluster_name = "example"
+`,
+	}, {
+		name: "unset settings are skipped",
+		sc:   &api.ConfigSpec{LogLevel: "info"},
+		want: `log_level = "info"
+`,
+	}}
+	for _, tt := range tests {
+		c, err := ParseConfig(tt.data)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		c.SetServerConfig(tt.sc)
+		// The settings are checked alone, without the sections Render requires.
+		got := printItems(c.items)
+		if got != tt.want {
+			t.Errorf("%s: expect config\n%s\ngot\n%s", tt.name, tt.want, got)
+		}
+	}
+}
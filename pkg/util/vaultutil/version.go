@@ -0,0 +1,157 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultutil
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// versionRegexp matches "<major>.<minor>.<patch>" with an optional "-<suffix>",
+// e.g. "0.9.1", "1.2.3" or "1.2.0-beta2".
+var versionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?$`)
+
+// Version is a parsed Vault version.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Pre is the optional suffix after the patch number, e.g. "beta2".
+	Pre string
+}
+
+// ParseVersion parses a Vault version string such as "1.2.3" or "1.2.0-beta2".
+func ParseVersion(s string) (Version, error) {
+	m := versionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid vault version (%s): expect <major>.<minor>.<patch>[-<suffix>]", s)
+	}
+	var v Version
+	// The regexp guarantees these are digits; overflow is the only possible error.
+	var err error
+	if v.Major, err = strconv.Atoi(m[1]); err != nil {
+		return Version{}, fmt.Errorf("invalid vault version (%s): %v", s, err)
+	}
+	if v.Minor, err = strconv.Atoi(m[2]); err != nil {
+		return Version{}, fmt.Errorf("invalid vault version (%s): %v", s, err)
+	}
+	if v.Patch, err = strconv.Atoi(m[3]); err != nil {
+		return Version{}, fmt.Errorf("invalid vault version (%s): %v", s, err)
+	}
+	v.Pre = m[4]
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is older than, equal to, or newer than o.
+// A version with a suffix is older than the same version without one, and
+// suffixes are otherwise compared lexically.
+func (v Version) Compare(o Version) int {
+	switch {
+	case v.Major != o.Major:
+		return compareInt(v.Major, o.Major)
+	case v.Minor != o.Minor:
+		return compareInt(v.Minor, o.Minor)
+	case v.Patch != o.Patch:
+		return compareInt(v.Patch, o.Patch)
+	case v.Pre == o.Pre:
+		return 0
+	case len(v.Pre) == 0:
+		return 1
+	case len(o.Pre) == 0:
+		return -1
+	case v.Pre < o.Pre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) != 0 {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// releaseSeries are the Vault release series supported by the operator, oldest first,
+// each given by its latest known patch release.
+// Upgrades are safe within a release series and to the next one.
+var releaseSeries = []Version{
+	{Major: 0, Minor: 8, Patch: 3},
+	{Major: 0, Minor: 9, Patch: 6},
+	{Major: 0, Minor: 10, Patch: 4},
+	{Major: 0, Minor: 11, Patch: 6},
+	{Major: 1, Minor: 0, Patch: 3},
+	{Major: 1, Minor: 1, Patch: 5},
+	{Major: 1, Minor: 2, Patch: 4},
+}
+
+// SupportedSeries returns the supported release series, e.g. "0.9" or "1.2".
+func SupportedSeries() []string {
+	s := make([]string, 0, len(releaseSeries))
+	for _, r := range releaseSeries {
+		s = append(s, fmt.Sprintf("%d.%d", r.Major, r.Minor))
+	}
+	return s
+}
+
+// CheckSupported returns an error if v is not of a supported release series.
+func CheckSupported(v Version) error {
+	if seriesIndex(v) < 0 {
+		return fmt.Errorf("vault version %s is not supported, the supported release series are %v", v, SupportedSeries())
+	}
+	return nil
+}
+
+// UpgradePath returns the versions to upgrade through from one version to another, ending with to.
+// An upgrade within a release series or to the next one takes one step; otherwise the nodes are
+// first upgraded to the latest patch release of every release series in between.
+// It returns an error for a downgrade or an unsupported version.
+func UpgradePath(from, to Version) ([]Version, error) {
+	if to.Compare(from) < 0 {
+		return nil, fmt.Errorf("downgrade from %s to %s is not allowed", from, to)
+	}
+	fi, ti := seriesIndex(from), seriesIndex(to)
+	if fi < 0 {
+		return nil, fmt.Errorf("upgrade from vault version %s is not supported, the supported release series are %v", from, SupportedSeries())
+	}
+	if ti < 0 {
+		return nil, CheckSupported(to)
+	}
+	var path []Version
+	for i := fi + 1; i < ti; i++ {
+		path = append(path, releaseSeries[i])
+	}
+	return append(path, to), nil
+}
+
+// seriesIndex returns the index of the release series of v in releaseSeries, or -1.
+func seriesIndex(v Version) int {
+	for i, r := range releaseSeries {
+		if r.Major == v.Major && r.Minor == v.Minor {
+			return i
+		}
+	}
+	return -1
+}
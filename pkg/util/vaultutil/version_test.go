@@ -0,0 +1,183 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vaultutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "1.2.3", want: Version{Major: 1, Minor: 2, Patch: 3}},
+		{in: "v0.9.1", want: Version{Major: 0, Minor: 9, Patch: 1}},
+		{in: "0.9.1-0", want: Version{Major: 0, Minor: 9, Patch: 1, Pre: "0"}},
+		{in: "1.2.0-beta2", want: Version{Major: 1, Minor: 2, Patch: 0, Pre: "beta2"}},
+		{in: "", wantErr: true},
+		{in: "latest", wantErr: true},
+		{in: "1.2", wantErr: true},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "1.2.3-", wantErr: true},
+		{in: "1.2.99999999999999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseVersion(%q): expect an error, got %v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersion(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q): expect %+v, got %+v", tt.in, tt.want, got)
+		}
+		if s := strings.TrimPrefix(tt.in, "v"); got.String() != s {
+			t.Errorf("ParseVersion(%q).String(): expect %s, got %s", tt.in, s, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.3.0", "1.2.9", 1},
+		{"0.11.0", "1.0.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.2.0-beta2", "1.2.0", -1},
+		{"1.2.0", "1.2.0-beta2", 1},
+		{"1.2.0-beta1", "1.2.0-beta2", -1},
+		{"1.2.0-rc1", "1.2.0-beta2", 1},
+	}
+	for _, tt := range tests {
+		a, b := mustParseVersion(t, tt.a), mustParseVersion(t, tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%s.Compare(%s): expect %d, got %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestUpgradePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string
+		// wantErr is a substring of the expected error, or empty.
+		wantErr string
+	}{{
+		name: "same version",
+		from: "1.2.3", to: "1.2.3",
+		want: []string{"1.2.3"},
+	}, {
+		name: "patch release",
+		from: "1.2.3", to: "1.2.4",
+		want: []string{"1.2.4"},
+	}, {
+		name: "next release series",
+		from: "1.1.0", to: "1.2.3",
+		want: []string{"1.2.3"},
+	}, {
+		name: "major release",
+		from: "0.11.2", to: "1.0.0",
+		want: []string{"1.0.0"},
+	}, {
+		name: "skipped release series",
+		from: "0.9.1", to: "1.1.0",
+		want: []string{"0.10.4", "0.11.6", "1.0.3", "1.1.0"},
+	}, {
+		name: "one skipped release series",
+		from: "1.0.3", to: "1.2.3",
+		want: []string{"1.1.5", "1.2.3"},
+	}, {
+		name: "pre-release to release",
+		from: "1.2.0-beta2", to: "1.2.0",
+		want: []string{"1.2.0"},
+	}, {
+		name: "downgrade",
+		from: "1.2.3", to: "1.1.5",
+		wantErr: "downgrade from 1.2.3 to 1.1.5 is not allowed",
+	}, {
+		name: "patch downgrade",
+		from: "1.2.3", to: "1.2.2",
+		wantErr: "downgrade",
+	}, {
+		name: "release to pre-release",
+		from: "1.2.0", to: "1.2.0-beta2",
+		wantErr: "downgrade",
+	}, {
+		name: "unknown from version",
+		from: "0.7.3", to: "0.8.3",
+		wantErr: "upgrade from vault version 0.7.3 is not supported",
+	}, {
+		name: "unknown to version",
+		from: "1.2.3", to: "1.3.0",
+		wantErr: "vault version 1.3.0 is not supported",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := UpgradePath(mustParseVersion(t, tt.from), mustParseVersion(t, tt.to))
+			if len(tt.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expect error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, v := range path {
+				got = append(got, v.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expect upgrade path %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckSupported(t *testing.T) {
+	for _, s := range []string{"0.8.0", "0.9.6", "1.2.99", "1.2.0-rc1"} {
+		if err := CheckSupported(mustParseVersion(t, s)); err != nil {
+			t.Errorf("CheckSupported(%s): unexpected error: %v", s, err)
+		}
+	}
+	for _, s := range []string{"0.7.3", "1.3.0", "2.0.0"} {
+		if err := CheckSupported(mustParseVersion(t, s)); err == nil {
+			t.Errorf("CheckSupported(%s): expect an error", s)
+		}
+	}
+}
+
+func mustParseVersion(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := ParseVersion(s)
+	if err != nil {
+		t.Fatalf("failed to parse version %q: %v", s, err)
+	}
+	return v
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// serveConvert handles the ConversionReview sent by the apiserver
+// to convert VaultServices between the served API versions.
+func (s *Server) serveConvert(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		http.Error(w, fmt.Sprintf("unsupported content type (%s)", ct), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read request body failed: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review := apiextensionsv1.ConversionReview{}
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("decode conversion review failed: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	resp := &apiextensionsv1.ConversionResponse{UID: review.Request.UID}
+	objs, err := convertObjects(review.Request.Objects, review.Request.DesiredAPIVersion)
+	if err != nil {
+		resp.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+	} else {
+		resp.ConvertedObjects = objs
+		resp.Result = metav1.Status{Status: metav1.StatusSuccess}
+	}
+	review.Response = resp
+	// The request is not needed in the reply.
+	review.Request = nil
+
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("encode conversion review failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// convertObjects converts every VaultService in objs to the desired API version.
+func convertObjects(objs []runtime.RawExtension, desiredAPIVersion string) ([]runtime.RawExtension, error) {
+	out := make([]runtime.RawExtension, 0, len(objs))
+	for _, obj := range objs {
+		tm := metav1.TypeMeta{}
+		if err := json.Unmarshal(obj.Raw, &tm); err != nil {
+			return nil, fmt.Errorf("decode object failed: %v", err)
+		}
+		converted, err := convertObject(obj.Raw, tm.APIVersion, desiredAPIVersion)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(converted)
+		if err != nil {
+			return nil, fmt.Errorf("encode converted object failed: %v", err)
+		}
+		out = append(out, runtime.RawExtension{Raw: data})
+	}
+	return out, nil
+}
+
+func convertObject(raw []byte, fromAPIVersion, toAPIVersion string) (interface{}, error) {
+	alpha := v1alpha1.SchemeGroupVersion.String()
+	beta := api.SchemeGroupVersion.String()
+
+	switch {
+	case fromAPIVersion == toAPIVersion:
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("decode %s VaultService failed: %v", fromAPIVersion, err)
+		}
+		return obj, nil
+	case fromAPIVersion == alpha && toAPIVersion == beta:
+		in := &v1alpha1.VaultService{}
+		if err := json.Unmarshal(raw, in); err != nil {
+			return nil, fmt.Errorf("decode %s VaultService failed: %v", fromAPIVersion, err)
+		}
+		out := &api.VaultService{}
+		if err := in.ConvertTo(out); err != nil {
+			return nil, fmt.Errorf("convert VaultService (%s) to %s failed: %v", in.Name, toAPIVersion, err)
+		}
+		return out, nil
+	case fromAPIVersion == beta && toAPIVersion == alpha:
+		in := &api.VaultService{}
+		if err := json.Unmarshal(raw, in); err != nil {
+			return nil, fmt.Errorf("decode %s VaultService failed: %v", fromAPIVersion, err)
+		}
+		out := &v1alpha1.VaultService{}
+		if err := out.ConvertFrom(in); err != nil {
+			return nil, fmt.Errorf("convert VaultService (%s) to %s failed: %v", in.Name, toAPIVersion, err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported conversion from %s to %s", fromAPIVersion, toAPIVersion)
+	}
+}
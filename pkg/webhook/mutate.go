@@ -0,0 +1,103 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// jsonPatchOp is a single RFC 6902 JSON patch operation.
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// defaulter is a VaultService of any served API version.
+type defaulter interface {
+	metav1.Object
+	SetDefaults() bool
+}
+
+// mutate applies the VaultService defaults to the incoming object.
+// The whole spec is replaced in one patch operation so that we don't need
+// to track which individual fields SetDefaults has touched.
+func (s *Server) mutate(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return allowed()
+	}
+	if len(req.SubResource) != 0 {
+		return allowed()
+	}
+
+	var vr defaulter = &api.VaultService{}
+	if req.Kind.Version == v1alpha1.SchemeGroupVersion.Version {
+		vr = &v1alpha1.VaultService{}
+	}
+	if err := json.Unmarshal(req.Object.Raw, vr); err != nil {
+		return errored(fmt.Errorf("decode VaultService failed: %v", err))
+	}
+	// The name is not yet set when the object is created with generateName.
+	// Defaulting the TLS secrets requires the final name, so leave it to the operator.
+	if len(vr.GetName()) == 0 {
+		return allowed()
+	}
+	if !vr.SetDefaults() {
+		return allowed()
+	}
+
+	spec, err := specOf(vr)
+	if err != nil {
+		return errored(err)
+	}
+	patch, err := json.Marshal([]jsonPatchOp{{
+		// "add" replaces the member if it already exists.
+		Op:    "add",
+		Path:  "/spec",
+		Value: spec,
+	}})
+	if err != nil {
+		return errored(fmt.Errorf("encode patch failed: %v", err))
+	}
+
+	pt := admissionv1.PatchTypeJSONPatch
+	resp := allowed()
+	resp.Patch = patch
+	resp.PatchType = &pt
+	return resp
+}
+
+// specOf returns the JSON encoded spec of the VaultService vr.
+func specOf(vr defaulter) (json.RawMessage, error) {
+	data, err := json.Marshal(vr)
+	if err != nil {
+		return nil, fmt.Errorf("encode VaultService failed: %v", err)
+	}
+	obj := struct {
+		Spec json.RawMessage `json:"spec"`
+	}{}
+	if err = json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("decode VaultService spec failed: %v", err)
+	}
+	return obj.Spec, nil
+}
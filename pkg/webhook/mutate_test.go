@@ -0,0 +1,113 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMutate(t *testing.T) {
+	s := New(fake.NewSimpleClientset(), "", "", "")
+
+	vr := &api.VaultService{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+	}
+	resp := s.mutate(context.TODO(), newAdmissionRequest(t, api.SchemeGroupVersion.Version, vr, nil))
+	if !resp.Allowed {
+		t.Fatalf("expect request to be allowed, got denied: %s", resp.Result.Message)
+	}
+	if resp.PatchType == nil || *resp.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("expect a JSON patch, got patch type %v", resp.PatchType)
+	}
+	var patch []struct {
+		Op    string               `json:"op"`
+		Path  string               `json:"path"`
+		Value api.VaultServiceSpec `json:"value"`
+	}
+	if err := json.Unmarshal(resp.Patch, &patch); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	if len(patch) != 1 || patch[0].Op != "add" || patch[0].Path != "/spec" {
+		t.Fatalf("expect a single add of /spec, got %s", resp.Patch)
+	}
+	want := vr.DeepCopy()
+	want.SetDefaults()
+	if !reflect.DeepEqual(patch[0].Value, want.Spec) {
+		t.Errorf("expect patched spec %+v, got %+v", want.Spec, patch[0].Value)
+	}
+}
+
+func TestMutateNoPatch(t *testing.T) {
+	generated := &api.VaultService{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "example-", Namespace: "default"},
+	}
+	deleted := newAdmissionRequest(t, api.SchemeGroupVersion.Version, generated, nil)
+	deleted.Operation = admissionv1.Delete
+	status := newAdmissionRequest(t, api.SchemeGroupVersion.Version, generated, nil)
+	status.SubResource = "status"
+
+	tests := []struct {
+		name string
+		req  *admissionv1.AdmissionRequest
+	}{
+		{"defaulted", newAdmissionRequest(t, api.SchemeGroupVersion.Version, newTestVault("example"), nil)},
+		{"generated name", newAdmissionRequest(t, api.SchemeGroupVersion.Version, generated, nil)},
+		{"delete", deleted},
+		{"status", status},
+	}
+	s := New(fake.NewSimpleClientset(), "", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.mutate(context.TODO(), tt.req)
+			if !resp.Allowed {
+				t.Fatalf("expect request to be allowed, got denied: %s", resp.Result.Message)
+			}
+			if len(resp.Patch) != 0 {
+				t.Errorf("expect no patch, got %s", resp.Patch)
+			}
+		})
+	}
+}
+
+func TestMutateV1alpha1(t *testing.T) {
+	vr := &v1alpha1.VaultService{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+	}
+	resp := New(fake.NewSimpleClientset(), "", "", "").mutate(context.TODO(), newAdmissionRequest(t, v1alpha1.SchemeGroupVersion.Version, vr, nil))
+	if !resp.Allowed || len(resp.Patch) == 0 {
+		t.Fatalf("expect an allowed request with a patch, got %+v", resp)
+	}
+	var patch []struct {
+		Value v1alpha1.VaultServiceSpec `json:"value"`
+	}
+	if err := json.Unmarshal(resp.Patch, &patch); err != nil {
+		t.Fatalf("failed to decode patch: %v", err)
+	}
+	want := vr.DeepCopy()
+	want.SetDefaults()
+	if len(patch) != 1 || !reflect.DeepEqual(patch[0].Value, want.Spec) {
+		t.Errorf("expect patched spec %+v, got %s", want.Spec, resp.Patch)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// MutatePath is the endpoint of the defaulting webhook for VaultService
+	MutatePath = "/mutate-vaultservice"
+	// ValidatePath is the endpoint of the validating webhook for VaultService
+	ValidatePath = "/validate-vaultservice"
+	// ConvertPath is the endpoint of the conversion webhook for VaultService
+	ConvertPath = "/convert-vaultservice"
+
+	// ServiceName is the name of the Service in front of the webhook server
+	// as in example/webhook-template.yaml
+	ServiceName = "vault-operator-webhook"
+)
+
+// admitFunc handles an admission request and returns the admission response.
+// ctx is cancelled when the apiserver stops waiting for the response.
+type admitFunc func(context.Context, *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse
+
+// Server serves the admission and conversion webhooks for the VaultService resource.
+type Server struct {
+	addr     string
+	certFile string
+	keyFile  string
+
+	kubecli kubernetes.Interface
+}
+
+// New creates a webhook server listening on addr with the given TLS cert and key files.
+func New(kubecli kubernetes.Interface, addr, certFile, keyFile string) *Server {
+	return &Server{
+		addr:     addr,
+		certFile: certFile,
+		keyFile:  keyFile,
+		kubecli:  kubecli,
+	}
+}
+
+// Run serves the webhooks until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(MutatePath, s.serve(s.mutate))
+	mux.HandleFunc(ValidatePath, s.serve(s.validate))
+	mux.HandleFunc(ConvertPath, s.serveConvert)
+
+	srv := &http.Server{Addr: s.addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+
+	logrus.Infof("serving webhooks on %s", s.addr)
+	err := srv.ListenAndServeTLS(s.certFile, s.keyFile)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// serve decodes the AdmissionReview in the request body, calls admit on it,
+// and writes back the AdmissionReview carrying the response.
+func (s *Server) serve(admit admitFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			http.Error(w, fmt.Sprintf("unsupported content type (%s)", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read request body failed: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		review := admissionv1.AdmissionReview{}
+		if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+			http.Error(w, fmt.Sprintf("decode admission review failed: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		resp := admit(r.Context(), review.Request)
+		resp.UID = review.Request.UID
+		review.Response = resp
+		// The request is not needed in the reply.
+		review.Request = nil
+
+		data, err := json.Marshal(review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("encode admission review failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+func allowed() *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func denied(status metav1.Status) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{Allowed: false, Result: &status}
+}
+
+func errored(err error) *admissionv1.AdmissionResponse {
+	return denied(metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusBadRequest,
+		Reason:  metav1.StatusReasonBadRequest,
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,489 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+	"github.com/nanosapp/vault-operator/pkg/util/cronutil"
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validate rejects VaultServices with an invalid spec or a disallowed spec change.
+func (s *Server) validate(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return allowed()
+	}
+	if len(req.SubResource) != 0 {
+		return allowed()
+	}
+
+	var (
+		errs      field.ErrorList
+		configMap string
+		err       error
+	)
+	if req.Kind.Version == v1alpha1.SchemeGroupVersion.Version {
+		errs, configMap, err = validateV1alpha1(req)
+	} else {
+		errs, configMap, err = validateV1beta1(req)
+	}
+	if err != nil {
+		return errored(err)
+	}
+	if len(errs) == 0 {
+		errs = append(errs, s.validateConfigMap(ctx, req.Namespace, configMap)...)
+	}
+	if len(errs) != 0 {
+		gk := schema.GroupKind{Group: api.SchemeGroupVersion.Group, Kind: api.VaultServiceKind}
+		return denied(apierrors.NewInvalid(gk, req.Name, errs).ErrStatus)
+	}
+	return allowed()
+}
+
+// validateV1beta1 validates a v1beta1 VaultService admission request.
+// It returns the name of the referenced ConfigMap alongside the field errors.
+func validateV1beta1(req *admissionv1.AdmissionRequest) (field.ErrorList, string, error) {
+	vr := &api.VaultService{}
+	if err := json.Unmarshal(req.Object.Raw, vr); err != nil {
+		return nil, "", fmt.Errorf("decode VaultService failed: %v", err)
+	}
+
+	errs := validateVaultService(vr)
+	if req.Operation == admissionv1.Create {
+		errs = append(errs, validateVersion(vr.Spec.Version, "", vr.Spec.UpgradeStrategy)...)
+	}
+	if req.Operation == admissionv1.Update {
+		old := &api.VaultService{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return nil, "", fmt.Errorf("decode old VaultService failed: %v", err)
+		}
+		// The old object may have been stored before its defaults existed, e.g. without spec.telemetry.
+		// Default it like the new one so that only changes made by the user are compared.
+		old.SetDefaults()
+		oldVersion := old.Spec.Version
+		// After a rollback the spec may be set back to the version the nodes still run.
+		if u := old.Status.Upgrade; u != nil && u.Phase == api.UpgradePhaseRolledBack && vr.Spec.Version == u.FromVersion {
+			oldVersion = u.FromVersion
+		}
+		errs = append(errs, validateVersion(vr.Spec.Version, oldVersion, vr.Spec.UpgradeStrategy)...)
+		errs = append(errs, validateWorkloadUpdate(vr, old)...)
+	}
+	return errs, vr.Spec.ConfigMapName, nil
+}
+
+// validateV1alpha1 validates a legacy v1alpha1 VaultService admission request.
+// It returns the name of the referenced ConfigMap alongside the field errors.
+func validateV1alpha1(req *admissionv1.AdmissionRequest) (field.ErrorList, string, error) {
+	vr := &v1alpha1.VaultService{}
+	if err := json.Unmarshal(req.Object.Raw, vr); err != nil {
+		return nil, "", fmt.Errorf("decode VaultService failed: %v", err)
+	}
+
+	errs := validateV1alpha1VaultService(vr)
+	if req.Operation == admissionv1.Create {
+		errs = append(errs, validateVersion(vr.Spec.Version, "", nil)...)
+	}
+	if req.Operation == admissionv1.Update {
+		old := &v1alpha1.VaultService{}
+		if err := json.Unmarshal(req.OldObject.Raw, old); err != nil {
+			return nil, "", fmt.Errorf("decode old VaultService failed: %v", err)
+		}
+		errs = append(errs, validateVersion(vr.Spec.Version, old.Spec.Version, nil)...)
+	}
+	return errs, vr.Spec.ConfigMapName, nil
+}
+
+// validateVaultService checks the spec of a (defaulted) VaultService.
+func validateVaultService(vr *api.VaultService) field.ErrorList {
+	specPath := field.NewPath("spec")
+	errs := validateCommon(vr.Spec.Nodes, vr.Spec.BaseImage, vr.Spec.Version)
+
+	if etcd := vr.Spec.Storage.Etcd; etcd != nil && etcd.Size < 1 {
+		errs = append(errs, field.Invalid(specPath.Child("storage", "etcd", "size"), etcd.Size, "must be at least 1"))
+	}
+	if tls := vr.Spec.TLS; tls != nil {
+		var server, client string
+		if tls.Static != nil {
+			server, client = tls.Static.ServerSecret, tls.Static.ClientSecret
+		}
+		errs = append(errs, validateStaticTLS(specPath.Child("tls"), tls.Static != nil, server, client)...)
+	}
+	switch vr.Spec.Workload {
+	case "", api.WorkloadKindDeployment, api.WorkloadKindStatefulSet:
+	default:
+		errs = append(errs, field.NotSupported(specPath.Child("workload"), vr.Spec.Workload,
+			[]string{string(api.WorkloadKindDeployment), string(api.WorkloadKindStatefulSet)}))
+	}
+	if seal := vr.Spec.Seal; seal != nil && len(seal.Type) == 0 {
+		errs = append(errs, field.Required(specPath.Child("seal", "type"), ""))
+	}
+	if t := vr.Spec.Telemetry; t != nil {
+		errs = append(errs, validateTelemetry(specPath.Child("telemetry"), t)...)
+	}
+	if c := vr.Spec.Config; c != nil {
+		errs = append(errs, validateConfig(specPath.Child("config"), c)...)
+	}
+	if svc := vr.Spec.Service; svc != nil {
+		errs = append(errs, validateService(specPath.Child("service"), svc)...)
+	}
+	if ing := vr.Spec.Ingress; ing != nil {
+		errs = append(errs, validateIngress(specPath.Child("ingress"), ing)...)
+	}
+	if us := vr.Spec.UpgradeStrategy; us != nil {
+		errs = append(errs, validateUpgradeStrategy(specPath.Child("upgradeStrategy"), us)...)
+	}
+	for i, w := range vr.Spec.MaintenanceWindows {
+		errs = append(errs, validateMaintenanceWindow(specPath.Child("maintenanceWindows").Index(i), w)...)
+	}
+	if p := vr.Spec.Pod; p != nil {
+		reserved := k8sutil.LabelsForVault(vr.Name)
+		reserved[k8sutil.VaultRoleLabel] = ""
+		for k := range reserved {
+			if _, ok := p.Labels[k]; ok {
+				errs = append(errs, field.Forbidden(specPath.Child("pod", "labels").Key(k), "label is reserved for the operator"))
+			}
+		}
+	}
+	return errs
+}
+
+// validateTelemetry checks that only the settings of the selected telemetry type are given.
+func validateTelemetry(path *field.Path, t *api.TelemetrySpec) field.ErrorList {
+	var errs field.ErrorList
+	switch t.Type {
+	case api.TelemetryStatsd, api.TelemetryPrometheus, api.TelemetryDisabled:
+	default:
+		return append(errs, field.NotSupported(path.Child("type"), t.Type,
+			[]string{string(api.TelemetryStatsd), string(api.TelemetryPrometheus), string(api.TelemetryDisabled)}))
+	}
+	if t.Statsd != nil && t.Type != api.TelemetryStatsd {
+		errs = append(errs, field.Forbidden(path.Child("statsd"), fmt.Sprintf("not allowed for the %q type", t.Type)))
+	}
+	if t.Prometheus == nil {
+		return errs
+	}
+	if t.Type != api.TelemetryPrometheus {
+		return append(errs, field.Forbidden(path.Child("prometheus"), fmt.Sprintf("not allowed for the %q type", t.Type)))
+	}
+	if rt := t.Prometheus.RetentionTime; len(rt) != 0 {
+		if _, err := time.ParseDuration(rt); err != nil {
+			errs = append(errs, field.Invalid(path.Child("prometheus", "retentionTime"), rt, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateConfig checks the log settings, the lease durations and the cache size of spec.config.
+func validateConfig(path *field.Path, c *api.ConfigSpec) field.ErrorList {
+	var errs field.ErrorList
+	switch c.LogLevel {
+	case "", "trace", "debug", "info", "warn", "err":
+	default:
+		errs = append(errs, field.NotSupported(path.Child("logLevel"), c.LogLevel,
+			[]string{"trace", "debug", "info", "warn", "err"}))
+	}
+	switch c.LogFormat {
+	case "", api.LogFormatStandard, api.LogFormatJSON:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("logFormat"), c.LogFormat,
+			[]string{string(api.LogFormatStandard), string(api.LogFormatJSON)}))
+	}
+	if ttl := c.DefaultLeaseTTL; len(ttl) != 0 {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			errs = append(errs, field.Invalid(path.Child("defaultLeaseTTL"), ttl, err.Error()))
+		}
+	}
+	if ttl := c.MaxLeaseTTL; len(ttl) != 0 {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			errs = append(errs, field.Invalid(path.Child("maxLeaseTTL"), ttl, err.Error()))
+		}
+	}
+	if c.CacheSize != nil && *c.CacheSize < 0 {
+		errs = append(errs, field.Invalid(path.Child("cacheSize"), *c.CacheSize, "must not be negative"))
+	}
+	return errs
+}
+
+// validateUpgradeStrategy checks the durations and the backup location of the upgrade strategy.
+func validateUpgradeStrategy(path *field.Path, us *api.UpgradeStrategy) field.ErrorList {
+	var errs field.ErrorList
+	if b := us.Backup; b != nil {
+		switch {
+		case b.S3 == nil:
+			errs = append(errs, field.Required(path.Child("backup", "s3"), ""))
+		case len(strings.Trim(b.S3.Prefix, "/")) == 0:
+			errs = append(errs, field.Required(path.Child("backup", "s3", "prefix"), ""))
+		}
+		if b.S3 != nil && len(b.S3.AWSSecret) == 0 {
+			errs = append(errs, field.Required(path.Child("backup", "s3", "awsSecret"), ""))
+		}
+	}
+	if c := us.Canary; c != nil {
+		if _, err := time.ParseDuration(c.SoakPeriod); err != nil {
+			errs = append(errs, field.Invalid(path.Child("canary", "soakPeriod"), c.SoakPeriod, err.Error()))
+		}
+	}
+	if rd := us.RollbackDeadline; len(rd) != 0 {
+		if d, err := time.ParseDuration(rd); err != nil {
+			errs = append(errs, field.Invalid(path.Child("rollbackDeadline"), rd, err.Error()))
+		} else if d <= 0 {
+			errs = append(errs, field.Invalid(path.Child("rollbackDeadline"), rd, "must be positive"))
+		}
+	}
+	return errs
+}
+
+// validateMaintenanceWindow checks the schedule, duration and time zone of a maintenance window.
+func validateMaintenanceWindow(path *field.Path, w api.MaintenanceWindow) field.ErrorList {
+	var errs field.ErrorList
+	if _, err := cronutil.Parse(w.Schedule); err != nil {
+		errs = append(errs, field.Invalid(path.Child("schedule"), w.Schedule, err.Error()))
+	}
+	if d, err := time.ParseDuration(w.Duration); err != nil {
+		errs = append(errs, field.Invalid(path.Child("duration"), w.Duration, err.Error()))
+	} else if d <= 0 {
+		errs = append(errs, field.Invalid(path.Child("duration"), w.Duration, "must be positive"))
+	}
+	if len(w.TimeZone) != 0 {
+		if _, err := time.LoadLocation(w.TimeZone); err != nil {
+			errs = append(errs, field.Invalid(path.Child("timeZone"), w.TimeZone, err.Error()))
+		}
+	}
+	return errs
+}
+
+// validateService checks that the load balancer and external traffic settings fit the service type.
+func validateService(path *field.Path, svc *api.ServiceSpec) field.ErrorList {
+	var errs field.ErrorList
+	switch svc.Type {
+	case "", v1.ServiceTypeClusterIP, v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer:
+	default:
+		return append(errs, field.NotSupported(path.Child("type"), svc.Type,
+			[]string{string(v1.ServiceTypeClusterIP), string(v1.ServiceTypeNodePort), string(v1.ServiceTypeLoadBalancer)}))
+	}
+
+	if len(svc.LoadBalancerSourceRanges) != 0 && svc.Type != v1.ServiceTypeLoadBalancer {
+		errs = append(errs, field.Forbidden(path.Child("loadBalancerSourceRanges"), "only allowed for the LoadBalancer type"))
+	}
+	for i, r := range svc.LoadBalancerSourceRanges {
+		if _, _, err := net.ParseCIDR(r); err != nil {
+			errs = append(errs, field.Invalid(path.Child("loadBalancerSourceRanges").Index(i), r, err.Error()))
+		}
+	}
+
+	switch svc.ExternalTrafficPolicy {
+	case "":
+	case v1.ServiceExternalTrafficPolicyTypeCluster, v1.ServiceExternalTrafficPolicyTypeLocal:
+		if svc.Type != v1.ServiceTypeNodePort && svc.Type != v1.ServiceTypeLoadBalancer {
+			errs = append(errs, field.Forbidden(path.Child("externalTrafficPolicy"), "only allowed for the NodePort and LoadBalancer types"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("externalTrafficPolicy"), svc.ExternalTrafficPolicy,
+			[]string{string(v1.ServiceExternalTrafficPolicyTypeCluster), string(v1.ServiceExternalTrafficPolicyTypeLocal)}))
+	}
+	return errs
+}
+
+// validateIngress checks the host of the ingress and that only the settings of its kind and TLS mode are given.
+func validateIngress(path *field.Path, ing *api.IngressSpec) field.ErrorList {
+	var errs field.ErrorList
+	if len(ing.Host) == 0 {
+		errs = append(errs, field.Required(path.Child("host"), ""))
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(ing.Host) {
+			errs = append(errs, field.Invalid(path.Child("host"), ing.Host, msg))
+		}
+	}
+
+	switch ing.TLSMode {
+	case "", api.IngressTLSPassthrough:
+		if len(ing.TLSSecret) != 0 {
+			errs = append(errs, field.Forbidden(path.Child("tlsSecret"), "only allowed for the Reencrypt TLS mode"))
+		}
+	case api.IngressTLSReencrypt:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("tlsMode"), ing.TLSMode,
+			[]string{string(api.IngressTLSPassthrough), string(api.IngressTLSReencrypt)}))
+	}
+
+	switch ing.Kind {
+	case "", api.IngressKindIngress:
+		if ing.Gateway != nil {
+			errs = append(errs, field.Forbidden(path.Child("gateway"), "only allowed for the TLSRoute kind"))
+		}
+	case api.IngressKindTLSRoute:
+		if ing.TLSMode == api.IngressTLSReencrypt {
+			errs = append(errs, field.Forbidden(path.Child("tlsMode"), "a TLSRoute only supports the Passthrough TLS mode"))
+		}
+		if len(ing.ClassName) != 0 {
+			errs = append(errs, field.Forbidden(path.Child("className"), "only allowed for the Ingress kind"))
+		}
+		if ing.Gateway == nil || len(ing.Gateway.Name) == 0 {
+			errs = append(errs, field.Required(path.Child("gateway", "name"), ""))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("kind"), ing.Kind,
+			[]string{string(api.IngressKindIngress), string(api.IngressKindTLSRoute)}))
+	}
+	return errs
+}
+
+// validateWorkloadUpdate checks that a deployment based cluster is only migrated to a statefulset,
+// and not during an upgrade, which replaces the nodes of one workload.
+func validateWorkloadUpdate(vr, old *api.VaultService) field.ErrorList {
+	kind := api.WorkloadKindOf(&vr.Spec)
+	if kind == api.WorkloadKindOf(&old.Spec) {
+		return nil
+	}
+	path := field.NewPath("spec", "workload")
+	if kind != api.WorkloadKindStatefulSet {
+		return field.ErrorList{field.Forbidden(path, "a StatefulSet cannot be migrated back to a Deployment")}
+	}
+	if u := old.Status.Upgrade; u != nil {
+		switch u.Phase {
+		case api.UpgradePhaseBackingUp, api.UpgradePhaseCanary, api.UpgradePhaseSoaking, api.UpgradePhaseRollingOut:
+			return field.ErrorList{field.Forbidden(path, "cannot be changed during an upgrade")}
+		}
+	}
+	return nil
+}
+
+// validateV1alpha1VaultService checks the spec of a (defaulted) v1alpha1 VaultService.
+func validateV1alpha1VaultService(vr *v1alpha1.VaultService) field.ErrorList {
+	errs := validateCommon(vr.Spec.Nodes, vr.Spec.BaseImage, vr.Spec.Version)
+
+	if tls := vr.Spec.TLS; tls != nil {
+		var server, client string
+		if tls.Static != nil {
+			server, client = tls.Static.ServerSecret, tls.Static.ClientSecret
+		}
+		errs = append(errs, validateStaticTLS(field.NewPath("spec", "TLS"), tls.Static != nil, server, client)...)
+	}
+	return errs
+}
+
+// validateCommon checks the spec fields shared by all API versions.
+func validateCommon(nodes int32, baseImage, version string) field.ErrorList {
+	var errs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if nodes < 1 {
+		errs = append(errs, field.Invalid(specPath.Child("nodes"), nodes, "must be at least 1"))
+	}
+	if len(baseImage) == 0 {
+		errs = append(errs, field.Required(specPath.Child("baseImage"), ""))
+	}
+	if _, err := vaultutil.ParseVersion(version); err != nil {
+		errs = append(errs, field.Invalid(specPath.Child("version"), version, err.Error()))
+	}
+	return errs
+}
+
+func validateStaticTLS(tlsPath *field.Path, hasStatic bool, serverSecret, clientSecret string) field.ErrorList {
+	if !hasStatic {
+		return field.ErrorList{field.Required(tlsPath.Child("static"), "serverSecret and clientSecret must be set")}
+	}
+	var errs field.ErrorList
+	if len(serverSecret) == 0 {
+		errs = append(errs, field.Required(tlsPath.Child("static", "serverSecret"), ""))
+	}
+	if len(clientSecret) == 0 {
+		errs = append(errs, field.Required(tlsPath.Child("static", "clientSecret"), ""))
+	}
+	return errs
+}
+
+// validateVersion checks spec.version of a new VaultService, or a change of it if oldVersion is set:
+// - the version is of a release series supported by the operator
+// - spec.version cannot be downgraded
+// - an upgrade cannot skip release series unless spec.upgradeStrategy.multiHop is set
+// All of them are skipped if spec.upgradeStrategy.force is set.
+func validateVersion(version, oldVersion string, us *api.UpgradeStrategy) field.ErrorList {
+	if (us != nil && us.Force) || version == oldVersion {
+		return nil
+	}
+	versionPath := field.NewPath("spec", "version")
+
+	nv, err := vaultutil.ParseVersion(version)
+	if err != nil {
+		// Already reported by validateCommon.
+		return nil
+	}
+	if len(oldVersion) == 0 {
+		if err := vaultutil.CheckSupported(nv); err != nil {
+			return field.ErrorList{field.Invalid(versionPath, version, err.Error()+", set spec.upgradeStrategy.force to override")}
+		}
+		return nil
+	}
+	ov, err := vaultutil.ParseVersion(oldVersion)
+	if err != nil {
+		// Allow moving away from an unparsable version.
+		return nil
+	}
+	path, err := vaultutil.UpgradePath(ov, nv)
+	if err != nil {
+		return field.ErrorList{field.Forbidden(versionPath, err.Error()+", set spec.upgradeStrategy.force to override")}
+	}
+	if len(path) > 1 && (us == nil || !us.MultiHop) {
+		return field.ErrorList{field.Forbidden(versionPath, fmt.Sprintf(
+			"upgrade from %s to %s skips release series, upgrade to %s first or set spec.upgradeStrategy.multiHop", oldVersion, version, path[0]))}
+	}
+	return nil
+}
+
+// validateConfigMap checks that the ConfigMap referenced by spec.configMapName
+// exists and holds a parsable Vault config.
+func (s *Server) validateConfigMap(ctx context.Context, namespace, name string) field.ErrorList {
+	if len(name) == 0 {
+		return nil
+	}
+	cmPath := field.NewPath("spec", "configMapName")
+
+	cm, err := s.kubecli.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return field.ErrorList{field.NotFound(cmPath, name)}
+		}
+		return field.ErrorList{field.InternalError(cmPath, fmt.Errorf("get configmap (%s) failed: %v", name, err))}
+	}
+
+	key := filepath.Base(k8sutil.VaultConfigPath)
+	data, ok := cm.Data[key]
+	if !ok {
+		return field.ErrorList{field.Invalid(cmPath, name, fmt.Sprintf("configmap has no %q key", key))}
+	}
+	if _, err = vaultutil.ParseConfig(data); err != nil {
+		return field.ErrorList{field.Invalid(cmPath, name, fmt.Sprintf("invalid vault config in %q: %v", key, err))}
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestVault returns a defaulted v1beta1 VaultService as the mutating webhook would admit it.
+func newTestVault(name string) *api.VaultService {
+	vr := &api.VaultService{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: api.SchemeGroupVersion.String(),
+			Kind:       api.VaultServiceKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: api.VaultServiceSpec{
+			Nodes:   2,
+			Version: "1.2.3",
+		},
+	}
+	vr.SetDefaults()
+	return vr
+}
+
+// newAdmissionRequest returns an admission request for obj, and for oldObj if it is an update.
+func newAdmissionRequest(t *testing.T, version string, obj, oldObj interface{}) *admissionv1.AdmissionRequest {
+	req := &admissionv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Group: api.SchemeGroupVersion.Group, Version: version, Kind: api.VaultServiceKind},
+		Namespace: "default",
+		Name:      "example",
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: mustMarshal(t, obj)},
+	}
+	if oldObj != nil {
+		req.Operation = admissionv1.Update
+		req.OldObject = runtime.RawExtension{Raw: mustMarshal(t, oldObj)}
+	}
+	return req
+}
+
+func mustMarshal(t *testing.T, obj interface{}) []byte {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("failed to encode %T: %v", obj, err)
+	}
+	return data
+}
+
+func newConfigMap(name, data string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string]string{"vault.hcl": data},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(vr, old *api.VaultService)
+		// update sends the old object alongside the modified one.
+		update bool
+		// wantErr is a substring of the denial message, or empty if the request is allowed.
+		wantErr string
+	}{{
+		name: "valid create",
+	}, {
+		name:    "no nodes",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Nodes = 0 },
+		wantErr: "spec.nodes",
+	}, {
+		name:    "invalid version",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Version = "latest" },
+		wantErr: "spec.version",
+	}, {
+		name:    "unsupported release series",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Version = "0.7.3" },
+		wantErr: "is not supported",
+	}, {
+		name: "forced unsupported release series",
+		modify: func(vr, _ *api.VaultService) {
+			vr.Spec.Version = "0.7.3"
+			vr.Spec.UpgradeStrategy = &api.UpgradeStrategy{Force: true}
+		},
+	}, {
+		name:    "no server secret",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.TLS.Static.ServerSecret = "" },
+		wantErr: "spec.tls.static.serverSecret",
+	}, {
+		name:    "seal without type",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Seal = &api.SealSpec{} },
+		wantErr: "spec.seal.type",
+	}, {
+		name:    "unknown workload",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Workload = "DaemonSet" },
+		wantErr: "spec.workload",
+	}, {
+		name:    "unknown log level",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Config = &api.ConfigSpec{LogLevel: "verbose"} },
+		wantErr: "spec.config.logLevel",
+	}, {
+		name:    "reserved pod label",
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Pod = &api.PodPolicy{Labels: map[string]string{"app": "other"}} },
+		wantErr: "spec.pod.labels[app]",
+	}, {
+		name:   "unchanged update",
+		update: true,
+	}, {
+		name:   "pod update",
+		update: true,
+		modify: func(vr, _ *api.VaultService) { vr.Spec.Pod = &api.PodPolicy{Labels: map[string]string{"team": "a"}} },
+	}, {
+		name:    "reserved pod label update",
+		update:  true,
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Pod = &api.PodPolicy{Labels: map[string]string{"app": "a"}} },
+		wantErr: "spec.pod.labels[app]",
+	}, {
+		name:   "patch upgrade",
+		update: true,
+		modify: func(vr, _ *api.VaultService) { vr.Spec.Version = "1.2.4" },
+	}, {
+		name:    "downgrade",
+		update:  true,
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Version = "1.1.5" },
+		wantErr: "downgrade from 1.2.3 to 1.1.5",
+	}, {
+		name:   "version of a rollback",
+		update: true,
+		modify: func(vr, old *api.VaultService) {
+			vr.Spec.Version = "1.1.5"
+			old.Status.Upgrade = &api.UpgradeStatus{Phase: api.UpgradePhaseRolledBack, FromVersion: "1.1.5"}
+		},
+	}, {
+		name:   "multi-hop upgrade",
+		update: true,
+		modify: func(vr, old *api.VaultService) {
+			old.Spec.Version = "1.0.3"
+			vr.Spec.Version = "1.2.3"
+		},
+		wantErr: "skips release series, upgrade to 1.1.5 first",
+	}, {
+		name:   "allowed multi-hop upgrade",
+		update: true,
+		modify: func(vr, old *api.VaultService) {
+			old.Spec.Version = "1.0.3"
+			vr.Spec.Version = "1.2.3"
+			vr.Spec.UpgradeStrategy = &api.UpgradeStrategy{MultiHop: true}
+		},
+	}, {
+		name:   "telemetry defaulted",
+		update: true,
+		modify: func(_, old *api.VaultService) { old.Spec.Telemetry = nil },
+	}, {
+		name:   "all defaults missing from the old object",
+		update: true,
+		modify: func(_, old *api.VaultService) { old.Spec = api.VaultServiceSpec{Nodes: 2, Version: "1.2.3"} },
+	}, {
+		name:   "config update",
+		update: true,
+		modify: func(vr, _ *api.VaultService) { vr.Spec.Config = &api.ConfigSpec{LogLevel: "debug"} },
+	}, {
+		name:    "invalid config update",
+		update:  true,
+		modify:  func(vr, _ *api.VaultService) { vr.Spec.Config = &api.ConfigSpec{MaxLeaseTTL: "forever"} },
+		wantErr: "spec.config.maxLeaseTTL",
+	}, {
+		name:   "telemetry update",
+		update: true,
+		modify: func(vr, _ *api.VaultService) { vr.Spec.Telemetry = &api.TelemetrySpec{Type: api.TelemetryDisabled} },
+	}, {
+		name: "ingress added",
+		modify: func(vr, _ *api.VaultService) {
+			vr.Spec.Ingress = &api.IngressSpec{Host: "vault.example.com"}
+			vr.SetDefaults()
+		},
+		update: true,
+	}, {
+		name: "ingress host and kind changed",
+		modify: func(vr, old *api.VaultService) {
+			old.Spec.Ingress = &api.IngressSpec{Host: "vault.example.com"}
+			vr.Spec.Ingress = &api.IngressSpec{Host: "secrets.example.com", Kind: api.IngressKindTLSRoute, Gateway: &api.GatewayReference{Name: "gw"}}
+			vr.SetDefaults()
+		},
+		update: true,
+	}, {
+		name:    "statefulset to deployment",
+		update:  true,
+		modify:  func(vr, old *api.VaultService) { old.Spec.Workload = api.WorkloadKindStatefulSet },
+		wantErr: "cannot be migrated back to a Deployment",
+	}, {
+		name:   "deployment to statefulset",
+		update: true,
+		modify: func(vr, _ *api.VaultService) { vr.Spec.Workload = api.WorkloadKindStatefulSet },
+	}}
+
+	s := New(fake.NewSimpleClientset(), "", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vr, old := newTestVault("example"), newTestVault("example")
+			if tt.modify != nil {
+				tt.modify(vr, old)
+			}
+			var oldObj interface{}
+			if tt.update {
+				oldObj = old
+			}
+			resp := s.validate(context.TODO(), newAdmissionRequest(t, api.SchemeGroupVersion.Version, vr, oldObj))
+			checkResponse(t, resp, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateConfigMap(t *testing.T) {
+	tests := []struct {
+		name      string
+		configMap *v1.ConfigMap
+		wantErr   string
+	}{{
+		name:      "valid config",
+		configMap: newConfigMap("vault-config", `max_lease_ttl = "24h"`),
+	}, {
+		name:    "missing configmap",
+		wantErr: "spec.configMapName: Not found",
+	}, {
+		name: "missing key",
+		configMap: &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-config", Namespace: "default"},
+			Data:       map[string]string{"config.hcl": ""},
+		},
+		wantErr: `configmap has no "vault.hcl" key`,
+	}, {
+		name:      "invalid hcl",
+		configMap: newConfigMap("vault-config", `listener "tcp" {`),
+		wantErr:   "invalid vault config",
+	}, {
+		name:      "listener is not a block",
+		configMap: newConfigMap("vault-config", `listener = "tcp"`),
+		wantErr:   "must be a block",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubecli := fake.NewSimpleClientset()
+			if tt.configMap != nil {
+				kubecli = fake.NewSimpleClientset(tt.configMap)
+			}
+			vr := newTestVault("example")
+			vr.Spec.ConfigMapName = "vault-config"
+			resp := New(kubecli, "", "", "").validate(context.TODO(), newAdmissionRequest(t, api.SchemeGroupVersion.Version, vr, nil))
+			checkResponse(t, resp, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateV1alpha1(t *testing.T) {
+	vr := map[string]interface{}{
+		"apiVersion": v1alpha1.SchemeGroupVersion.String(),
+		"kind":       api.VaultServiceKind,
+		"metadata":   map[string]interface{}{"name": "example", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"nodes":     0,
+			"baseImage": "docker.io/vault",
+			"version":   "1.2.3",
+			"TLS":       map[string]interface{}{"static": map[string]interface{}{"serverSecret": "server"}},
+		},
+	}
+	resp := New(fake.NewSimpleClientset(), "", "", "").validate(context.TODO(), newAdmissionRequest(t, v1alpha1.SchemeGroupVersion.Version, vr, nil))
+	checkResponse(t, resp, "spec.nodes")
+	checkResponse(t, resp, "spec.TLS.static.clientSecret")
+}
+
+// checkResponse checks that resp allows the request if wantErr is empty,
+// and that it denies the request with a message containing wantErr otherwise.
+func checkResponse(t *testing.T, resp *admissionv1.AdmissionResponse, wantErr string) {
+	t.Helper()
+	if len(wantErr) == 0 {
+		if !resp.Allowed {
+			t.Errorf("expect request to be allowed, got denied: %s", resp.Result.Message)
+		}
+		return
+	}
+	if resp.Allowed {
+		t.Errorf("expect request to be denied with %q, got allowed", wantErr)
+		return
+	}
+	if !strings.Contains(resp.Result.Message, wantErr) {
+		t.Errorf("expect denial message to contain %q, got: %s", wantErr, resp.Result.Message)
+	}
+}
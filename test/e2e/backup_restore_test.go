@@ -15,6 +15,7 @@
 package e2e
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -24,24 +25,21 @@ import (
 	"testing"
 	"time"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 	"github.com/nanosapp/vault-operator/test/e2e/e2eutil"
 	"github.com/nanosapp/vault-operator/test/e2e/framework"
 
 	eopapi "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
-	"github.com/coreos/etcd-operator/pkg/util/etcdutil"
-	eopk8sutil "github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	"github.com/coreos/etcd-operator/pkg/util/retryutil"
-	eope2eutil "github.com/coreos/etcd-operator/test/e2e/e2eutil"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 // getEndpoints returns endpoints of an etcd cluster given the cluster name and the residing namespace.
-func getEndpoints(kubeClient kubernetes.Interface, secureClient bool, namespace, clusterName string) ([]string, error) {
-	podList, err := kubeClient.Core().Pods(namespace).List(eopk8sutil.ClusterListOpt(clusterName))
+func getEndpoints(kubeClient kubernetes.Interface, namespace, clusterName string) ([]string, error) {
+	podList, err := kubeClient.CoreV1().Pods(namespace).List(context.TODO(), e2eutil.EtcdClusterListOpt(clusterName))
 	if err != nil {
 		return nil, err
 	}
@@ -60,29 +58,23 @@ func getEndpoints(kubeClient kubernetes.Interface, secureClient bool, namespace,
 
 	endpoints := make([]string, len(pods))
 	for i, pod := range pods {
-		m := &etcdutil.Member{
-			Name:         pod.Name,
-			Namespace:    pod.Namespace,
-			SecureClient: secureClient,
-		}
-		endpoints[i] = m.ClientURL()
+		endpoints[i] = e2eutil.EtcdClientURL(pod)
 	}
 	return endpoints, nil
 }
 
 func createBackup(t *testing.T, vaultCR *api.VaultService, etcdClusterName, s3Path string) {
 	f := framework.Global
-	endpoints, err := getEndpoints(f.KubeClient, true, f.Namespace, etcdClusterName)
+	endpoints, err := getEndpoints(f.KubeClient, f.Namespace, etcdClusterName)
 	if err != nil {
 		t.Fatalf("failed to get endpoints: %v", err)
 	}
-	backupCR := eope2eutil.NewS3Backup(endpoints, etcdClusterName, s3Path, os.Getenv("TEST_AWS_SECRET"), k8sutil.EtcdClientTLSSecretName(vaultCR.Name))
-	eb, err := f.EtcdCRClient.EtcdV1beta2().EtcdBackups(f.Namespace).Create(backupCR)
-	if err != nil {
+	eb := e2eutil.NewS3Backup(endpoints, etcdClusterName, f.Namespace, s3Path, os.Getenv("TEST_AWS_SECRET"), k8sutil.EtcdClientTLSSecretName(vaultCR.Name))
+	if err := k8sutil.CreateEtcdBackup(context.TODO(), f.DynamicClient, eb); err != nil {
 		t.Fatalf("failed to create etcd backup cr: %v", err)
 	}
 	defer func() {
-		if err := f.EtcdCRClient.EtcdV1beta2().EtcdBackups(f.Namespace).Delete(eb.Name, nil); err != nil {
+		if err := k8sutil.DeleteEtcdBackup(context.TODO(), f.DynamicClient, f.Namespace, eb.Name); err != nil {
 			t.Fatalf("failed to delete etcd backup cr: %v", err)
 		}
 	}()
@@ -91,7 +83,7 @@ func createBackup(t *testing.T, vaultCR *api.VaultService, etcdClusterName, s3Pa
 	// 4 seconds timeout via retry is enough; duration longer than that may indicate internal issues and
 	// is worthy of investigation.
 	err = retryutil.Retry(time.Second, 4, func() (bool, error) {
-		reb, err := f.EtcdCRClient.EtcdV1beta2().EtcdBackups(f.Namespace).Get(eb.Name, metav1.GetOptions{})
+		reb, err := k8sutil.GetEtcdBackup(context.TODO(), f.DynamicClient, f.Namespace, eb.Name)
 		if err != nil {
 			return false, fmt.Errorf("failed to retrieve backup CR: %v", err)
 		}
@@ -114,8 +106,8 @@ func createBackup(t *testing.T, vaultCR *api.VaultService, etcdClusterName, s3Pa
 
 func killEtcdCluster(t *testing.T, etcdClusterName string) {
 	f := framework.Global
-	lops := eopk8sutil.ClusterListOpt(etcdClusterName)
-	err := f.KubeClient.CoreV1().Pods(f.Namespace).DeleteCollection(metav1.NewDeleteOptions(0), lops)
+	lops := e2eutil.EtcdClusterListOpt(etcdClusterName)
+	err := f.KubeClient.CoreV1().Pods(f.Namespace).DeleteCollection(context.TODO(), *metav1.NewDeleteOptions(0), lops)
 	if err != nil {
 		t.Fatalf("failed to delete etcd cluster pods: %v", err)
 	}
@@ -127,20 +119,18 @@ func killEtcdCluster(t *testing.T, etcdClusterName string) {
 // restoreEtcdCluster restores an etcd cluster with name "etcdClusterName" from a backup saved on "s3Path".
 func restoreEtcdCluster(t *testing.T, s3Path, etcdClusterName string) {
 	f := framework.Global
-	restoreSource := eopapi.RestoreSource{S3: eope2eutil.NewS3RestoreSource(s3Path, os.Getenv("TEST_AWS_SECRET"))}
-	er := eope2eutil.NewEtcdRestore(etcdClusterName, 3, restoreSource, eopapi.BackupStorageTypeS3)
-	er, err := f.EtcdCRClient.EtcdV1beta2().EtcdRestores(f.Namespace).Create(er)
-	if err != nil {
+	er := e2eutil.NewS3EtcdRestore(etcdClusterName, f.Namespace, s3Path, os.Getenv("TEST_AWS_SECRET"))
+	if err := e2eutil.CreateEtcdRestore(f.DynamicClient, er); err != nil {
 		t.Fatalf("failed to create etcd restore cr: %v", err)
 	}
 	defer func() {
-		if err := f.EtcdCRClient.EtcdV1beta2().EtcdRestores(f.Namespace).Delete(er.Name, nil); err != nil {
+		if err := e2eutil.DeleteEtcdRestore(f.DynamicClient, f.Namespace, er.Name); err != nil {
 			t.Fatalf("failed to delete etcd restore cr: %v", err)
 		}
 	}()
 
-	err = retryutil.Retry(10*time.Second, 1, func() (bool, error) {
-		er, err := f.EtcdCRClient.EtcdV1beta2().EtcdRestores(f.Namespace).Get(er.Name, metav1.GetOptions{})
+	err := retryutil.Retry(10*time.Second, 1, func() (bool, error) {
+		er, err := e2eutil.GetEtcdRestore(f.DynamicClient, f.Namespace, er.Name)
 		if err != nil {
 			return false, fmt.Errorf("failed to retrieve restore CR: %v", err)
 		}
@@ -156,17 +146,8 @@ func restoreEtcdCluster(t *testing.T, s3Path, etcdClusterName string) {
 	}
 
 	// Verify that the restored etcd cluster scales to 3 ready members
-	restoredCluster := &eopapi.EtcdCluster{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      etcdClusterName,
-			Namespace: f.Namespace,
-		},
-		Spec: eopapi.ClusterSpec{
-			Size: 3,
-		},
-	}
-	if _, err := eope2eutil.WaitUntilSizeReached(t, f.EtcdCRClient, 3, 6, restoredCluster); err != nil {
-		t.Fatalf("failed to see restored etcd cluster(%v) reach 3 members: %v", restoredCluster.Name, err)
+	if _, err := e2eutil.WaitUntilEtcdSizeReached(t, f.DynamicClient, 3, 6, f.Namespace, etcdClusterName); err != nil {
+		t.Fatalf("failed to see restored etcd cluster(%v) reach 3 members: %v", etcdClusterName, err)
 	}
 }
 
@@ -15,10 +15,11 @@
 package e2eutil
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -26,7 +27,7 @@ import (
 
 // CreateCluster creates a vault CR with the desired spec
 func CreateCluster(t *testing.T, crClient versioned.Interface, vs *api.VaultService) (*api.VaultService, error) {
-	vault, err := crClient.VaultV1alpha1().VaultServices(vs.Namespace).Create(vs)
+	vault, err := crClient.VaultV1beta1().VaultServices(vs.Namespace).Create(context.TODO(), vs, metav1.CreateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CR: %v", err)
 	}
@@ -36,12 +37,12 @@ func CreateCluster(t *testing.T, crClient versioned.Interface, vs *api.VaultServ
 
 // ResizeCluster updates the Nodes field of the vault CR
 func ResizeCluster(t *testing.T, crClient versioned.Interface, vs *api.VaultService, size int) (*api.VaultService, error) {
-	vault, err := crClient.VaultV1alpha1().VaultServices(vs.Namespace).Get(vs.Name, metav1.GetOptions{})
+	vault, err := crClient.VaultV1beta1().VaultServices(vs.Namespace).Get(context.TODO(), vs.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get CR: %v", err)
 	}
 	vault.Spec.Nodes = int32(size)
-	vault, err = crClient.VaultV1alpha1().VaultServices(vs.Namespace).Update(vault)
+	vault, err = crClient.VaultV1beta1().VaultServices(vs.Namespace).Update(context.TODO(), vault, metav1.UpdateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to update CR: %v", err)
 	}
@@ -49,14 +50,29 @@ func ResizeCluster(t *testing.T, crClient versioned.Interface, vs *api.VaultServ
 	return vault, nil
 }
 
+// ScaleCluster updates the Nodes field of the vault CR through the scale subresource
+func ScaleCluster(t *testing.T, crClient versioned.Interface, vs *api.VaultService, size int) error {
+	scale, err := crClient.VaultV1beta1().VaultServices(vs.Namespace).GetScale(context.TODO(), vs.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get scale of CR: %v", err)
+	}
+	scale.Spec.Replicas = int32(size)
+	_, err = crClient.VaultV1beta1().VaultServices(vs.Namespace).UpdateScale(context.TODO(), vs.Name, scale, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update scale of CR: %v", err)
+	}
+	LogfWithTimestamp(t, "scaled vault cluster(%v) to size(%v)", vs.Name, size)
+	return nil
+}
+
 // UpdateVersion updates the Version field of the vault CR
 func UpdateVersion(t *testing.T, crClient versioned.Interface, vs *api.VaultService, version string) (*api.VaultService, error) {
-	vault, err := crClient.VaultV1alpha1().VaultServices(vs.Namespace).Get(vs.Name, metav1.GetOptions{})
+	vault, err := crClient.VaultV1beta1().VaultServices(vs.Namespace).Get(context.TODO(), vs.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get CR: %v", err)
 	}
 	vault.Spec.Version = version
-	vault, err = crClient.VaultV1alpha1().VaultServices(vs.Namespace).Update(vault)
+	vault, err = crClient.VaultV1beta1().VaultServices(vs.Namespace).Update(context.TODO(), vault, metav1.UpdateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to update CR: %v", err)
 	}
@@ -67,7 +83,7 @@ func UpdateVersion(t *testing.T, crClient versioned.Interface, vs *api.VaultServ
 // DeleteCluster deletes the vault CR specified by cluster spec
 func DeleteCluster(t *testing.T, crClient versioned.Interface, vs *api.VaultService) error {
 	t.Logf("deleting vault cluster: %v", vs.Name)
-	err := crClient.VaultV1alpha1().VaultServices(vs.Namespace).Delete(vs.Name, nil)
+	err := crClient.VaultV1beta1().VaultServices(vs.Namespace).Delete(context.TODO(), vs.Name, metav1.DeleteOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to delete CR: %v", err)
 	}
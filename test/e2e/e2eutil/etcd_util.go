@@ -0,0 +1,143 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2eutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+
+	eopapi "github.com/coreos/etcd-operator/pkg/apis/etcd/v1beta2"
+	"github.com/coreos/etcd-operator/pkg/util/retryutil"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// etcdRestoreResource is the resource of the etcd restore operator EtcdRestores.
+var etcdRestoreResource = eopapi.SchemeGroupVersion.WithResource(eopapi.EtcdRestoreResourcePlural)
+
+// EtcdClusterListOpt returns the list options selecting the pods of the etcd cluster.
+func EtcdClusterListOpt(clusterName string) metav1.ListOptions {
+	sel := map[string]string{"etcd_cluster": clusterName, "app": "etcd"}
+	return metav1.ListOptions{LabelSelector: labels.SelectorFromSet(sel).String()}
+}
+
+// EtcdClientURL returns the TLS client URL of the etcd member running in the pod.
+// The members are named <cluster-name>-<id>.
+func EtcdClientURL(pod *v1.Pod) string {
+	clusterName := pod.Name[:strings.LastIndex(pod.Name, "-")]
+	return fmt.Sprintf("https://%s.%s.%s.svc:2379", pod.Name, clusterName, pod.Namespace)
+}
+
+// NewS3Backup returns an EtcdBackup CR, named after the etcd cluster, that saves a backup to the S3 path.
+func NewS3Backup(endpoints []string, clusterName, namespace, path, secret, clientTLSSecret string) *eopapi.EtcdBackup {
+	return &eopapi.EtcdBackup{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       eopapi.EtcdBackupResourceKind,
+			APIVersion: eopapi.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: eopapi.BackupSpec{
+			EtcdEndpoints:   endpoints,
+			StorageType:     eopapi.BackupStorageTypeS3,
+			ClientTLSSecret: clientTLSSecret,
+			BackupSource: eopapi.BackupSource{
+				S3: &eopapi.S3BackupSource{
+					Path:      path,
+					AWSSecret: secret,
+				},
+			},
+		},
+	}
+}
+
+// NewS3EtcdRestore returns an EtcdRestore CR that restores the etcd cluster from the backup on the S3 path.
+// The EtcdRestore CR name must be the same as the name of the etcd cluster.
+func NewS3EtcdRestore(clusterName, namespace, path, secret string) *eopapi.EtcdRestore {
+	return &eopapi.EtcdRestore{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       eopapi.EtcdRestoreResourceKind,
+			APIVersion: eopapi.SchemeGroupVersion.String(),
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName,
+			Namespace: namespace,
+		},
+		Spec: eopapi.RestoreSpec{
+			EtcdCluster:       eopapi.EtcdClusterRef{Name: clusterName},
+			BackupStorageType: eopapi.BackupStorageTypeS3,
+			RestoreSource: eopapi.RestoreSource{
+				S3: &eopapi.S3RestoreSource{
+					Path:      path,
+					AWSSecret: secret,
+				},
+			},
+		},
+	}
+}
+
+// CreateEtcdRestore creates the EtcdRestore CR.
+func CreateEtcdRestore(dynamicCli dynamic.Interface, er *eopapi.EtcdRestore) error {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(er)
+	if err != nil {
+		return err
+	}
+	_, err = dynamicCli.Resource(etcdRestoreResource).Namespace(er.Namespace).Create(context.TODO(), &unstructured.Unstructured{Object: u}, metav1.CreateOptions{})
+	return err
+}
+
+// GetEtcdRestore returns the EtcdRestore CR with the given namespace and name.
+func GetEtcdRestore(dynamicCli dynamic.Interface, namespace, name string) (*eopapi.EtcdRestore, error) {
+	u, err := dynamicCli.Resource(etcdRestoreResource).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	er := &eopapi.EtcdRestore{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, er)
+	return er, err
+}
+
+// DeleteEtcdRestore deletes the EtcdRestore CR with the given namespace and name.
+func DeleteEtcdRestore(dynamicCli dynamic.Interface, namespace, name string) error {
+	return dynamicCli.Resource(etcdRestoreResource).Namespace(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
+
+// WaitUntilEtcdSizeReached retries until the etcd cluster has the desired number of ready members.
+func WaitUntilEtcdSizeReached(t *testing.T, dynamicCli dynamic.Interface, size, retries int, namespace, name string) ([]string, error) {
+	var ready []string
+	err := retryutil.Retry(retryInterval, retries, func() (bool, error) {
+		ec, err := k8sutil.GetEtcdCluster(context.TODO(), dynamicCli, namespace, name)
+		if err != nil {
+			return false, fmt.Errorf("failed to get etcd cluster (%s): %v", name, err)
+		}
+		ready = ec.Status.Members.Ready
+		LogfWithTimestamp(t, "ready etcd members: (%v)", ready)
+		return len(ready) == size, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for etcd cluster (%s) to reach %d ready members: %v", name, size, err)
+	}
+	return ready, nil
+}
@@ -15,11 +15,12 @@
 package e2eutil
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 	"github.com/nanosapp/vault-operator/pkg/util/vaultutil"
@@ -40,7 +41,7 @@ func WaitForCluster(t *testing.T, kubeClient kubernetes.Interface, vaultsCRClien
 		t.Fatalf("failed to wait for cluster nodes to become available: %v", err)
 	}
 
-	tlsConfig, err := k8sutil.VaultTLSFromSecret(kubeClient, vaultCR)
+	tlsConfig, err := k8sutil.VaultTLSFromSecret(context.TODO(), kubeClient, vaultCR)
 	if err != nil {
 		t.Fatalf("failed to read TLS config for vault client: %v", err)
 	}
@@ -78,7 +79,7 @@ func UnsealVaultNode(unsealKey string, vClient *vaultapi.Client) error {
 
 // SetupVaultClient creates a vault client for the specified pod
 func SetupVaultClient(t *testing.T, kubeClient kubernetes.Interface, namespace string, tlsConfig *vaultapi.TLSConfig, podName string) *vaultapi.Client {
-	pod, err := kubeClient.CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+	pod, err := kubeClient.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
 	if err != nil {
 		t.Fatalf("fail to get vault pod (%s): %v", podName, err)
 	}
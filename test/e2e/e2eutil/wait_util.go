@@ -15,12 +15,13 @@
 package e2eutil
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
 	"time"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
 
@@ -47,7 +48,7 @@ func WaitUntilOperatorReady(kubecli kubernetes.Interface, namespace, name string
 		LabelSelector: labels.SelectorFromSet(PodLabelForOperator(name)).String(),
 	}
 	err := retryutil.Retry(retryInterval, 6, func() (bool, error) {
-		podList, err := kubecli.CoreV1().Pods(namespace).List(lo)
+		podList, err := kubecli.CoreV1().Pods(namespace).List(context.TODO(), lo)
 		if err != nil {
 			return false, err
 		}
@@ -70,7 +71,7 @@ func WaitUntilVaultConditionTrue(t *testing.T, vaultsCRClient versioned.Interfac
 	var vault *api.VaultService
 	var err error
 	err = retryutil.Retry(retryInterval, retries, func() (bool, error) {
-		vault, err = vaultsCRClient.VaultV1alpha1().VaultServices(vs.Namespace).Get(vs.Name, metav1.GetOptions{})
+		vault, err = vaultsCRClient.VaultV1beta1().VaultServices(vs.Namespace).Get(context.TODO(), vs.Name, metav1.GetOptions{})
 		if err != nil {
 			return false, fmt.Errorf("failed to get CR: %v", err)
 		}
@@ -152,7 +153,7 @@ func WaitPodsWithImageDeleted(kubecli kubernetes.Interface, namespace, image str
 func waitPodsDeleted(kubecli kubernetes.Interface, namespace string, retries int, lo metav1.ListOptions, filters ...filterFunc) ([]*v1.Pod, error) {
 	var pods []*v1.Pod
 	err := retryutil.Retry(retryInterval, retries, func() (bool, error) {
-		podList, err := kubecli.CoreV1().Pods(namespace).List(lo)
+		podList, err := kubecli.CoreV1().Pods(namespace).List(context.TODO(), lo)
 		if err != nil {
 			return false, fmt.Errorf("failed to list pods: %v", err)
 		}
@@ -180,7 +181,7 @@ func CheckVersionReached(t *testing.T, kubeClient kubernetes.Interface, version
 	var names []string
 	sel := k8sutil.LabelsForVault(vs.Name)
 	opt := metav1.ListOptions{LabelSelector: labels.SelectorFromSet(sel).String()}
-	podList, err := kubeClient.Core().Pods(vs.Namespace).List(opt)
+	podList, err := kubeClient.CoreV1().Pods(vs.Namespace).List(context.TODO(), opt)
 	if err != nil {
 		return err
 	}
@@ -225,7 +226,7 @@ func WaitUntilActiveIsFrom(t *testing.T, vaultsCRClient versioned.Interface, ret
 	var err error
 	// TODO: refactor WaitXXX func on VaultService to apply generic condition
 	err = retryutil.Retry(retryInterval, retries, func() (bool, error) {
-		vault, err = vaultsCRClient.VaultV1alpha1().VaultServices(vs.Namespace).Get(vs.Name, metav1.GetOptions{})
+		vault, err = vaultsCRClient.VaultV1beta1().VaultServices(vs.Namespace).Get(context.TODO(), vs.Name, metav1.GetOptions{})
 		if err != nil {
 			return false, fmt.Errorf("failed to get CR: %v", err)
 		}
@@ -246,7 +247,7 @@ func WaitUntilStandbyAreFrom(t *testing.T, vaultsCRClient versioned.Interface, r
 	var vault *api.VaultService
 	var err error
 	err = retryutil.Retry(retryInterval, retries, func() (bool, error) {
-		vault, err = vaultsCRClient.VaultV1alpha1().VaultServices(vs.Namespace).Get(vs.Name, metav1.GetOptions{})
+		vault, err = vaultsCRClient.VaultV1beta1().VaultServices(vs.Namespace).Get(context.TODO(), vs.Name, metav1.GetOptions{})
 		if err != nil {
 			return false, fmt.Errorf("failed to get CR: %v", err)
 		}
@@ -269,7 +270,7 @@ func WaitUntilAvailableAreFrom(t *testing.T, vaultsCRClient versioned.Interface,
 	var vault *api.VaultService
 	var err error
 	err = retryutil.Retry(retryInterval, retries, func() (bool, error) {
-		vault, err = vaultsCRClient.VaultV1alpha1().VaultServices(vs.Namespace).Get(vs.Name, metav1.GetOptions{})
+		vault, err = vaultsCRClient.VaultV1beta1().VaultServices(vs.Namespace).Get(context.TODO(), vs.Name, metav1.GetOptions{})
 		if err != nil {
 			return false, fmt.Errorf("failed to get CR: %v", err)
 		}
@@ -297,3 +298,30 @@ func getAvailableNodes(vs api.VaultStatus) []string {
 	available = append(available, vs.Standby...)
 	return available
 }
+
+// CreateAndWaitPodRunning creates the pod and retries until its phase becomes running.
+func CreateAndWaitPodRunning(kubecli kubernetes.Interface, pod *v1.Pod, retries int) (*v1.Pod, error) {
+	_, err := kubecli.CoreV1().Pods(pod.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pod (%s): %v", pod.Name, err)
+	}
+	var p *v1.Pod
+	err = retryutil.Retry(retryInterval, retries, func() (bool, error) {
+		p, err = kubecli.CoreV1().Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch p.Status.Phase {
+		case v1.PodRunning:
+			return true, nil
+		case v1.PodPending:
+			return false, nil
+		default:
+			return false, fmt.Errorf("unexpected pod status.phase: %v", p.Status.Phase)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for pod (%s) to become running: %v", pod.Name, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The vault-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package e2eutil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nanosapp/vault-operator/pkg/util/tlsutil"
+	"github.com/nanosapp/vault-operator/pkg/webhook"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	webhookSecretName = "vault-operator-webhook"
+	webhookCertDir    = "/etc/vault-operator/webhook"
+)
+
+// CreateOperatorWebhook creates the webhook service in front of the operator pods with the given name,
+// and the secret with a self-signed certificate for it. The operator registers the vault CRD with
+// its conversion webhook, so it has to serve the webhooks, see AddWebhookToOperatorPod.
+func CreateOperatorWebhook(kubecli kubernetes.Interface, namespace, name string) error {
+	caKey, err := tlsutil.NewPrivateKey()
+	if err != nil {
+		return err
+	}
+	caCert, err := tlsutil.NewSelfSignedCACertificate(tlsutil.CertConfig{CommonName: "vault operator webhook CA"}, caKey)
+	if err != nil {
+		return err
+	}
+	key, err := tlsutil.NewPrivateKey()
+	if err != nil {
+		return err
+	}
+	host := fmt.Sprintf("%s.%s.svc", webhook.ServiceName, namespace)
+	cert, err := tlsutil.NewSignedCertificate(tlsutil.CertConfig{CommonName: host, AltNames: tlsutil.NewAltNames([]string{host})}, key, caCert, caKey)
+	if err != nil {
+		return err
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookSecretName},
+		Data: map[string][]byte{
+			"tls.crt": tlsutil.EncodeCertificatePEM(cert),
+			"tls.key": tlsutil.EncodePrivateKeyPEM(key),
+			"ca.crt":  tlsutil.EncodeCertificatePEM(caCert),
+		},
+	}
+	_, err = kubecli.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create webhook secret: %v", err)
+	}
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: webhook.ServiceName},
+		Spec: v1.ServiceSpec{
+			Selector: PodLabelForOperator(name),
+			Ports:    []v1.ServicePort{{Port: 443, TargetPort: intstr.FromInt(8443)}},
+		},
+	}
+	_, err = kubecli.CoreV1().Services(namespace).Create(context.TODO(), svc, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create webhook service: %v", err)
+	}
+	return nil
+}
+
+// AddWebhookToOperatorPod makes the operator of the pod spec serve the webhooks
+// with the certificate of CreateOperatorWebhook.
+func AddWebhookToOperatorPod(spec *v1.PodSpec) {
+	c := &spec.Containers[0]
+	c.Args = append(c.Args, "-webhook-listen-addr=0.0.0.0:8443", "-webhook-ca-file="+webhookCertDir+"/ca.crt")
+	c.VolumeMounts = append(c.VolumeMounts, v1.VolumeMount{Name: webhookSecretName, MountPath: webhookCertDir, ReadOnly: true})
+	spec.Volumes = append(spec.Volumes, v1.Volume{
+		Name:         webhookSecretName,
+		VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: webhookSecretName}},
+	})
+}
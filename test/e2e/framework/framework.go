@@ -15,24 +15,23 @@
 package framework
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"time"
 
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/pkg/client"
 	"github.com/nanosapp/vault-operator/pkg/generated/clientset/versioned"
 	"github.com/nanosapp/vault-operator/pkg/util/k8sutil"
+	"github.com/nanosapp/vault-operator/pkg/util/probe"
 	"github.com/nanosapp/vault-operator/test/e2e/e2eutil"
 
-	etcdclient "github.com/coreos/etcd-operator/pkg/client"
-	etcdversioned "github.com/coreos/etcd-operator/pkg/generated/clientset/versioned"
-	eopK8sutil "github.com/coreos/etcd-operator/pkg/util/k8sutil"
-	"github.com/coreos/etcd-operator/pkg/util/probe"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -52,7 +51,7 @@ type Framework struct {
 	Config         *restclient.Config
 	RESTClient     *restclient.RESTClient
 	VaultsCRClient versioned.Interface
-	EtcdCRClient   etcdversioned.Interface
+	DynamicClient  dynamic.Interface
 	Namespace      string
 	vopImage       string
 	eopImage       string
@@ -79,14 +78,17 @@ func Setup() error {
 		return fmt.Errorf("failed to create kube CRD client: %v", err)
 	}
 	vaultsCRClient := client.MustNew(config)
-	etcdCRClient := etcdclient.MustNew(config)
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %v", err)
+	}
 
 	Global = &Framework{
 		KubeClient:     kubeClient,
 		crdcli:         crdcli,
 		Config:         config,
 		VaultsCRClient: vaultsCRClient,
-		EtcdCRClient:   etcdCRClient,
+		DynamicClient:  dynamicClient,
 		Namespace:      *ns,
 		vopImage:       *vopImage,
 		eopImage:       *eopImage,
@@ -97,11 +99,11 @@ func Setup() error {
 
 // Teardown removes the vault-operator deployment and waits for its termination
 func Teardown() error {
-	err := Global.KubeClient.CoreV1().Pods(Global.Namespace).Delete(vaultOperatorName, k8sutil.CascadeDeleteBackground())
+	err := Global.KubeClient.CoreV1().Pods(Global.Namespace).Delete(context.TODO(), vaultOperatorName, k8sutil.CascadeDeleteBackground())
 	if err != nil {
 		return fmt.Errorf("failed to delete pod: %v", err)
 	}
-	err = Global.KubeClient.CoreV1().Pods(Global.Namespace).Delete(etcdOperatorName, k8sutil.CascadeDeleteBackground())
+	err = Global.KubeClient.CoreV1().Pods(Global.Namespace).Delete(context.TODO(), etcdOperatorName, k8sutil.CascadeDeleteBackground())
 	if err != nil {
 		return fmt.Errorf("failed to delete pod: %v", err)
 	}
@@ -149,16 +151,19 @@ func (f *Framework) deployVaultOperatorPod() error {
 		},
 	}
 
+	if err := e2eutil.CreateOperatorWebhook(f.KubeClient, f.Namespace, vaultOperatorName); err != nil {
+		return err
+	}
+	e2eutil.AddWebhookToOperatorPod(&pod.Spec)
+
 	// Create and wait for pod phase to become running
 	// TODO: Replace with operator pod actually becoming ready once the vault-operator supports a readiness probe
-	_, err := eopK8sutil.CreateAndWaitPod(f.KubeClient, f.Namespace, pod, 60*time.Second)
+	_, err := e2eutil.CreateAndWaitPodRunning(f.KubeClient, pod, 6)
 	if err != nil {
 		return err
 	}
-	if err != nil {
-		return fmt.Errorf("failed to create pod: %v", err)
-	}
-	return nil
+	// The operator registers the vault CRD once it becomes the leader.
+	return k8sutil.WaitCRDReady(context.TODO(), f.crdcli, api.CRDName)
 }
 
 func (f *Framework) deployEtcdOperatorPod() error {
@@ -185,7 +190,7 @@ func (f *Framework) deployEtcdOperatorPod() error {
 						},
 					},
 					ReadinessProbe: &v1.Probe{
-						Handler: v1.Handler{
+						ProbeHandler: v1.ProbeHandler{
 							HTTPGet: &v1.HTTPGetAction{
 								Path: probe.HTTPReadyzEndpoint,
 								Port: intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
@@ -233,7 +238,7 @@ func (f *Framework) deployEtcdOperatorPod() error {
 		},
 	}
 
-	_, err := f.KubeClient.CoreV1().Pods(f.Namespace).Create(pod)
+	_, err := f.KubeClient.CoreV1().Pods(f.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create pod: %v", err)
 	}
@@ -17,7 +17,7 @@ package e2e
 import (
 	"testing"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/test/e2e/e2eutil"
 	"github.com/nanosapp/vault-operator/test/e2e/framework"
 )
@@ -78,3 +78,32 @@ func TestScaleUp(t *testing.T) {
 	}
 
 }
+
+func TestScaleSubresource(t *testing.T) {
+	f := framework.Global
+	vaultCR, err := e2eutil.CreateCluster(t, f.VaultsCRClient, e2eutil.NewCluster("test-vault-", f.Namespace, 1))
+	if err != nil {
+		t.Fatalf("failed to create vault cluster: %v", err)
+	}
+	defer func(vaultCR *api.VaultService) {
+		if err := e2eutil.DeleteCluster(t, f.VaultsCRClient, vaultCR); err != nil {
+			t.Fatalf("failed to delete vault cluster: %v", err)
+		}
+	}(vaultCR)
+
+	vaultCR, _ = e2eutil.WaitForCluster(t, f.KubeClient, f.VaultsCRClient, vaultCR)
+
+	// Scale the cluster to 2 nodes the same way `kubectl scale` and HPA do
+	if err := e2eutil.ScaleCluster(t, f.VaultsCRClient, vaultCR, 2); err != nil {
+		t.Fatalf("failed to scale vault cluster: %v", err)
+	}
+
+	// The vault is not initialized, so both nodes come up sealed
+	vaultCR, err = e2eutil.WaitSealedVaultsUp(t, f.VaultsCRClient, 2, 6, vaultCR)
+	if err != nil {
+		t.Fatalf("failed to wait for vault nodes to become sealed: %v", err)
+	}
+	if vaultCR.Status.Nodes != 2 || vaultCR.Status.SealedNodes != 2 {
+		t.Fatalf("expected 2 running and 2 sealed nodes in status, got %d and %d", vaultCR.Status.Nodes, vaultCR.Status.SealedNodes)
+	}
+}
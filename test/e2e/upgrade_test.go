@@ -17,7 +17,7 @@ package e2e
 import (
 	"testing"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/test/e2e/e2eutil"
 	"github.com/nanosapp/vault-operator/test/e2e/framework"
 )
@@ -15,6 +15,7 @@
 package framework
 
 import (
+	"context"
 	"flag"
 	"fmt"
 
@@ -24,10 +25,10 @@ import (
 	"github.com/nanosapp/vault-operator/pkg/util/probe"
 	"github.com/nanosapp/vault-operator/test/e2e/e2eutil"
 
-	eopk8sutil "github.com/coreos/etcd-operator/pkg/util/k8sutil"
 	"github.com/sirupsen/logrus"
-	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -90,7 +91,7 @@ func Setup() error {
 
 // TearDown removes the etcd-operator pod
 func TearDown() error {
-	err := Global.KubeClient.CoreV1().Pods(Global.Namespace).Delete(etcdOperatorName, k8sutil.CascadeDeleteBackground())
+	err := Global.KubeClient.CoreV1().Pods(Global.Namespace).Delete(context.TODO(), etcdOperatorName, k8sutil.CascadeDeleteBackground())
 	if err != nil {
 		return fmt.Errorf("failed to delete pod: %v", err)
 	}
@@ -101,15 +102,15 @@ func TearDown() error {
 
 // CreateOperatorDeployment creates a vault operator deployment with the specified name
 func (f *Framework) CreateOperatorDeployment(name string) error {
-	d := &appsv1beta1.Deployment{
+	d := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: f.Namespace,
 		},
-		Spec: appsv1beta1.DeploymentSpec{
-			Strategy: appsv1beta1.DeploymentStrategy{
-				Type: appsv1beta1.RollingUpdateDeploymentStrategyType,
-				RollingUpdate: &appsv1beta1.RollingUpdateDeployment{
+		Spec: appsv1.DeploymentSpec{
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
 					MaxUnavailable: &intstr.IntOrString{Type: intstr.Int, IntVal: 1},
 					MaxSurge:       &intstr.IntOrString{Type: intstr.Int, IntVal: 1},
 				},
@@ -135,7 +136,7 @@ func (f *Framework) CreateOperatorDeployment(name string) error {
 							},
 						},
 						ReadinessProbe: &v1.Probe{
-							Handler: v1.Handler{
+							ProbeHandler: v1.ProbeHandler{
 								HTTPGet: &v1.HTTPGetAction{
 									Path: probe.HTTPReadyzEndpoint,
 									Port: intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
@@ -150,16 +151,16 @@ func (f *Framework) CreateOperatorDeployment(name string) error {
 			},
 		},
 	}
-	_, err := f.KubeClient.AppsV1beta1().Deployments(f.Namespace).Create(d)
+	_, err := f.KubeClient.AppsV1().Deployments(f.Namespace).Create(context.TODO(), d, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create deployment: %v", err)
 	}
 	return nil
 }
 
-// DeleteOperatorDeployment deletes the vault operator deployment with the specified name, waits for all its pods to be removed and deletes the Endpoint resource used for the leader election lock
+// DeleteOperatorDeployment deletes the vault operator deployment with the specified name, waits for all its pods to be removed and deletes the Endpoints and Lease resources used for the leader election lock
 func (f *Framework) DeleteOperatorDeployment(name string) error {
-	err := f.KubeClient.AppsV1beta1().Deployments(f.Namespace).Delete(name, k8sutil.CascadeDeleteBackground())
+	err := f.KubeClient.AppsV1().Deployments(f.Namespace).Delete(context.TODO(), name, k8sutil.CascadeDeleteBackground())
 	if err != nil {
 		return fmt.Errorf("failed to delete deployment: %v", err)
 	}
@@ -171,20 +172,34 @@ func (f *Framework) DeleteOperatorDeployment(name string) error {
 	if err != nil {
 		return fmt.Errorf("failed to wait for operator pods to be completely removed: %v", err)
 	}
-	// The deleted operator will not actively release the Endpoints lock causing a non-leader candidate to timeout for the lease duration: 15s
-	// Deleting the Endpoints resource simulates the leader actively releasing the lock so that the next candidate avoids the timeout.
-	// TODO: change this if we change to use another kind of lock, e.g. configmap.
-	return f.KubeClient.CoreV1().Endpoints(f.Namespace).Delete("vault-operator", metav1.NewDeleteOptions(0))
+	// The deleted operator will not actively release the lock causing a non-leader candidate to timeout for the lease duration: 15s
+	// Deleting the lock resources simulates the leader actively releasing the lock so that the next candidate avoids the timeout.
+	// Older operators only hold the Endpoints lock.
+	err = f.KubeClient.CoreV1().Endpoints(f.Namespace).Delete(context.TODO(), "vault-operator", *metav1.NewDeleteOptions(0))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	err = f.KubeClient.CoordinationV1().Leases(f.Namespace).Delete(context.TODO(), "vault-operator", *metav1.NewDeleteOptions(0))
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
 }
 
 func (f *Framework) UpgradeOperator(name string) error {
-	uf := func(d *appsv1beta1.Deployment) {
-		d.Spec.Template.Spec.Containers[0].Image = f.newVOPImage
+	d, err := f.KubeClient.AppsV1().Deployments(f.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %v", err)
+	}
+	d.Spec.Template.Spec.Containers[0].Image = f.newVOPImage
+	// The new operator registers the vault CRD with its conversion webhook.
+	if err = e2eutil.CreateOperatorWebhook(f.KubeClient, f.Namespace, name); err != nil {
+		return err
 	}
-	// TODO: Put PatchDeployment into vault's k8sutil
-	err := eopk8sutil.PatchDeployment(f.KubeClient, f.Namespace, name, uf)
+	e2eutil.AddWebhookToOperatorPod(&d.Spec.Template.Spec)
+	_, err = f.KubeClient.AppsV1().Deployments(f.Namespace).Update(context.TODO(), d, metav1.UpdateOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to patch deployment: %v", err)
+		return fmt.Errorf("failed to update deployment: %v", err)
 	}
 
 	lo := metav1.ListOptions{
@@ -221,7 +236,7 @@ func (f *Framework) deployEtcdOperatorPod() error {
 						},
 					},
 					ReadinessProbe: &v1.Probe{
-						Handler: v1.Handler{
+						ProbeHandler: v1.ProbeHandler{
 							HTTPGet: &v1.HTTPGetAction{
 								Path: probe.HTTPReadyzEndpoint,
 								Port: intstr.IntOrString{Type: intstr.Int, IntVal: 8080},
@@ -237,7 +252,7 @@ func (f *Framework) deployEtcdOperatorPod() error {
 		},
 	}
 
-	_, err := f.KubeClient.CoreV1().Pods(f.Namespace).Create(pod)
+	_, err := f.KubeClient.CoreV1().Pods(f.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create pod: %v", err)
 	}
@@ -19,7 +19,7 @@ import (
 	"math/rand"
 	"testing"
 
-	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1alpha1"
+	api "github.com/nanosapp/vault-operator/pkg/apis/vault/v1beta1"
 	"github.com/nanosapp/vault-operator/test/e2e/e2eutil"
 	"github.com/nanosapp/vault-operator/test/e2e/upgradetest/framework"
 )